@@ -80,6 +80,11 @@ func (m *MockBlockReader) ReadBlockByRoot(ctx context.Context, tx kv.Tx, blockRo
 	}
 	return nil, nil
 }
+
+func (m *MockBlockReader) BlockByRoot(ctx context.Context, tx kv.Tx, blockRoot libcommon.Hash) (*cltypes.SignedBeaconBlock, error) {
+	return m.ReadBlockByRoot(ctx, tx, blockRoot)
+}
+
 func (m *MockBlockReader) ReadHeaderByRoot(ctx context.Context, tx kv.Tx, blockRoot libcommon.Hash) (*cltypes.SignedBeaconBlockHeader, error) {
 	block, err := m.ReadBlockByRoot(ctx, tx, blockRoot)
 	if err != nil {
@@ -2,6 +2,7 @@ package beacon_router_configuration
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
@@ -29,6 +30,19 @@ type RouterConfiguration struct {
 	Lighthouse bool
 }
 
+// ToRouterConfiguration returns the configuration a router is started with:
+// a copy of r, listening over tcp unless another protocol is set. Callers
+// should use it rather than copying fields, which would drop new ones.
+func (r RouterConfiguration) ToRouterConfiguration() RouterConfiguration {
+	cfg := r
+	if cfg.Protocol == "" {
+		cfg.Protocol = "tcp"
+	}
+	cfg.AllowedOrigins = slices.Clone(r.AllowedOrigins)
+	cfg.AllowedMethods = slices.Clone(r.AllowedMethods)
+	return cfg
+}
+
 func (r *RouterConfiguration) UnwrapEndpointsList(l []string) error {
 	r.Active = len(l) > 0
 	for _, v := range l {
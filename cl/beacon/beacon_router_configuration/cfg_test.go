@@ -0,0 +1,39 @@
+package beacon_router_configuration
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToRouterConfiguration(t *testing.T) {
+	// set every field, so that a field added without being carried over fails
+	var in RouterConfiguration
+	v := reflect.ValueOf(&in).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.String:
+			f.SetString(v.Type().Field(i).Name)
+		case reflect.Int64:
+			f.SetInt(int64(time.Duration(i+1) * time.Second))
+		case reflect.Slice:
+			f.Set(reflect.ValueOf([]string{v.Type().Field(i).Name}))
+		default:
+			t.Fatalf("field %s of kind %s isn't set by the test", v.Type().Field(i).Name, f.Kind())
+		}
+	}
+
+	out := in.ToRouterConfiguration()
+	require.Equal(t, in, out)
+
+	// the slices are copies
+	out.AllowedOrigins[0] = "changed"
+	require.Equal(t, "AllowedOrigins", in.AllowedOrigins[0])
+
+	require.Equal(t, "tcp", RouterConfiguration{}.ToRouterConfiguration().Protocol)
+}
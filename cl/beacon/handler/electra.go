@@ -16,118 +16,204 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 
 	"github.com/erigontech/erigon/cl/beacon/beaconhttp"
 	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/phase1/core/state"
 )
 
-// GetEthV1BeaconStatePendingDeposits returns pending deposits for a given state
-func (a *ApiHandler) GetEthV1BeaconStatePendingDeposits(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+// electraStateFromRequest resolves the {state_id} path param to a state and
+// checks that it is at least Electra, also reporting whether the state is
+// finalized. On failure it also returns the HTTP status to respond with. data
+// names what the request asks for, to explain why an older state is rejected.
+func (a *ApiHandler) electraStateFromRequest(r *http.Request, data string) (*state.CachingBeaconState, bool, int, error) {
 	ctx := r.Context()
 	tx, err := a.indiciesDB.BeginRo(ctx)
 	if err != nil {
-		return nil, err
+		return nil, false, http.StatusInternalServerError, err
 	}
 	defer tx.Rollback()
 
 	blockId, err := beaconhttp.StateIdFromRequest(r)
 	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, err)
+		return nil, false, http.StatusBadRequest, err
 	}
 
 	root, httpStatus, err := a.blockRootFromStateId(ctx, tx, blockId)
 	if err != nil {
-		return nil, beaconhttp.NewEndpointError(httpStatus, err)
+		return nil, false, httpStatus, err
 	}
 
-	state, err := a.forkchoiceStore.GetStateAtBlockRoot(root, true)
+	s, err := a.forkchoiceStore.GetStateAtBlockRoot(root, true)
 	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, err)
+		return nil, false, http.StatusNotFound, err
 	}
-	if state == nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, nil)
+	if s == nil {
+		return nil, false, http.StatusNotFound, fmt.Errorf("state not found for block root %x", root)
 	}
 
 	// Check if state supports Electra
-	if state.Version() < clparams.ElectraVersion {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, nil)
+	if s.Version() < clparams.ElectraVersion {
+		return nil, false, http.StatusBadRequest, fmt.Errorf("state at slot %d is %s, before electra; %s unavailable", s.Slot(), clparams.ClVersionToString(s.Version()), data)
 	}
 
-	// Return pending deposits from state
-	// Note: This requires adding a getter method to the state
-	return newBeaconResponse(nil).WithFinalized(false).WithVersion(state.Version()), nil
+	finalized, err := a.isFinalizedRoot(tx, root)
+	if err != nil {
+		return nil, false, http.StatusInternalServerError, err
+	}
+	return s, finalized, http.StatusOK, nil
 }
 
-// GetEthV1BeaconStatePendingPartialWithdrawals returns pending partial withdrawals for a given state
-func (a *ApiHandler) GetEthV1BeaconStatePendingPartialWithdrawals(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
-	ctx := r.Context()
-	tx, err := a.indiciesDB.BeginRo(ctx)
+// GetEthV1BeaconStatePendingDeposits returns pending deposits for a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingDeposits(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, "pending deposits")
 	if err != nil {
-		return nil, err
+		return nil, beaconhttp.NewEndpointError(httpStatus, err)
 	}
-	defer tx.Rollback()
 
-	blockId, err := beaconhttp.StateIdFromRequest(r)
+	// Return pending deposits from state
+	// Note: This requires adding a getter method to the state
+	return newBeaconResponse(nil).WithFinalized(finalized).WithVersion(state.Version()), nil
+}
+
+// GetEthV1BeaconStatePendingDepositByIndex returns a single pending deposit of a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingDepositByIndex(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	index, err := strconv.ParseUint(chi.URLParam(r, "index"), 10, 64)
 	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, err)
+		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, fmt.Errorf("invalid path variable: {index}: %w", err))
 	}
 
-	root, httpStatus, err := a.blockRootFromStateId(ctx, tx, blockId)
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, "pending deposits")
 	if err != nil {
 		return nil, beaconhttp.NewEndpointError(httpStatus, err)
 	}
 
-	state, err := a.forkchoiceStore.GetStateAtBlockRoot(root, true)
-	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, err)
-	}
-	if state == nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, nil)
+	deposits := state.PendingDeposits()
+	if index >= uint64(deposits.Len()) {
+		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, errors.New("pending deposit index out of range"))
 	}
+	return newBeaconResponse(deposits.Get(int(index))).WithFinalized(finalized).WithVersion(state.Version()), nil
+}
 
-	// Check if state supports Electra
-	if state.Version() < clparams.ElectraVersion {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, nil)
+// GetEthV1BeaconStatePendingPartialWithdrawals returns pending partial withdrawals for a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingPartialWithdrawals(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, "pending partial withdrawals")
+	if err != nil {
+		return nil, beaconhttp.NewEndpointError(httpStatus, err)
 	}
 
 	// Return pending partial withdrawals from state
-	return newBeaconResponse(nil).WithFinalized(false).WithVersion(state.Version()), nil
+	return newBeaconResponse(nil).WithFinalized(finalized).WithVersion(state.Version()), nil
 }
 
 // GetEthV1BeaconStatePendingConsolidations returns pending consolidations for a given state
 func (a *ApiHandler) GetEthV1BeaconStatePendingConsolidations(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
-	ctx := r.Context()
-	tx, err := a.indiciesDB.BeginRo(ctx)
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, "pending consolidations")
 	if err != nil {
-		return nil, err
+		return nil, beaconhttp.NewEndpointError(httpStatus, err)
 	}
-	defer tx.Rollback()
 
-	blockId, err := beaconhttp.StateIdFromRequest(r)
-	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, err)
-	}
+	// Return pending consolidations from state
+	return newBeaconResponse(nil).WithFinalized(finalized).WithVersion(state.Version()), nil
+}
 
-	root, httpStatus, err := a.blockRootFromStateId(ctx, tx, blockId)
+// pendingListRoot responds with the hash_tree_root of a pending list of the
+// requested state, which is much cheaper than encoding all of its entries
+func (a *ApiHandler) pendingListRoot(r *http.Request, data string, hashList func(s *state.CachingBeaconState) ([32]byte, error)) (*beaconhttp.BeaconResponse, error) {
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, data)
 	if err != nil {
 		return nil, beaconhttp.NewEndpointError(httpStatus, err)
 	}
 
-	state, err := a.forkchoiceStore.GetStateAtBlockRoot(root, true)
+	root, err := hashList(state)
 	if err != nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, err)
-	}
-	if state == nil {
-		return nil, beaconhttp.NewEndpointError(http.StatusNotFound, nil)
+		return nil, beaconhttp.NewEndpointError(http.StatusInternalServerError, err)
 	}
+	return newBeaconResponse(&rootResponse{Root: root}).WithFinalized(finalized).WithVersion(state.Version()), nil
+}
 
-	// Check if state supports Electra
-	if state.Version() < clparams.ElectraVersion {
-		return nil, beaconhttp.NewEndpointError(http.StatusBadRequest, nil)
-	}
+// GetEthV1BeaconStatePendingDepositsRoot returns the root of the pending deposits list of a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingDepositsRoot(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	return a.pendingListRoot(r, "pending deposits", func(s *state.CachingBeaconState) ([32]byte, error) {
+		return s.PendingDeposits().HashSSZ()
+	})
+}
 
-	// Return pending consolidations from state
-	return newBeaconResponse(nil).WithFinalized(false).WithVersion(state.Version()), nil
+// GetEthV1BeaconStatePendingPartialWithdrawalsRoot returns the root of the pending partial withdrawals list of a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingPartialWithdrawalsRoot(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	return a.pendingListRoot(r, "pending partial withdrawals", func(s *state.CachingBeaconState) ([32]byte, error) {
+		return s.PendingPartialWithdrawals().HashSSZ()
+	})
+}
+
+// GetEthV1BeaconStatePendingConsolidationsRoot returns the root of the pending consolidations list of a given state
+func (a *ApiHandler) GetEthV1BeaconStatePendingConsolidationsRoot(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	return a.pendingListRoot(r, "pending consolidations", func(s *state.CachingBeaconState) ([32]byte, error) {
+		return s.PendingConsolidations().HashSSZ()
+	})
+}
+
+// electraQueueSummary aggregates the Electra pending queues of a state, with
+// amounts in Gwei. Consolidations are weighed by the effective balance of
+// their source validator.
+type electraQueueSummary struct {
+	PendingDeposits                 uint64 `json:"pending_deposits,string"`
+	PendingDepositsAmount           uint64 `json:"pending_deposits_amount,string"`
+	PendingPartialWithdrawals       uint64 `json:"pending_partial_withdrawals,string"`
+	PendingPartialWithdrawalsAmount uint64 `json:"pending_partial_withdrawals_amount,string"`
+	PendingConsolidations           uint64 `json:"pending_consolidations,string"`
+	PendingConsolidationsAmount     uint64 `json:"pending_consolidations_amount,string"`
+	ActivationExitChurnLimit        uint64 `json:"activation_exit_churn_limit,string"`
+	ConsolidationChurnLimit         uint64 `json:"consolidation_churn_limit,string"`
+}
+
+func newElectraQueueSummary(s *state.CachingBeaconState) (*electraQueueSummary, error) {
+	summary := &electraQueueSummary{
+		ActivationExitChurnLimit: s.GetActivationExitChurnLimit(),
+		ConsolidationChurnLimit:  s.GetConsolidationChurnLimit(),
+	}
+	s.PendingDeposits().Range(func(_ int, deposit *cltypes.PendingDeposit, _ int) bool {
+		summary.PendingDeposits++
+		summary.PendingDepositsAmount += deposit.Amount
+		return true
+	})
+	s.PendingPartialWithdrawals().Range(func(_ int, withdrawal *cltypes.PendingPartialWithdrawal, _ int) bool {
+		summary.PendingPartialWithdrawals++
+		summary.PendingPartialWithdrawalsAmount += withdrawal.Amount
+		return true
+	})
+	var err error
+	s.PendingConsolidations().Range(func(_ int, consolidation *cltypes.PendingConsolidation, _ int) bool {
+		var balance uint64
+		if balance, err = s.ValidatorEffectiveBalance(int(consolidation.SourceIndex)); err != nil {
+			return false
+		}
+		summary.PendingConsolidations++
+		summary.PendingConsolidationsAmount += balance
+		return true
+	})
+	return summary, err
 }
 
+// GetEthV1BeaconStateElectraQueueSummary returns the counts and total amounts
+// of the pending deposits, partial withdrawals and consolidations of a given
+// state, along with its current churn limits
+func (a *ApiHandler) GetEthV1BeaconStateElectraQueueSummary(w http.ResponseWriter, r *http.Request) (*beaconhttp.BeaconResponse, error) {
+	state, finalized, httpStatus, err := a.electraStateFromRequest(r, "pending queues")
+	if err != nil {
+		return nil, beaconhttp.NewEndpointError(httpStatus, err)
+	}
+
+	summary, err := newElectraQueueSummary(state)
+	if err != nil {
+		return nil, beaconhttp.NewEndpointError(http.StatusInternalServerError, err)
+	}
+	return newBeaconResponse(summary).WithFinalized(finalized).WithVersion(state.Version()), nil
+}
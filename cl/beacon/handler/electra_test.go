@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
+)
+
+func TestGetEthV1BeaconStatePendingDepositByIndex(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+
+	server := httptest.NewServer(handler.mux)
+	defer server.Close()
+
+	get := func(index string) *http.Response {
+		resp, err := http.Get(server.URL + "/eth/v1/beacon/states/head/pending_deposits/" + index)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// pre-electra state
+	require.Equal(t, http.StatusBadRequest, get("0").StatusCode)
+
+	postState.SetVersion(clparams.ElectraVersion)
+	postState.AddPendingDeposit(&cltypes.PendingDeposit{Amount: 32_000_000_000, Slot: 7})
+
+	resp := get("0")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Data    cltypes.PendingDeposit `json:"data"`
+		Version string                 `json:"version"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, uint64(32_000_000_000), body.Data.Amount)
+	require.Equal(t, uint64(7), body.Data.Slot)
+	require.Equal(t, "electra", body.Version)
+
+	require.Equal(t, http.StatusNotFound, get("1").StatusCode)
+	require.Equal(t, http.StatusBadRequest, get("first").StatusCode)
+}
+
+func TestElectraStateFromRequest(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+
+	request := func(stateId string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("state_id", stateId)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	_, _, status, err := handler.electraStateFromRequest(request("latest"), "pending deposits")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	// no state known for the head root
+	_, _, status, err = handler.electraStateFromRequest(request("head"), "pending deposits")
+	require.Error(t, err)
+	require.Equal(t, http.StatusNotFound, status)
+
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+	_, _, status, err = handler.electraStateFromRequest(request("head"), "pending deposits")
+	require.ErrorContains(t, err, "before electra")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	postState.SetVersion(clparams.ElectraVersion)
+	s, finalized, status, err := handler.electraStateFromRequest(request("head"), "pending deposits")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Same(t, postState, s)
+	require.False(t, finalized)
+}
+
+func TestElectraEndpointsPreElectraState(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+
+	server := httptest.NewServer(handler.mux)
+	defer server.Close()
+
+	for path, data := range map[string]string{
+		"pending_deposits":            "pending deposits",
+		"pending_partial_withdrawals": "pending partial withdrawals",
+		"pending_consolidations":      "pending consolidations",
+	} {
+		resp, err := http.Get(server.URL + "/eth/v1/beacon/states/head/" + path)
+		require.NoError(t, err)
+		var body struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		require.Equal(t, "state at slot "+strconv.FormatUint(postState.Slot(), 10)+" is phase0, before electra; "+data+" unavailable", body.Message, path)
+	}
+}
+
+func TestGetEthV1BeaconStateElectraQueueSummary(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+
+	postState.SetVersion(clparams.ElectraVersion)
+	postState.AddPendingDeposit(&cltypes.PendingDeposit{Amount: 32_000_000_000})
+	postState.AddPendingDeposit(&cltypes.PendingDeposit{Amount: 1_000_000_000})
+	postState.AddPendingPartialWithdrawal(&cltypes.PendingPartialWithdrawal{Index: 3, Amount: 500_000_000})
+	postState.AddPendingConsolidation(&cltypes.PendingConsolidation{SourceIndex: 1, TargetIndex: 2})
+	sourceBalance, err := postState.ValidatorEffectiveBalance(1)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(handler.mux)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/eth/v1/beacon/states/head/electra_queue_summary")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data electraQueueSummary `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	cfg := postState.BeaconConfig()
+	balanceChurn := max(cfg.MinPerEpochChurnLimitElectra, postState.GetTotalActiveBalance()/cfg.ChurnLimitQuotient)
+	balanceChurn -= balanceChurn % cfg.EffectiveBalanceIncrement
+	activationExitChurn := min(cfg.MaxPerEpochActivationExitChurnLimit, balanceChurn)
+	require.Equal(t, electraQueueSummary{
+		PendingDeposits:                 2,
+		PendingDepositsAmount:           33_000_000_000,
+		PendingPartialWithdrawals:       1,
+		PendingPartialWithdrawalsAmount: 500_000_000,
+		PendingConsolidations:           1,
+		PendingConsolidationsAmount:     sourceBalance,
+		ActivationExitChurnLimit:        activationExitChurn,
+		ConsolidationChurnLimit:         balanceChurn - activationExitChurn,
+	}, body.Data)
+}
+
+func TestGetEthV1BeaconStatePendingListRoots(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+
+	postState.SetVersion(clparams.ElectraVersion)
+	for i := uint64(0); i < 10; i++ {
+		postState.AddPendingDeposit(&cltypes.PendingDeposit{Amount: 1_000_000_000 * (i + 1), Slot: i})
+		postState.AddPendingPartialWithdrawal(&cltypes.PendingPartialWithdrawal{Index: i, Amount: i + 1})
+		postState.AddPendingConsolidation(&cltypes.PendingConsolidation{SourceIndex: i, TargetIndex: i + 1})
+	}
+	cfg := postState.BeaconConfig()
+
+	server := httptest.NewServer(handler.mux)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path string
+		list interface {
+			EncodeSSZ(buf []byte) ([]byte, error)
+		}
+		full interface {
+			DecodeSSZ(buf []byte, version int) error
+			HashSSZ() ([32]byte, error)
+		}
+	}{
+		{"pending_deposits", postState.PendingDeposits(), solid.NewStaticListSSZ[*cltypes.PendingDeposit](int(cfg.PendingDepositsLimit), 192)},
+		{"pending_partial_withdrawals", postState.PendingPartialWithdrawals(), solid.NewStaticListSSZ[*cltypes.PendingPartialWithdrawal](int(cfg.PendingPartialWithdrawalsLimit), 24)},
+		{"pending_consolidations", postState.PendingConsolidations(), solid.NewStaticListSSZ[*cltypes.PendingConsolidation](int(cfg.PendingConsolidationsLimit), 16)},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			// the root of the list decoded in full from its encoding
+			encoded, err := tc.list.EncodeSSZ(nil)
+			require.NoError(t, err)
+			require.NoError(t, tc.full.DecodeSSZ(encoded, int(clparams.ElectraVersion)))
+			expected, err := tc.full.HashSSZ()
+			require.NoError(t, err)
+
+			resp, err := http.Get(server.URL + "/eth/v1/beacon/states/head/" + tc.path + "/root")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var body struct {
+				Data    rootResponse `json:"data"`
+				Version string       `json:"version"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Equal(t, libcommon.Hash(expected), body.Data.Root)
+			require.Equal(t, "electra", body.Version)
+		})
+	}
+}
+
+func TestElectraStateFinalized(t *testing.T) {
+	_, blocks, _, _, postState, handler, _, _, fcu, _ := setupTestingHandler(t, clparams.Phase0Version, log.Root())
+
+	var err error
+	fcu.HeadVal, err = blocks[len(blocks)-1].Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.HeadSlotVal = blocks[len(blocks)-1].Block.Slot
+	historical := blocks[0]
+	historicalRoot, err := historical.Block.HashSSZ()
+	require.NoError(t, err)
+	fcu.StateAtBlockRootVal[fcu.HeadVal] = postState
+	fcu.StateAtBlockRootVal[historicalRoot] = postState
+	fcu.FinalizedSlotVal = historical.Block.Slot
+	postState.SetVersion(clparams.ElectraVersion)
+
+	server := httptest.NewServer(handler.mux)
+	defer server.Close()
+
+	finalized := func(stateId string) bool {
+		resp, err := http.Get(server.URL + "/eth/v1/beacon/states/" + stateId + "/electra_queue_summary")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Finalized bool `json:"finalized"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body.Finalized
+	}
+
+	require.True(t, finalized(strconv.FormatUint(historical.Block.Slot, 10)))
+	require.False(t, finalized("head"))
+
+	// the head is finalized once the fork choice finalizes its slot
+	fcu.FinalizedSlotVal = fcu.HeadSlotVal
+	require.True(t, finalized("head"))
+}
@@ -260,8 +260,13 @@ func (a *ApiHandler) init() {
 							r.Get("/validators/{validator_id}", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatesValidator))
 							// Electra endpoints
 							r.Get("/pending_deposits", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingDeposits))
+							r.Get("/pending_deposits/root", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingDepositsRoot))
+							r.Get("/pending_deposits/{index}", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingDepositByIndex))
 							r.Get("/pending_partial_withdrawals", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingPartialWithdrawals))
+							r.Get("/pending_partial_withdrawals/root", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingPartialWithdrawalsRoot))
 							r.Get("/pending_consolidations", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingConsolidations))
+							r.Get("/pending_consolidations/root", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStatePendingConsolidationsRoot))
+							r.Get("/electra_queue_summary", beaconhttp.HandleEndpointFunc(a.GetEthV1BeaconStateElectraQueueSummary))
 						})
 					})
 				})
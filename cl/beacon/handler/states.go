@@ -60,6 +60,20 @@ func (a *ApiHandler) blockRootFromStateId(ctx context.Context, tx kv.Tx, stateId
 	}
 }
 
+// isFinalizedRoot reports whether the block at root is canonical and at or
+// before the fork choice's finalized slot
+func (a *ApiHandler) isFinalizedRoot(tx kv.Tx, root libcommon.Hash) (bool, error) {
+	slot, err := beacon_indicies.ReadBlockSlotByBlockRoot(tx, root)
+	if err != nil || slot == nil {
+		return false, err
+	}
+	canonicalRoot, err := beacon_indicies.ReadCanonicalBlockRoot(tx, *slot)
+	if err != nil {
+		return false, err
+	}
+	return canonicalRoot == root && *slot <= a.forkchoiceStore.FinalizedSlot(), nil
+}
+
 type rootResponse struct {
 	Root libcommon.Hash `json:"root"`
 }
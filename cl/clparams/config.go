@@ -35,6 +35,14 @@ type CaplinConfig struct {
 	BlobBackfilling     bool
 	BlobPruningDisabled bool
 	Archive             bool
+	// SkipWeakSubjectivityCheck accepts checkpoint states older than the weak subjectivity period
+	SkipWeakSubjectivityCheck bool
+	// CheckpointSyncAttempts is how many times all checkpoint sync endpoints
+	// are tried before starting from genesis, 3 if zero
+	CheckpointSyncAttempts int
+	// CheckpointSyncBackoff is the wait before the second attempt, doubled
+	// for every further one, 5s if zero
+	CheckpointSyncBackoff time.Duration
 }
 
 type NetworkType int
@@ -20,8 +20,16 @@ import (
 
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/types/clonable"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
 	"github.com/erigontech/erigon/cl/merkle_tree"
 	ssz2 "github.com/erigontech/erigon/cl/ssz"
+	"github.com/erigontech/erigon/core/types"
+)
+
+const (
+	MaxDepositRequestsPerPayload       = 8192
+	MaxWithdrawalRequestsPerPayload    = 16
+	MaxConsolidationRequestsPerPayload = 2
 )
 
 // PendingDeposit represents a pending deposit in Electra
@@ -232,3 +240,75 @@ func (c *ConsolidationRequest) Clone() clonable.Clonable {
 	}
 }
 
+// ExecutionRequests are the execution layer requests of an Electra beacon
+// block body, committed to by the requests hash of its execution payload
+type ExecutionRequests struct {
+	Deposits       *solid.ListSSZ[*DepositRequest]       `json:"deposits"`
+	Withdrawals    *solid.ListSSZ[*WithdrawalRequest]    `json:"withdrawals"`
+	Consolidations *solid.ListSSZ[*ConsolidationRequest] `json:"consolidations"`
+}
+
+func NewExecutionRequests() *ExecutionRequests {
+	return &ExecutionRequests{
+		Deposits:       solid.NewStaticListSSZ[*DepositRequest](MaxDepositRequestsPerPayload, 192),
+		Withdrawals:    solid.NewStaticListSSZ[*WithdrawalRequest](MaxWithdrawalRequestsPerPayload, 76),
+		Consolidations: solid.NewStaticListSSZ[*ConsolidationRequest](MaxConsolidationRequestsPerPayload, 116),
+	}
+}
+
+func (e *ExecutionRequests) EncodeSSZ(buf []byte) ([]byte, error) {
+	return ssz2.MarshalSSZ(buf, e.Deposits, e.Withdrawals, e.Consolidations)
+}
+
+func (e *ExecutionRequests) DecodeSSZ(buf []byte, version int) error {
+	*e = *NewExecutionRequests()
+	return ssz2.UnmarshalSSZ(buf, version, e.Deposits, e.Withdrawals, e.Consolidations)
+}
+
+func (e *ExecutionRequests) EncodingSizeSSZ() int {
+	return 12 + e.Deposits.EncodingSizeSSZ() + e.Withdrawals.EncodingSizeSSZ() + e.Consolidations.EncodingSizeSSZ()
+}
+
+func (e *ExecutionRequests) HashSSZ() ([32]byte, error) {
+	return merkle_tree.HashTreeRoot(e.Deposits, e.Withdrawals, e.Consolidations)
+}
+
+func (*ExecutionRequests) Static() bool {
+	return false
+}
+
+func (e *ExecutionRequests) Clone() clonable.Clonable {
+	return NewExecutionRequests()
+}
+
+// EngineRequests returns the requests in the form passed to the execution
+// engine: for each type with requests, in increasing type order, the type
+// byte followed by the SSZ encoding of the requests of that type. A nil
+// *ExecutionRequests has no requests.
+func (e *ExecutionRequests) EngineRequests() ([][]byte, error) {
+	requests := make([][]byte, 0, len(types.KnownRequestTypes))
+	if e == nil {
+		return requests, nil
+	}
+	for _, r := range []struct {
+		typ  byte
+		list interface {
+			Len() int
+			EncodeSSZ([]byte) ([]byte, error)
+		}
+	}{
+		{types.DepositRequestType, e.Deposits},
+		{types.WithdrawalRequestType, e.Withdrawals},
+		{types.ConsolidationRequestType, e.Consolidations},
+	} {
+		if r.list.Len() == 0 {
+			continue
+		}
+		encoded, err := r.list.EncodeSSZ([]byte{r.typ})
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, encoded)
+	}
+	return requests, nil
+}
@@ -0,0 +1,81 @@
+package cltypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
+	"github.com/erigontech/erigon/core/types"
+)
+
+func TestExecutionRequestsBeaconBody(t *testing.T) {
+	requests := NewExecutionRequests()
+	requests.Deposits.Append(&DepositRequest{Pubkey: libcommon.Bytes48{0x01}, Amount: 32_000_000_000, Index: 7})
+	requests.Consolidations.Append(&ConsolidationRequest{SourceAddress: libcommon.Address{0x02}, TargetPubkey: libcommon.Bytes48{0x03}})
+
+	// types without requests are left out
+	engineRequests, err := requests.EngineRequests()
+	require.NoError(t, err)
+	require.Len(t, engineRequests, 2)
+	deposit, err := requests.Deposits.Get(0).EncodeSSZ([]byte{types.DepositRequestType})
+	require.NoError(t, err)
+	require.Equal(t, deposit, engineRequests[0])
+	consolidation, err := requests.Consolidations.Get(0).EncodeSSZ([]byte{types.ConsolidationRequestType})
+	require.NoError(t, err)
+	require.Equal(t, consolidation, engineRequests[1])
+	for _, none := range []*ExecutionRequests{NewExecutionRequests(), nil} {
+		engineRequests, err := none.EngineRequests()
+		require.NoError(t, err)
+		require.NotNil(t, engineRequests)
+		require.Empty(t, engineRequests)
+	}
+
+	body := func(version clparams.StateVersion) *BeaconBody {
+		b := NewBeaconBody(&clparams.MainnetBeaconConfig)
+		b.Version = version
+		b.SyncAggregate = &SyncAggregate{}
+		b.ExecutionPayload = NewEth1Block(version, &clparams.MainnetBeaconConfig)
+		b.ExecutionPayload.Extra = solid.NewExtraData()
+		b.ExecutionPayload.Transactions = solid.NewTransactionsSSZFromTransactions(nil)
+		b.ExecutionPayload.Withdrawals = solid.NewStaticListSSZ[*Withdrawal](int(clparams.MainnetBeaconConfig.MaxWithdrawalsPerPayload), 44)
+		b.ExecutionRequests = requests
+		return b
+	}
+
+	// the requests are part of Electra bodies only
+	electra := body(clparams.ElectraVersion)
+	encoded, err := electra.EncodeSSZ(nil)
+	require.NoError(t, err)
+	decoded := NewBeaconBody(&clparams.MainnetBeaconConfig)
+	require.NoError(t, decoded.DecodeSSZ(encoded, int(clparams.ElectraVersion)))
+	decodedRequests, err := decoded.ExecutionRequests.EngineRequests()
+	require.NoError(t, err)
+	require.Equal(t, engineRequests, decodedRequests)
+	root, err := electra.HashSSZ()
+	require.NoError(t, err)
+	decodedRoot, err := decoded.HashSSZ()
+	require.NoError(t, err)
+	require.Equal(t, root, decodedRoot)
+
+	// the blinded body commits to the same requests
+	blinded, err := electra.Blinded()
+	require.NoError(t, err)
+	require.Same(t, electra.ExecutionRequests, blinded.ExecutionRequests)
+	blindedRoot, err := blinded.HashSSZ()
+	require.NoError(t, err)
+	blinded.ExecutionRequests = NewExecutionRequests()
+	withoutRequestsRoot, err := blinded.HashSSZ()
+	require.NoError(t, err)
+	require.NotEqual(t, blindedRoot, withoutRequestsRoot)
+
+	deneb := body(clparams.DenebVersion)
+	withRequests, err := deneb.EncodeSSZ(nil)
+	require.NoError(t, err)
+	deneb.ExecutionRequests = NewExecutionRequests()
+	withoutRequests, err := deneb.EncodeSSZ(nil)
+	require.NoError(t, err)
+	require.Equal(t, withoutRequests, withRequests)
+}
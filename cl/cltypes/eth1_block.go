@@ -285,7 +285,9 @@ func (b *Eth1Block) getSchema() []interface{} {
 }
 
 // RlpHeader returns the equivalent types.Header struct with RLP-based fields.
-func (b *Eth1Block) RlpHeader(parentRoot *libcommon.Hash) (*types.Header, error) {
+// requestsHash is the EIP-7685 commitment to the execution requests of the
+// payload, part of the header from Electra on and ignored before.
+func (b *Eth1Block) RlpHeader(parentRoot *libcommon.Hash, requestsHash *libcommon.Hash) (*types.Header, error) {
 	// Reverse the order of the bytes in the BaseFeePerGas array and convert it to a big integer.
 	reversedBaseFeePerGas := libcommon.Copy(b.BaseFeePerGas[:])
 	for i, j := 0, len(reversedBaseFeePerGas)-1; i < j; i, j = i+1, j-1 {
@@ -335,6 +337,9 @@ func (b *Eth1Block) RlpHeader(parentRoot *libcommon.Hash) (*types.Header, error)
 		excessBlobGas := b.ExcessBlobGas
 		header.ExcessBlobGas = &excessBlobGas
 	}
+	if b.version >= clparams.ElectraVersion {
+		header.RequestsHash = requestsHash
+	}
 
 	// If the header hash does not match the block hash, return an error.
 	if header.Hash() != b.BlockHash {
@@ -88,15 +88,19 @@ func (arr *byteBasedUint64Slice) MarshalJSON() ([]byte, error) {
 }
 
 func (arr *byteBasedUint64Slice) UnmarshalJSON(buf []byte) error {
-	var list []uint64
+	// elements may be quoted, as produced by MarshalJSON and the beacon API
+	var list []json.Number
 
 	if err := json.Unmarshal(buf, &list); err != nil {
 		return err
 	}
 	arr.Clear()
-	arr.l = len(list)
 	for _, elem := range list {
-		arr.Append(elem)
+		v, err := strconv.ParseUint(elem.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		arr.Append(v)
 	}
 	return nil
 }
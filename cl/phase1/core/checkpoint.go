@@ -3,18 +3,72 @@ package core
 import (
 	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/erigontech/erigon/cl/cltypes"
 	"github.com/erigontech/erigon/cl/phase1/core/state"
 
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/metrics"
 	"github.com/erigontech/erigon/cl/clparams"
 )
 
+var (
+	// CheckpointBlockTimeout bounds a single checkpoint block request, on top of
+	// any deadline of the caller's context
+	CheckpointBlockTimeout = 30 * time.Second
+	// MaxCheckpointBlockSize is the largest checkpoint block response accepted,
+	// in bytes. It defaults to the bellatrix gossip limit.
+	MaxCheckpointBlockSize int64 = 10 << 20
+	// CheckpointStateAttempts is how many times a checkpoint state download is
+	// tried, each retry resuming from the bytes already received
+	CheckpointStateAttempts = 3
+)
+
+// minCheckpointBlockSize is the smallest encoding holding a block slot
+const minCheckpointBlockSize = 108
+
+// CheckpointRequestOptions holds optional headers of checkpoint sync requests,
+// for providers gating their endpoints. A nil *CheckpointRequestOptions keeps
+// the default headers.
+type CheckpointRequestOptions struct {
+	// Accept replaces the default Accept header
+	Accept string
+	// Authorization is sent as the Authorization header, e.g. "Bearer <token>"
+	Authorization string
+	// Header holds any other headers to send
+	Header http.Header
+}
+
+// apply sets the optional headers on req, overriding its defaults
+func (o *CheckpointRequestOptions) apply(req *http.Request) {
+	if o == nil {
+		return
+	}
+	for key, values := range o.Header {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if o.Accept != "" {
+		req.Header.Set("Accept", o.Accept)
+	}
+	if o.Authorization != "" {
+		req.Header.Set("Authorization", o.Authorization)
+	}
+}
+
 func extractSlotFromSerializedBeaconState(beaconState []byte) (uint64, error) {
 	if len(beaconState) < 48 {
 		return 0, fmt.Errorf("checkpoint sync read failed, too short")
@@ -29,12 +83,15 @@ func extractForkVersionFromSerializedBeaconState(beaconState []byte) (uint32, er
 	if len(beaconState) < 56 {
 		return 0, fmt.Errorf("checkpoint sync read failed, too short for fork version")
 	}
-	return binary.LittleEndian.Uint32(beaconState[52:56]), nil
+	// fork versions are serialized as big-endian Bytes4, see utils.Uint32ToBytes4
+	return binary.BigEndian.Uint32(beaconState[52:56]), nil
 }
 
 // getVersionFromForkVersion determines the state version from the fork version
 func getVersionFromForkVersion(beaconConfig *clparams.BeaconChainConfig, forkVersion uint32) clparams.StateVersion {
 	switch forkVersion {
+	case uint32(beaconConfig.FuluForkVersion):
+		return clparams.FuluVersion
 	case uint32(beaconConfig.ElectraForkVersion):
 		return clparams.ElectraVersion
 	case uint32(beaconConfig.DenebForkVersion):
@@ -50,35 +107,225 @@ func getVersionFromForkVersion(beaconConfig *clparams.BeaconChainConfig, forkVer
 	}
 }
 
-func RetrieveBeaconState(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, uri string) (*state.CachingBeaconState, error) {
+// RetrieveBeaconState downloads the checkpoint state at uri and decodes it.
+// Decoding starts once the download is complete: BeaconState.DecodeSSZ needs
+// the whole encoding, whose variable size fields are only located through the
+// offsets of the fixed part.
+func RetrieveBeaconState(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, uri string, opts *CheckpointRequestOptions) (*state.CachingBeaconState, error) {
 	log.Info("[Checkpoint Sync] Requesting beacon state", "uri", uri)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	start := time.Now()
+	marshaled, contentType, err := downloadCheckpointState(ctx, uri, opts)
 	if err != nil {
 		return nil, err
 	}
+	observeCheckpointStateDownload(start, int64(len(marshaled)))
 
-	req.Header.Set("Accept", "application/octet-stream")
-	if err != nil {
-		return nil, fmt.Errorf("checkpoint sync request failed %s", err)
+	return logRetrievedState(decodeCheckpointState(beaconConfig, contentType, marshaled))
+}
+
+var (
+	checkpointStateDownloadTimer = metrics.GetOrCreateHistogram("checkpoint_sync_state_download_seconds")
+	checkpointStateBytesGauge    = metrics.GetOrCreateGauge("checkpoint_sync_state_bytes")
+	checkpointStateDecodeTimer   = metrics.GetOrCreateHistogram("checkpoint_sync_state_decode_seconds")
+	checkpointStateVersionGauge  = metrics.GetOrCreateGauge("checkpoint_sync_state_version")
+)
+
+// observeCheckpointStateDownload records a state download of size bytes that
+// started at start
+func observeCheckpointStateDownload(start time.Time, size int64) {
+	checkpointStateDownloadTimer.ObserveDuration(start)
+	checkpointStateBytesGauge.SetInt(int(size))
+}
+
+// decodeCheckpointState decodes a downloaded state of the given content type,
+// recording the decoding duration
+func decodeCheckpointState(beaconConfig *clparams.BeaconChainConfig, contentType string, marshaled []byte) (*state.CachingBeaconState, error) {
+	defer checkpointStateDecodeTimer.ObserveDuration(time.Now())
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		return decodeJSONBeaconState(beaconConfig, marshaled)
 	}
-	r, err := http.DefaultClient.Do(req)
+	return decodeSSZBeaconState(beaconConfig, marshaled)
+}
+
+func logRetrievedState(beaconState *state.CachingBeaconState, err error) (*state.CachingBeaconState, error) {
 	if err != nil {
 		return nil, err
 	}
+	checkpointStateVersionGauge.SetUint64(uint64(beaconState.Version()))
+	log.Info("[Checkpoint Sync] Beacon state retrieved", "slot", beaconState.Slot(), "version", clparams.ClVersionToString(beaconState.Version()))
+	return beaconState, nil
+}
+
+var errCheckpointStatus = errors.New("checkpoint sync failed, bad status code")
+
+var (
+	// ErrCheckpointBlockNotFound is returned by RetrieveBlock when the endpoint
+	// has no block, e.g. at a skipped slot
+	ErrCheckpointBlockNotFound = errors.New("checkpoint sync failed, block not found")
+	// ErrUnexpectedBlockRoot is returned by RetrieveBlock when the block doesn't
+	// have the expected root
+	ErrUnexpectedBlockRoot = errors.New("checkpoint sync decode failed, unexpected block root")
+)
+
+// partialDownload is a checkpoint state download spooled to a temporary file,
+// so that it can be resumed with a Range request after a dropped connection
+type partialDownload struct {
+	file        *os.File
+	received    int64
+	total       int64 // -1 while unknown
+	contentType string
+	opts        *CheckpointRequestOptions
+}
+
+// downloadCheckpointState downloads the state at uri, retrying up to
+// CheckpointStateAttempts times from where the previous attempt stopped, and
+// returns it together with its content type
+func downloadCheckpointState(ctx context.Context, uri string, opts *CheckpointRequestOptions) ([]byte, string, error) {
+	file, err := os.CreateTemp("", "checkpoint-state-*")
+	if err != nil {
+		return nil, "", err
+	}
 	defer func() {
-		err = r.Body.Close()
+		file.Close()
+		os.Remove(file.Name())
 	}()
-	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("checkpoint sync failed, bad status code %d", r.StatusCode)
+
+	d := &partialDownload{file: file, total: -1, opts: opts}
+	for attempt := 1; ; attempt++ {
+		err = d.resume(ctx, uri)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errCheckpointStatus) || ctx.Err() != nil || attempt >= CheckpointStateAttempts {
+			return nil, "", err
+		}
+		log.Warn("[Checkpoint Sync] Beacon state download interrupted, resuming", "received", d.received, "attempt", attempt, "err", err)
+	}
+	if d.total >= 0 && d.received != d.total {
+		return nil, "", fmt.Errorf("checkpoint sync read failed, got %d of %d bytes", d.received, d.total)
 	}
-	marshaled, err := io.ReadAll(r.Body)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	marshaled, err := io.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("checkpoint sync read failed %s", err)
+		return nil, "", fmt.Errorf("checkpoint sync read failed %s", err)
+	}
+	return marshaled, d.contentType, nil
+}
+
+// resume requests the bytes not received yet and appends them to the file
+func (d *partialDownload) resume(ctx context.Context, uri string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	// prefer SSZ, but accept providers that only serve JSON
+	req.Header.Set("Accept", "application/octet-stream, application/json;q=0.9")
+	d.opts.apply(req)
+	// byte offsets must refer to the body as sent, so no transparent gzip
+	req.Header.Set("Accept-Encoding", "identity")
+	if d.received > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.received))
+	}
+	r, err := CheckpointHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	defer closeOnDone(ctx, r.Body)()
+
+	switch r.StatusCode {
+	case http.StatusOK:
+		// a full response, either the first one or from a server ignoring Range
+		if err := d.file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		d.received, d.total = 0, r.ContentLength
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(r.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != d.received {
+			return fmt.Errorf("checkpoint sync failed, range starts at %d instead of %d", start, d.received)
+		}
+		d.total = total
+	default:
+		return fmt.Errorf("%w %d", errCheckpointStatus, r.StatusCode)
+	}
+	d.contentType = r.Header.Get("Content-Type")
+	n, err := io.Copy(d.file, r.Body)
+	d.received += n
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
+}
+
+// closeOnDone closes body once ctx is done, so that a read stalled on the
+// connection returns promptly. The returned function stops watching ctx.
+func closeOnDone(ctx context.Context, body io.Closer) func() bool {
+	return context.AfterFunc(ctx, func() { body.Close() })
+}
 
+// parseContentRange parses a "bytes start-end/total" Content-Range header. An
+// unknown total ("*") is returned as -1.
+func parseContentRange(header string) (start, total int64, err error) {
+	rng, size, ok := strings.Cut(strings.TrimPrefix(header, "bytes "), "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("checkpoint sync failed, invalid Content-Range %q", header)
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("checkpoint sync failed, invalid Content-Range %q", header)
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("checkpoint sync failed, invalid Content-Range %q", header)
+	}
+	if size == "*" {
+		return start, -1, nil
+	}
+	if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("checkpoint sync failed, invalid Content-Range %q", header)
+	}
+	return start, total, nil
+}
+
+// beaconStateJSON is the beacon API envelope of a JSON-encoded state
+type beaconStateJSON struct {
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func decodeJSONBeaconState(beaconConfig *clparams.BeaconChainConfig, marshaled []byte) (*state.CachingBeaconState, error) {
+	var envelope beaconStateJSON
+	if err := json.Unmarshal(marshaled, &envelope); err != nil {
+		return nil, fmt.Errorf("checkpoint sync decode failed %s", err)
+	}
+	if len(envelope.Data) == 0 {
+		return nil, fmt.Errorf("checkpoint sync decode failed, missing state data")
+	}
+	version, err := clparams.StringToClVersion(envelope.Version)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint sync decode failed %s", err)
+	}
+	beaconState := state.New(beaconConfig)
+	beaconState.SetVersion(version)
+	if err := beaconState.UnmarshalJSON(envelope.Data); err != nil {
+		return nil, fmt.Errorf("checkpoint sync decode failed %s", err)
+	}
+	return beaconState, nil
+}
+
+// sszBeaconStateVersion detects the version of an SSZ state from its start
+func sszBeaconStateVersion(beaconConfig *clparams.BeaconChainConfig, marshaled []byte) (clparams.StateVersion, error) {
 	slot, err := extractSlotFromSerializedBeaconState(marshaled)
 	if err != nil {
-		return nil, fmt.Errorf("checkpoint sync read failed %s", err)
+		return 0, fmt.Errorf("checkpoint sync read failed %s", err)
 	}
 
 	// Try to detect version from fork version in the beacon state itself
@@ -94,52 +341,72 @@ func RetrieveBeaconState(ctx context.Context, beaconConfig *clparams.BeaconChain
 		epoch := slot / beaconConfig.SlotsPerEpoch
 		version = beaconConfig.GetCurrentStateVersion(epoch)
 	}
+	return version, nil
+}
+
+func decodeSSZBeaconState(beaconConfig *clparams.BeaconChainConfig, marshaled []byte) (*state.CachingBeaconState, error) {
+	version, err := sszBeaconStateVersion(beaconConfig, marshaled)
+	if err != nil {
+		return nil, err
+	}
 
 	beaconState := state.New(beaconConfig)
 	err = beaconState.DecodeSSZ(marshaled, int(version))
 	if err != nil {
 		// If decoding fails, try with progressively newer versions as fallback
-		for tryVersion := version + 1; tryVersion <= clparams.ElectraVersion; tryVersion++ {
+		for tryVersion := version + 1; tryVersion <= clparams.FuluVersion; tryVersion++ {
 			beaconState = state.New(beaconConfig)
 			if err = beaconState.DecodeSSZ(marshaled, int(tryVersion)); err == nil {
-				log.Info("[Checkpoint Sync] Beacon state retrieved", "slot", slot)
 				return beaconState, nil
 			}
 		}
-		return nil, fmt.Errorf("checkpoint sync decode failed (tried all versions up to electra): %s", err)
+		return nil, fmt.Errorf("checkpoint sync decode failed, detected version %s (tried all versions up to %s): %s",
+			clparams.ClVersionToString(version), clparams.ClVersionToString(clparams.FuluVersion), err)
 	}
-	log.Info("[Checkpoint Sync] Beacon state retrieved", "slot", slot)
 	return beaconState, nil
 }
 
-func RetrieveBlock(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, uri string, expectedBlockRoot *libcommon.Hash) (*cltypes.SignedBeaconBlock, error) {
+func RetrieveBlock(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, uri string, expectedBlockRoot *libcommon.Hash, opts *CheckpointRequestOptions) (*cltypes.SignedBeaconBlock, error) {
 	log.Debug("[Checkpoint Sync] Requesting beacon block", "uri", uri)
+	ctx, cancel := context.WithTimeout(ctx, CheckpointBlockTimeout)
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Accept", "application/octet-stream")
-	if err != nil {
-		return nil, fmt.Errorf("checkpoint sync request failed %s", err)
-	}
-	r, err := http.DefaultClient.Do(req)
+	opts.apply(req)
+	r, err := CheckpointHTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		err = r.Body.Close()
 	}()
+	defer closeOnDone(ctx, r.Body)()
+	if r.StatusCode == http.StatusNotFound {
+		return nil, ErrCheckpointBlockNotFound
+	}
 	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("checkpoint sync failed, bad status code %d", r.StatusCode)
+		return nil, fmt.Errorf("%w %d", errCheckpointStatus, r.StatusCode)
+	}
+	if r.ContentLength > MaxCheckpointBlockSize {
+		return nil, fmt.Errorf("checkpoint sync read failed, too long: %d > %d", r.ContentLength, MaxCheckpointBlockSize)
+	}
+	marshaled, err := io.ReadAll(io.LimitReader(r.Body, MaxCheckpointBlockSize+1))
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
-	marshaled, err := io.ReadAll(r.Body)
 	if err != nil {
 		return nil, fmt.Errorf("checkpoint sync read failed %s", err)
 	}
-	if len(marshaled) < 108 {
+	if len(marshaled) < minCheckpointBlockSize {
 		return nil, fmt.Errorf("checkpoint sync read failed, too short")
 	}
+	if int64(len(marshaled)) > MaxCheckpointBlockSize {
+		return nil, fmt.Errorf("checkpoint sync read failed, too long: more than %d bytes", MaxCheckpointBlockSize)
+	}
 	currentSlot := binary.LittleEndian.Uint64(marshaled[100:108])
 	v := beaconConfig.GetCurrentStateVersion(currentSlot / beaconConfig.SlotsPerEpoch)
 
@@ -154,8 +421,71 @@ func RetrieveBlock(ctx context.Context, beaconConfig *clparams.BeaconChainConfig
 			return nil, fmt.Errorf("checkpoint sync decode failed %s", err)
 		}
 		if has != *expectedBlockRoot {
-			return nil, fmt.Errorf("checkpoint sync decode failed, unexpected block root %s", has)
+			return nil, fmt.Errorf("%w %s", ErrUnexpectedBlockRoot, libcommon.Hash(has))
 		}
 	}
 	return block, nil
 }
+
+// RetrieveBlockFromEndpoints tries each uri in order and returns the first block
+// matching expectedBlockRoot. If all endpoints fail, their errors are aggregated.
+func RetrieveBlockFromEndpoints(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, uris []string, expectedBlockRoot *libcommon.Hash, opts *CheckpointRequestOptions) (*cltypes.SignedBeaconBlock, error) {
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("checkpoint sync failed, no block endpoints provided")
+	}
+	var errs []error
+	for _, uri := range uris {
+		block, err := RetrieveBlock(ctx, beaconConfig, uri, expectedBlockRoot, opts)
+		if err == nil {
+			return block, nil
+		}
+		log.Debug("[Checkpoint Sync] Failed to retrieve beacon block from endpoint, trying next", "uri", uri, "err", err)
+		errs = append(errs, fmt.Errorf("%s: %w", uri, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// RetrieveBlockWithFallback retrieves the block with expectedBlockRoot from the
+// blocks endpoint baseUri (e.g. ".../eth/v2/beacon/blocks"), expecting it at
+// slot. The block may sit at an earlier slot if slots were skipped, so when the
+// slot is empty or holds another block, the head block is queried and up to
+// maxSkippedSlots slots before slot, or before the head if it is older, are
+// searched before giving up.
+func RetrieveBlockWithFallback(ctx context.Context, beaconConfig *clparams.BeaconChainConfig, baseUri string, slot uint64, expectedBlockRoot libcommon.Hash, maxSkippedSlots uint64, opts *CheckpointRequestOptions) (*cltypes.SignedBeaconBlock, error) {
+	block, err := RetrieveBlock(ctx, beaconConfig, fmt.Sprintf("%s/%d", baseUri, slot), &expectedBlockRoot, opts)
+	if err == nil || maxSkippedSlots == 0 || !isSkippedSlotErr(err) {
+		return block, err
+	}
+	firstErr := err
+
+	head, err := RetrieveBlock(ctx, beaconConfig, fmt.Sprintf("%s/head", baseUri), nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	headRoot, err := head.Block.HashSSZ()
+	if err != nil {
+		return nil, err
+	}
+	if headRoot == expectedBlockRoot {
+		return head, nil
+	}
+
+	start := min(slot, head.Block.Slot)
+	for i := uint64(1); i <= maxSkippedSlots && i <= start; i++ {
+		log.Debug("[Checkpoint Sync] Block root mismatch, trying an earlier slot", "slot", start-i, "root", expectedBlockRoot)
+		block, err := RetrieveBlock(ctx, beaconConfig, fmt.Sprintf("%s/%d", baseUri, start-i), &expectedBlockRoot, opts)
+		if err == nil {
+			return block, nil
+		}
+		if !isSkippedSlotErr(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w, also not found in the %d slots before %d", firstErr, maxSkippedSlots, start)
+}
+
+// isSkippedSlotErr reports whether err is RetrieveBlock finding no block or
+// another one at the requested slot
+func isSkippedSlotErr(err error) bool {
+	return errors.Is(err, ErrCheckpointBlockNotFound) || errors.Is(err, ErrUnexpectedBlockRoot)
+}
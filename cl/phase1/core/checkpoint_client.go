@@ -0,0 +1,57 @@
+package core
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// CheckpointHTTPConfig configures the HTTP client of checkpoint sync requests
+type CheckpointHTTPConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the response headers, not the
+	// download of the body
+	ResponseHeaderTimeout time.Duration
+	// TLSConfig is used for https endpoints, nil for the Go defaults
+	TLSConfig *tls.Config
+}
+
+// DefaultCheckpointHTTPConfig keeps a few connections per provider open, so
+// that the state and the blocks fetched after it share them
+var DefaultCheckpointHTTPConfig = CheckpointHTTPConfig{
+	MaxIdleConns:          16,
+	MaxIdleConnsPerHost:   4,
+	IdleConnTimeout:       90 * time.Second,
+	DialTimeout:           30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 60 * time.Second,
+}
+
+// NewCheckpointHTTPClient returns a client for checkpoint sync requests. It
+// has no overall timeout, as a state download may take minutes; single
+// requests are bounded by their context instead.
+func NewCheckpointHTTPClient(cfg CheckpointHTTPConfig) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          cfg.MaxIdleConns,
+			MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+			IdleConnTimeout:       cfg.IdleConnTimeout,
+			TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+			TLSClientConfig:       cfg.TLSConfig,
+		},
+	}
+}
+
+// CheckpointHTTPClient is shared by RetrieveBeaconState and RetrieveBlock, so
+// that requests to the same provider reuse connections. It may be replaced
+// with a client from NewCheckpointHTTPClient before checkpoint sync starts.
+var CheckpointHTTPClient = NewCheckpointHTTPClient(DefaultCheckpointHTTPConfig)
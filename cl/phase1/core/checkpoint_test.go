@@ -0,0 +1,364 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/metrics"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
+	"github.com/erigontech/erigon/cl/phase1/core/state"
+	"github.com/erigontech/erigon/cl/utils"
+)
+
+// encodeTestBlock returns the SSZ encoding and the block root of an empty phase0 block
+func encodeTestBlock(t *testing.T, slot, proposerIndex uint64) ([]byte, libcommon.Hash) {
+	t.Helper()
+	block := cltypes.NewSignedBeaconBlock(&clparams.MainnetBeaconConfig)
+	block.Block.Slot = slot
+	block.Block.ProposerIndex = proposerIndex
+	encoded, err := block.EncodeSSZ(nil)
+	require.NoError(t, err)
+	root, err := block.Block.HashSSZ()
+	require.NoError(t, err)
+	return encoded, root
+}
+
+func serveBytes(t *testing.T, data []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetrieveBlockFromEndpoints(t *testing.T) {
+	wrongBlock, _ := encodeTestBlock(t, 1, 1)
+	rightBlock, rightRoot := encodeTestBlock(t, 1, 2)
+
+	wrong := serveBytes(t, wrongBlock)
+	right := serveBytes(t, rightBlock)
+
+	block, err := RetrieveBlockFromEndpoints(context.Background(), &clparams.MainnetBeaconConfig, []string{wrong.URL, right.URL}, &rightRoot, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), block.Block.ProposerIndex)
+
+	_, err = RetrieveBlockFromEndpoints(context.Background(), &clparams.MainnetBeaconConfig, []string{wrong.URL, wrong.URL}, &rightRoot, nil)
+	require.ErrorContains(t, err, "unexpected block root")
+}
+
+func TestRetrieveBlockWithFallback(t *testing.T) {
+	headBlock, _ := encodeTestBlock(t, 5, 1)
+	earlierBlock, earlierRoot := encodeTestBlock(t, 3, 1)
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch r.URL.Path {
+		case "/blocks/head", "/blocks/5":
+			_, _ = w.Write(headBlock)
+		case "/blocks/3":
+			_, _ = w.Write(earlierBlock)
+		default:
+			// slot 4 was skipped
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	baseUri := srv.URL + "/blocks"
+
+	_, err := RetrieveBlockWithFallback(context.Background(), &clparams.MainnetBeaconConfig, baseUri, 4, earlierRoot, 0, nil)
+	require.ErrorIs(t, err, ErrCheckpointBlockNotFound)
+	require.Equal(t, []string{"/blocks/4"}, requested)
+
+	requested = nil
+	block, err := RetrieveBlockWithFallback(context.Background(), &clparams.MainnetBeaconConfig, baseUri, 4, earlierRoot, 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), block.Block.Slot)
+	require.Equal(t, []string{"/blocks/4", "/blocks/head", "/blocks/3"}, requested)
+
+	// a root matching no block within the searched slots
+	_, err = RetrieveBlockWithFallback(context.Background(), &clparams.MainnetBeaconConfig, baseUri, 5, libcommon.Hash{1}, 2, nil)
+	require.ErrorIs(t, err, ErrUnexpectedBlockRoot)
+	require.ErrorContains(t, err, "not found in the 2 slots before 5")
+}
+
+func TestCheckpointHTTPClientReusesConnections(t *testing.T) {
+	encoded, root := encodeTestBlock(t, 1, 2)
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(encoded)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	defer func(client *http.Client) { CheckpointHTTPClient = client }(CheckpointHTTPClient)
+	CheckpointHTTPClient = NewCheckpointHTTPClient(DefaultCheckpointHTTPConfig)
+
+	for i := 0; i < 2; i++ {
+		_, err := RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, &root, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), conns.Load())
+}
+
+func TestRetrieveBlockSizeLimit(t *testing.T) {
+	encoded, root := encodeTestBlock(t, 1, 2)
+	defer func(max int64) { MaxCheckpointBlockSize = max }(MaxCheckpointBlockSize)
+	MaxCheckpointBlockSize = int64(len(encoded))
+
+	block, err := RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, serveBytes(t, encoded).URL, &root, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), block.Block.ProposerIndex)
+
+	oversized := append(encoded, 0)
+	_, err = RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, serveBytes(t, oversized).URL, nil, nil)
+	require.ErrorContains(t, err, "too long")
+
+	// without a Content-Length the body is cut off at the limit
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(oversized[:1])
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(oversized[1:])
+	}))
+	defer chunked.Close()
+	_, err = RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, chunked.URL, nil, nil)
+	require.ErrorContains(t, err, "too long")
+
+	_, err = RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, serveBytes(t, encoded[:minCheckpointBlockSize-1]).URL, nil, nil)
+	require.ErrorContains(t, err, "too short")
+}
+
+func TestRetrieveBlockTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	defer func(timeout time.Duration) { CheckpointBlockTimeout = timeout }(CheckpointBlockTimeout)
+	CheckpointBlockTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, slow.URL, nil, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	// a shorter deadline of the caller is respected
+	CheckpointBlockTimeout = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = RetrieveBlock(ctx, &clparams.MainnetBeaconConfig, slow.URL, nil, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestCheckpointRequestOptions(t *testing.T) {
+	encoded, root := encodeTestBlock(t, 1, 2)
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(encoded)
+	}))
+	defer srv.Close()
+
+	// defaults
+	_, err := RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, &root, nil)
+	require.NoError(t, err)
+	require.Equal(t, "application/octet-stream", headers[0].Get("Accept"))
+	require.Empty(t, headers[0].Get("Authorization"))
+
+	opts := &CheckpointRequestOptions{
+		Accept:        "application/octet-stream;q=1",
+		Authorization: "Bearer secret",
+		Header:        http.Header{"X-Api-Key": {"key"}},
+	}
+	_, err = RetrieveBlock(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, &root, opts)
+	require.NoError(t, err)
+	require.Equal(t, "application/octet-stream;q=1", headers[1].Get("Accept"))
+	require.Equal(t, "Bearer secret", headers[1].Get("Authorization"))
+	require.Equal(t, "key", headers[1].Get("X-Api-Key"))
+
+	// the state download keeps its own headers next to the options
+	_, _, err = downloadCheckpointState(context.Background(), srv.URL, opts)
+	require.NoError(t, err)
+	require.Equal(t, "application/octet-stream;q=1", headers[2].Get("Accept"))
+	require.Equal(t, "Bearer secret", headers[2].Get("Authorization"))
+	require.Equal(t, "key", headers[2].Get("X-Api-Key"))
+	require.Equal(t, "identity", headers[2].Get("Accept-Encoding"))
+}
+
+func TestGetVersionFromForkVersionFulu(t *testing.T) {
+	for _, cfg := range []clparams.BeaconChainConfig{clparams.MainnetBeaconConfig, clparams.BeaconConfigs[clparams.GnosisNetwork]} {
+		// genesis_time, genesis_validators_root, slot, fork.previous_version, fork.current_version
+		prefix := make([]byte, 56)
+		previous := utils.Uint32ToBytes4(uint32(cfg.ElectraForkVersion))
+		current := utils.Uint32ToBytes4(uint32(cfg.FuluForkVersion))
+		copy(prefix[48:52], previous[:])
+		copy(prefix[52:56], current[:])
+
+		forkVersion, err := extractForkVersionFromSerializedBeaconState(prefix)
+		require.NoError(t, err)
+		require.Equal(t, uint32(cfg.FuluForkVersion), forkVersion)
+		require.Equal(t, clparams.FuluVersion, getVersionFromForkVersion(&cfg, forkVersion))
+	}
+}
+
+func TestRetrieveBeaconStateJSON(t *testing.T) {
+	expected := state.New(&clparams.MainnetBeaconConfig)
+	expected.SetVersion(clparams.Phase0Version)
+	expected.SetSlot(64)
+	expected.AddValidator(solid.NewValidatorFromParameters(libcommon.Bytes48{1}, libcommon.Hash{2}, 32_000_000_000, false, 0, 0, clparams.MainnetBeaconConfig.FarFutureEpoch, clparams.MainnetBeaconConfig.FarFutureEpoch), 32_000_000_000)
+	data, err := json.Marshal(expected)
+	require.NoError(t, err)
+	encoded, err := json.Marshal(beaconStateJSON{Version: "phase0", Data: data})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = w.Write(encoded)
+	}))
+	defer srv.Close()
+
+	decoded, err := RetrieveBeaconState(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, clparams.Phase0Version, decoded.Version())
+	require.Equal(t, uint64(64), decoded.Slot())
+	require.Equal(t, 1, decoded.ValidatorLength())
+	balance, err := decoded.ValidatorBalance(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(32_000_000_000), balance)
+
+	expectedRoot, err := expected.HashSSZ()
+	require.NoError(t, err)
+	decodedRoot, err := decoded.HashSSZ()
+	require.NoError(t, err)
+	require.Equal(t, expectedRoot, decodedRoot)
+}
+
+func TestRetrieveBeaconStateLogsVersion(t *testing.T) {
+	encoded, _ := encodeTestState(t, 1)
+	srv := serveBytes(t, encoded)
+
+	var logged bytes.Buffer
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+	log.Root().SetHandler(log.StreamHandler(&logged, log.LogfmtFormat()))
+
+	decoded, err := RetrieveBeaconState(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, nil)
+	require.NoError(t, err)
+	require.Contains(t, logged.String(), "Beacon state retrieved")
+	require.Contains(t, logged.String(), "version="+clparams.ClVersionToString(decoded.Version()))
+
+	// a truncated state fails to decode with the detected version
+	srv = serveBytes(t, encoded[:len(encoded)/2])
+	_, err = RetrieveBeaconState(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, nil)
+	require.ErrorContains(t, err, "detected version "+clparams.ClVersionToString(decoded.Version()))
+}
+
+// sampleCount returns the number of samples observed by h
+func sampleCount(t *testing.T, h metrics.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, h.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRetrieveBeaconStateMetrics(t *testing.T) {
+	encoded, _ := encodeTestState(t, 1)
+	srv := serveBytes(t, encoded)
+
+	downloads, decodes := sampleCount(t, checkpointStateDownloadTimer), sampleCount(t, checkpointStateDecodeTimer)
+	decoded, err := RetrieveBeaconState(context.Background(), &clparams.MainnetBeaconConfig, srv.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, downloads+1, sampleCount(t, checkpointStateDownloadTimer))
+	require.Equal(t, decodes+1, sampleCount(t, checkpointStateDecodeTimer))
+	require.Equal(t, uint64(len(encoded)), checkpointStateBytesGauge.GetValueUint64())
+	require.Equal(t, uint64(decoded.Version()), checkpointStateVersionGauge.GetValueUint64())
+}
+
+func TestDownloadCheckpointStateResume(t *testing.T) {
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) > 1 {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		// announce the full body, send half of it and drop the connection
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", len(data))
+		buf.Write(data[:len(data)/2])
+		require.NoError(t, buf.Flush())
+	}))
+	defer srv.Close()
+
+	downloaded, contentType, err := downloadCheckpointState(context.Background(), srv.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+	require.Equal(t, "application/octet-stream", contentType)
+	require.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(data)/2)}, ranges)
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, err := parseContentRange("bytes 100-199/200")
+	require.NoError(t, err)
+	require.Equal(t, int64(100), start)
+	require.Equal(t, int64(200), total)
+
+	start, total, err = parseContentRange("bytes 5-9/*")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), start)
+	require.Equal(t, int64(-1), total)
+
+	_, _, err = parseContentRange("bytes */200")
+	require.Error(t, err)
+}
+
+// encodeTestState returns the SSZ encoding and the root of a phase0 state with
+// the given number of validators
+func encodeTestState(t *testing.T, validators int) ([]byte, libcommon.Hash) {
+	t.Helper()
+	s := state.New(&clparams.MainnetBeaconConfig)
+	s.SetVersion(clparams.Phase0Version)
+	s.SetSlot(64)
+	for i := 0; i < validators; i++ {
+		s.AddValidator(solid.NewValidatorFromParameters(libcommon.Bytes48{byte(i), byte(i >> 8), byte(i >> 16)}, libcommon.Hash{2}, 32_000_000_000, false, 0, 0, clparams.MainnetBeaconConfig.FarFutureEpoch, clparams.MainnetBeaconConfig.FarFutureEpoch), 32_000_000_000)
+	}
+	encoded, err := s.EncodeSSZ(nil)
+	require.NoError(t, err)
+	root, err := s.HashSSZ()
+	require.NoError(t, err)
+	return encoded, root
+}
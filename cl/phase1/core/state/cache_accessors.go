@@ -346,6 +346,23 @@ func (b *CachingBeaconState) GetValidatorChurnLimit() uint64 {
 	)
 }
 
+// See: https://github.com/ethereum/consensus-specs/blob/dev/specs/electra/beacon-chain.md#new-get_balance_churn_limit
+func (b *CachingBeaconState) GetBalanceChurnLimit() uint64 {
+	cfg := b.BeaconConfig()
+	churn := utils.Max64(cfg.MinPerEpochChurnLimitElectra, b.GetTotalActiveBalance()/cfg.ChurnLimitQuotient)
+	return churn - churn%cfg.EffectiveBalanceIncrement
+}
+
+// See: https://github.com/ethereum/consensus-specs/blob/dev/specs/electra/beacon-chain.md#new-get_activation_exit_churn_limit
+func (b *CachingBeaconState) GetActivationExitChurnLimit() uint64 {
+	return utils.Min64(b.BeaconConfig().MaxPerEpochActivationExitChurnLimit, b.GetBalanceChurnLimit())
+}
+
+// See: https://github.com/ethereum/consensus-specs/blob/dev/specs/electra/beacon-chain.md#new-get_consolidation_churn_limit
+func (b *CachingBeaconState) GetConsolidationChurnLimit() uint64 {
+	return b.GetBalanceChurnLimit() - b.GetActivationExitChurnLimit()
+}
+
 // https://github.com/ethereum/consensus-specs/blob/dev/specs/deneb/beacon-chain.md#new-get_validator_activation_churn_limit
 func (b *CachingBeaconState) GetValidatorActivationChurnLimit() uint64 {
 	if b.Version() >= clparams.DenebVersion {
@@ -68,6 +68,18 @@ func (b *BeaconState) Eth1DataVotes() *solid.ListSSZ[*cltypes.Eth1Data] {
 	return b.eth1DataVotes
 }
 
+func (b *BeaconState) PendingDeposits() *solid.ListSSZ[*cltypes.PendingDeposit] {
+	return b.pendingDeposits
+}
+
+func (b *BeaconState) PendingPartialWithdrawals() *solid.ListSSZ[*cltypes.PendingPartialWithdrawal] {
+	return b.pendingPartialWithdrawals
+}
+
+func (b *BeaconState) PendingConsolidations() *solid.ListSSZ[*cltypes.PendingConsolidation] {
+	return b.pendingConsolidations
+}
+
 func (b *BeaconState) Slashings() solid.Uint64VectorSSZ {
 	return b.slashings
 }
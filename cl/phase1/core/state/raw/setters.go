@@ -358,6 +358,18 @@ func (b *BeaconState) AddHistoricalSummary(summary *cltypes.HistoricalSummary) {
 	b.markLeaf(HistoricalSummariesLeafIndex)
 }
 
+func (b *BeaconState) AddPendingDeposit(deposit *cltypes.PendingDeposit) {
+	b.pendingDeposits.Append(deposit)
+}
+
+func (b *BeaconState) AddPendingPartialWithdrawal(withdrawal *cltypes.PendingPartialWithdrawal) {
+	b.pendingPartialWithdrawals.Append(withdrawal)
+}
+
+func (b *BeaconState) AddPendingConsolidation(consolidation *cltypes.PendingConsolidation) {
+	b.pendingConsolidations.Append(consolidation)
+}
+
 func (b *BeaconState) AddHistoricalRoot(root libcommon.Hash) {
 	b.historicalRoots.Append(root)
 	b.markLeaf(HistoricalRootsLeafIndex)
@@ -177,6 +177,101 @@ func (b *BeaconState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(obj)
 }
 
+// UnmarshalJSON decodes the beacon API JSON encoding of a state. The fields
+// expected are those of the state's current version, so SetVersion must be
+// called first.
+func (b *BeaconState) UnmarshalJSON(data []byte) error {
+	b.latestExecutionPayloadHeader = cltypes.NewEth1Header(b.version)
+	aux := struct {
+		GenesisTime                   uint64                                            `json:"genesis_time,string"`
+		GenesisValidatorsRoot         common.Hash                                       `json:"genesis_validators_root"`
+		Slot                          uint64                                            `json:"slot,string"`
+		Fork                          *cltypes.Fork                                     `json:"fork"`
+		LatestBlockHeader             *cltypes.BeaconBlockHeader                        `json:"latest_block_header"`
+		BlockRoots                    solid.HashVectorSSZ                               `json:"block_roots"`
+		StateRoots                    solid.HashVectorSSZ                               `json:"state_roots"`
+		HistoricalRoots               solid.HashListSSZ                                 `json:"historical_roots"`
+		Eth1Data                      *cltypes.Eth1Data                                 `json:"eth1_data"`
+		Eth1DataVotes                 *solid.ListSSZ[*cltypes.Eth1Data]                 `json:"eth1_data_votes"`
+		Eth1DepositIndex              uint64                                            `json:"eth1_deposit_index,string"`
+		Validators                    *solid.ValidatorSet                               `json:"validators"`
+		Balances                      solid.Uint64ListSSZ                               `json:"balances"`
+		RandaoMixes                   solid.HashVectorSSZ                               `json:"randao_mixes"`
+		Slashings                     solid.Uint64VectorSSZ                             `json:"slashings"`
+		PreviousEpochParticipation    *solid.BitList                                    `json:"previous_epoch_participation"`
+		CurrentEpochParticipation     *solid.BitList                                    `json:"current_epoch_participation"`
+		JustificationBits             *cltypes.JustificationBits                        `json:"justification_bits"`
+		PreviousJustifiedCheckpoint   *solid.Checkpoint                                 `json:"previous_justified_checkpoint"`
+		CurrentJustifiedCheckpoint    *solid.Checkpoint                                 `json:"current_justified_checkpoint"`
+		FinalizedCheckpoint           *solid.Checkpoint                                 `json:"finalized_checkpoint"`
+		PreviousEpochAttestations     *solid.ListSSZ[*solid.PendingAttestation]         `json:"previous_epoch_attestations"`
+		CurrentEpochAttestations      *solid.ListSSZ[*solid.PendingAttestation]         `json:"current_epoch_attestations"`
+		InactivityScores              solid.Uint64ListSSZ                               `json:"inactivity_scores"`
+		CurrentSyncCommittee          *solid.SyncCommittee                              `json:"current_sync_committee"`
+		NextSyncCommittee             *solid.SyncCommittee                              `json:"next_sync_committee"`
+		LatestExecutionPayloadHeader  *cltypes.Eth1Header                               `json:"latest_execution_payload_header"`
+		NextWithdrawalIndex           uint64                                            `json:"next_withdrawal_index,string"`
+		NextWithdrawalValidatorIndex  uint64                                            `json:"next_withdrawal_validator_index,string"`
+		HistoricalSummaries           *solid.ListSSZ[*cltypes.HistoricalSummary]        `json:"historical_summaries"`
+		DepositRequestsStartIndex     uint64                                            `json:"deposit_requests_start_index,string"`
+		DepositBalanceToConsume       uint64                                            `json:"deposit_balance_to_consume,string"`
+		ExitBalanceToConsume          uint64                                            `json:"exit_balance_to_consume,string"`
+		EarliestExitEpoch             uint64                                            `json:"earliest_exit_epoch,string"`
+		ConsolidationBalanceToConsume uint64                                            `json:"consolidation_balance_to_consume,string"`
+		EarliestConsolidationEpoch    uint64                                            `json:"earliest_consolidation_epoch,string"`
+		PendingDeposits               *solid.ListSSZ[*cltypes.PendingDeposit]           `json:"pending_deposits"`
+		PendingPartialWithdrawals     *solid.ListSSZ[*cltypes.PendingPartialWithdrawal] `json:"pending_partial_withdrawals"`
+		PendingConsolidations         *solid.ListSSZ[*cltypes.PendingConsolidation]     `json:"pending_consolidations"`
+	}{
+		// decode in place into the preallocated fields, keeping their limits
+		Fork:                         b.fork,
+		LatestBlockHeader:            b.latestBlockHeader,
+		BlockRoots:                   b.blockRoots,
+		StateRoots:                   b.stateRoots,
+		HistoricalRoots:              b.historicalRoots,
+		Eth1Data:                     b.eth1Data,
+		Eth1DataVotes:                b.eth1DataVotes,
+		Validators:                   b.validators,
+		Balances:                     b.balances,
+		RandaoMixes:                  b.randaoMixes,
+		Slashings:                    b.slashings,
+		PreviousEpochParticipation:   b.previousEpochParticipation,
+		CurrentEpochParticipation:    b.currentEpochParticipation,
+		JustificationBits:            &b.justificationBits,
+		PreviousJustifiedCheckpoint:  &b.previousJustifiedCheckpoint,
+		CurrentJustifiedCheckpoint:   &b.currentJustifiedCheckpoint,
+		FinalizedCheckpoint:          &b.finalizedCheckpoint,
+		PreviousEpochAttestations:    b.previousEpochAttestations,
+		CurrentEpochAttestations:     b.currentEpochAttestations,
+		InactivityScores:             b.inactivityScores,
+		CurrentSyncCommittee:         b.currentSyncCommittee,
+		NextSyncCommittee:            b.nextSyncCommittee,
+		LatestExecutionPayloadHeader: b.latestExecutionPayloadHeader,
+		HistoricalSummaries:          b.historicalSummaries,
+		PendingDeposits:              b.pendingDeposits,
+		PendingPartialWithdrawals:    b.pendingPartialWithdrawals,
+		PendingConsolidations:        b.pendingConsolidations,
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	b.genesisTime = aux.GenesisTime
+	b.genesisValidatorsRoot = aux.GenesisValidatorsRoot
+	b.slot = aux.Slot
+	b.eth1DepositIndex = aux.Eth1DepositIndex
+	b.nextWithdrawalIndex = aux.NextWithdrawalIndex
+	b.nextWithdrawalValidatorIndex = aux.NextWithdrawalValidatorIndex
+	b.depositRequestsStartIndex = aux.DepositRequestsStartIndex
+	b.depositBalanceToConsume = aux.DepositBalanceToConsume
+	b.exitBalanceToConsume = aux.ExitBalanceToConsume
+	b.earliestExitEpoch = aux.EarliestExitEpoch
+	b.consolidationBalanceToConsume = aux.ConsolidationBalanceToConsume
+	b.earliestConsolidationEpoch = aux.EarliestConsolidationEpoch
+	// every leaf has to be rehashed
+	b.touchedLeaves = nil
+	return b.init()
+}
+
 // Get validators field
 func (b *BeaconState) Validators() *solid.ValidatorSet {
 	return b.validators
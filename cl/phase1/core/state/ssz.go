@@ -28,6 +28,15 @@ func (b *CachingBeaconState) DecodeSSZ(buf []byte, version int) error {
 	return b.InitBeaconState()
 }
 
+// UnmarshalJSON decodes the beacon API JSON encoding of a state of the
+// version set with SetVersion and rebuilds the caches
+func (b *CachingBeaconState) UnmarshalJSON(data []byte) error {
+	if err := b.BeaconState.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	return b.InitBeaconState()
+}
+
 // SSZ size of the Beacon State
 func (b *CachingBeaconState) EncodingSizeSSZ() (size int) {
 	sz := b.BeaconState.EncodingSizeSSZ()
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/phase1/core/state"
+	"github.com/erigontech/erigon/cl/utils"
+)
+
+// safetyDecay is the maximum tolerated loss of the 1/3 safety margin, in percent
+const safetyDecay = 10
+
+var ErrOutsideWeakSubjectivityPeriod = errors.New("checkpoint is outside of the weak subjectivity period")
+
+// ComputeWeakSubjectivityPeriod returns the number of epochs after the epoch of s
+// during which s is safe to sync from.
+// See: https://github.com/ethereum/consensus-specs/blob/dev/specs/phase0/weak-subjectivity.md#compute_weak_subjectivity_period
+// and https://github.com/ethereum/consensus-specs/blob/dev/specs/electra/weak-subjectivity.md#modified-compute_weak_subjectivity_period
+func ComputeWeakSubjectivityPeriod(s *state.CachingBeaconState) uint64 {
+	cfg := s.BeaconConfig()
+	wsPeriod := cfg.MinValidatorWithdrawabilityDelay
+	totalActiveBalance := s.GetTotalActiveBalance()
+
+	if s.Version() >= clparams.ElectraVersion {
+		churn := utils.Max64(cfg.MinPerEpochChurnLimitElectra, totalActiveBalance/cfg.ChurnLimitQuotient)
+		churn -= churn % cfg.EffectiveBalanceIncrement
+		if churn == 0 {
+			return wsPeriod
+		}
+		return wsPeriod + safetyDecay*totalActiveBalance/(2*churn*100)
+	}
+
+	n := uint64(len(s.GetActiveValidatorsIndices(state.Epoch(s))))
+	if n == 0 {
+		return wsPeriod
+	}
+	t := totalActiveBalance / n / cfg.EffectiveBalanceIncrement
+	T := cfg.MaxEffectiveBalance / cfg.EffectiveBalanceIncrement
+	delta := s.GetValidatorChurnLimit()
+	Delta := cfg.MaxDeposits * cfg.SlotsPerEpoch
+
+	if T*(200+3*safetyDecay) < t*(200+12*safetyDecay) {
+		epochsForValidatorSetChurn := n * (t*(200+12*safetyDecay) - T*(200+3*safetyDecay)) / (600 * delta * (2*t + T))
+		epochsForBalanceTopUps := n * (200 + 3*safetyDecay) / (600 * Delta)
+		return wsPeriod + utils.Max64(epochsForValidatorSetChurn, epochsForBalanceTopUps)
+	}
+	return wsPeriod + 3*n*safetyDecay*t/(200*Delta*(T-t))
+}
+
+// CheckWeakSubjectivityPeriod returns ErrOutsideWeakSubjectivityPeriod if, at
+// time now, s is too old to be trusted as a checkpoint.
+func CheckWeakSubjectivityPeriod(s *state.CachingBeaconState, now time.Time) error {
+	cfg := s.BeaconConfig()
+	var currentEpoch uint64
+	if genesis := s.GenesisTime(); uint64(now.Unix()) > genesis {
+		currentEpoch = (uint64(now.Unix()) - genesis) / cfg.SecondsPerSlot / cfg.SlotsPerEpoch
+	}
+	stateEpoch := state.Epoch(s)
+	wsPeriod := ComputeWeakSubjectivityPeriod(s)
+	if currentEpoch > stateEpoch+wsPeriod {
+		return fmt.Errorf("%w: state epoch %d, current epoch %d, period %d epochs", ErrOutsideWeakSubjectivityPeriod, stateEpoch, currentEpoch, wsPeriod)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
+	"github.com/erigontech/erigon/cl/phase1/core/state"
+)
+
+// newWeakSubjectivityState returns a state at epoch with validators active
+// validators of 32 ETH each
+func newWeakSubjectivityState(version clparams.StateVersion, validators int, epoch uint64) *state.CachingBeaconState {
+	cfg := &clparams.MainnetBeaconConfig
+	s := state.New(cfg)
+	s.SetVersion(version)
+	for i := 0; i < validators; i++ {
+		v := solid.NewValidator()
+		v.SetExitEpoch(cfg.FarFutureEpoch)
+		v.SetWithdrawableEpoch(cfg.FarFutureEpoch)
+		v.SetEffectiveBalance(cfg.MaxEffectiveBalance)
+		s.AddValidator(v, cfg.MaxEffectiveBalance)
+	}
+	s.SetGenesisTime(1_606_824_023)
+	s.SetSlot(epoch * cfg.SlotsPerEpoch)
+	return s
+}
+
+func TestComputeWeakSubjectivityPeriod(t *testing.T) {
+	// 1024 validators: 256 + 12 epochs of validator set churn, both before
+	// and after the electra change to balance-based churn
+	require.Equal(t, uint64(268), ComputeWeakSubjectivityPeriod(newWeakSubjectivityState(clparams.DenebVersion, 1024, 10)))
+	require.Equal(t, uint64(268), ComputeWeakSubjectivityPeriod(newWeakSubjectivityState(clparams.ElectraVersion, 1024, 10)))
+}
+
+func TestCheckWeakSubjectivityPeriod(t *testing.T) {
+	for _, version := range []clparams.StateVersion{clparams.DenebVersion, clparams.ElectraVersion} {
+		const stateEpoch = 1000
+		s := newWeakSubjectivityState(version, 1024, stateEpoch)
+		cfg := s.BeaconConfig()
+		wsPeriod := ComputeWeakSubjectivityPeriod(s)
+		epochStart := func(epoch uint64) time.Time {
+			return time.Unix(int64(s.GenesisTime()+epoch*cfg.SlotsPerEpoch*cfg.SecondsPerSlot), 0)
+		}
+
+		require.NoError(t, CheckWeakSubjectivityPeriod(s, epochStart(stateEpoch)))
+		require.NoError(t, CheckWeakSubjectivityPeriod(s, epochStart(stateEpoch+wsPeriod)))
+
+		err := CheckWeakSubjectivityPeriod(s, epochStart(stateEpoch+wsPeriod+1))
+		require.True(t, errors.Is(err, ErrOutsideWeakSubjectivityPeriod), "got %v", err)
+	}
+}
@@ -104,7 +104,7 @@ func (b *blockCollector) Flush(ctx context.Context) error {
 			b.logger.Warn("bad blocks segment received", "err", err)
 			return err
 		}
-		header, err := executionPayload.RlpHeader(&parentRoot)
+		header, err := executionPayload.RlpHeader(&parentRoot, nil)
 		if err != nil {
 			b.logger.Warn("bad blocks segment received", "err", err)
 			return err
@@ -0,0 +1,76 @@
+package execution_client
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/erigontech/erigon/core/types"
+)
+
+// bodyCache is an LRU cache of block bodies keyed by block number, bounded
+// by the total encoded size of the bodies rather than their count
+type bodyCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List // front is most recently used
+	entries  map[uint64]*list.Element
+}
+
+type bodyCacheEntry struct {
+	number uint64
+	body   *types.RawBody
+	size   int
+}
+
+func newBodyCache(maxBytes int) *bodyCache {
+	return &bodyCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[uint64]*list.Element),
+	}
+}
+
+func (c *bodyCache) get(number uint64) (*types.RawBody, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[number]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*bodyCacheEntry).body, true
+}
+
+// add caches body, evicting the least recently used bodies until it fits.
+// Bodies larger than the whole cache are not cached.
+func (c *bodyCache) add(number uint64, body *types.RawBody) {
+	size := body.EncodingSize()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[number]; ok {
+		c.remove(elem)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	for c.size+size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	c.entries[number] = c.order.PushFront(&bodyCacheEntry{number: number, body: body, size: size})
+	c.size += size
+}
+
+func (c *bodyCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*bodyCacheEntry)
+	delete(c.entries, entry.number)
+	c.size -= entry.size
+}
+
+func (c *bodyCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.size = 0
+}
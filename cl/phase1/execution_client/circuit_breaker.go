@@ -0,0 +1,128 @@
+package execution_client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrEngineCircuitOpen is returned without calling the execution engine while
+// the pool's circuit breaker is open
+var ErrEngineCircuitOpen = errors.New("execution engine circuit breaker is open")
+
+// CircuitState is the state of the ExecutionEnginePool circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through to the engine
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every call fast until the cooldown has elapsed
+	CircuitOpen
+	// CircuitHalfOpen lets a single call through to probe whether the engine recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker opens after threshold consecutive engine failures. A nil
+// circuitBreaker is always closed.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: max(threshold, 1), cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may be sent to the engine. Once the cooldown
+// has elapsed the breaker half-opens and lets a single probe call through;
+// the others keep failing fast until its outcome is recorded.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrEngineCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrEngineCircuitOpen
+		}
+	default:
+		return nil
+	}
+	b.probing = true
+	return nil
+}
+
+// success closes the breaker
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// failure counts an engine failure, opening the breaker once the threshold
+// is reached or when the half-open probe failed
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release ends a call that says nothing about the engine's health, such as
+// one abandoned by its caller, letting another call probe in its place
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) currentState() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
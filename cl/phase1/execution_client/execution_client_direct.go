@@ -8,6 +8,7 @@ import (
 
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/gointerfaces/execution"
+	"github.com/erigontech/erigon/cl/clparams"
 	"github.com/erigontech/erigon/cl/cltypes"
 	"github.com/erigontech/erigon/core/types"
 	"github.com/erigontech/erigon/turbo/engineapi/engine_types"
@@ -24,12 +25,19 @@ func NewExecutionClientDirect(chainRW eth1_chain_reader.ChainReaderWriterEth1) (
 	}, nil
 }
 
-func (cc *ExecutionClientDirect) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash) (invalid bool, err error) {
+func (cc *ExecutionClientDirect) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (invalid bool, err error) {
 	if payload == nil {
 		return
 	}
+	if err := checkExecutionRequests(payload, executionRequests); err != nil {
+		return false, err
+	}
+	requestsHash, err := executionRequestsHash(payload, executionRequests)
+	if err != nil {
+		return true, err
+	}
 
-	header, err := payload.RlpHeader(beaconParentRoot)
+	header, err := payload.RlpHeader(beaconParentRoot, requestsHash)
 	if err != nil {
 		return true, err
 	}
@@ -58,6 +66,25 @@ func (cc *ExecutionClientDirect) NewPayload(ctx context.Context, payload *cltype
 	return
 }
 
+// executionRequestsHash returns the EIP-7685 commitment to the execution
+// requests of an Electra payload, each a request type followed by its data in
+// increasing type order, and nil before Electra
+func executionRequestsHash(payload *cltypes.Eth1Block, executionRequests [][]byte) (*libcommon.Hash, error) {
+	if payload.Version() < clparams.ElectraVersion {
+		return nil, nil
+	}
+	requests := make(types.FlatRequests, 0, len(executionRequests))
+	lastReqType := -1
+	for i, r := range executionRequests {
+		if len(r) <= 1 || int(r[0]) <= lastReqType {
+			return nil, fmt.Errorf("invalid execution request at index %d", i)
+		}
+		lastReqType = int(r[0])
+		requests = append(requests, types.FlatRequest{Type: r[0], RequestData: r[1:]})
+	}
+	return requests.Hash(), nil
+}
+
 func (cc *ExecutionClientDirect) ForkChoiceUpdate(ctx context.Context, finalized libcommon.Hash, head libcommon.Hash, attr *engine_types.PayloadAttributes) ([]byte, error) {
 	status, _, _, err := cc.chainRW.UpdateForkChoice(ctx, head, head, finalized)
 	if err != nil {
@@ -100,6 +127,10 @@ func (cc *ExecutionClientDirect) CurrentHeader(ctx context.Context) (*types.Head
 	return cc.chainRW.CurrentHeader(ctx), nil
 }
 
+func (cc *ExecutionClientDirect) GetHeaderByHash(ctx context.Context, hash libcommon.Hash) (*types.Header, error) {
+	return cc.chainRW.GetHeaderByHash(ctx, hash), nil
+}
+
 func (cc *ExecutionClientDirect) IsCanonicalHash(ctx context.Context, hash libcommon.Hash) (bool, error) {
 	return cc.chainRW.IsCanonicalHash(ctx, hash)
 }
@@ -0,0 +1,98 @@
+package execution_client
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/gointerfaces/execution"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/consensus/merge"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/turbo/execution/eth1/eth1_chain_reader.go"
+	"github.com/erigontech/erigon/turbo/execution/eth1/eth1_utils"
+)
+
+// insertingModule is an execution module accepting every block inserted,
+// with no current header
+type insertingModule struct {
+	execution.ExecutionClient
+	inserted []*execution.Block
+}
+
+func (m *insertingModule) InsertBlocks(ctx context.Context, in *execution.InsertBlocksRequest, opts ...grpc.CallOption) (*execution.InsertionResult, error) {
+	m.inserted = append(m.inserted, in.Blocks...)
+	return &execution.InsertionResult{Result: execution.ExecutionStatus_Success}, nil
+}
+
+func (m *insertingModule) CurrentHeader(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*execution.GetHeaderResponse, error) {
+	return &execution.GetHeaderResponse{}, nil
+}
+
+// electraPayload returns an empty Electra payload whose block hash commits to
+// requestsHash
+func electraPayload(t *testing.T, parentRoot libcommon.Hash, requestsHash *libcommon.Hash) *cltypes.Eth1Block {
+	t.Helper()
+	withdrawalsHash := types.EmptyRootHash
+	header := &types.Header{
+		UncleHash:             types.EmptyUncleHash,
+		TxHash:                types.EmptyRootHash,
+		Difficulty:            merge.ProofOfStakeDifficulty,
+		Number:                big.NewInt(1),
+		GasLimit:              30_000_000,
+		Time:                  1,
+		Nonce:                 merge.ProofOfStakeNonce,
+		BaseFee:               big.NewInt(7),
+		WithdrawalsHash:       &withdrawalsHash,
+		BlobGasUsed:           new(uint64),
+		ExcessBlobGas:         new(uint64),
+		ParentBeaconBlockRoot: &parentRoot,
+		RequestsHash:          requestsHash,
+	}
+	// the execution payload is unchanged since Deneb
+	encoded, err := cltypes.NewEth1BlockFromHeaderAndBody(header, &types.RawBody{}, &clparams.MainnetBeaconConfig).EncodeSSZ(nil)
+	require.NoError(t, err)
+	payload := cltypes.NewEth1Block(clparams.ElectraVersion, &clparams.MainnetBeaconConfig)
+	require.NoError(t, payload.DecodeSSZ(encoded, int(clparams.ElectraVersion)))
+	return payload
+}
+
+func TestExecutionClientDirectNewPayloadRequests(t *testing.T) {
+	executionRequests := [][]byte{{0x00, 0x01, 0x02}, {0x02, 0x03}}
+	requestsHash := types.FlatRequests{
+		{Type: 0x00, RequestData: []byte{0x01, 0x02}},
+		{Type: 0x02, RequestData: []byte{0x03}},
+	}.Hash()
+	parentRoot := libcommon.Hash{0x01}
+	payload := electraPayload(t, parentRoot, requestsHash)
+
+	module := &insertingModule{}
+	client, err := NewExecutionClientDirect(eth1_chain_reader.NewChainReaderEth1(nil, module, 1000))
+	require.NoError(t, err)
+
+	invalid, err := client.NewPayload(context.Background(), payload, &parentRoot, nil, executionRequests)
+	require.NoError(t, err)
+	require.False(t, invalid)
+	require.Len(t, module.inserted, 1)
+	header, err := eth1_utils.HeaderRpcToHeader(module.inserted[0].Header)
+	require.NoError(t, err)
+	require.Equal(t, requestsHash, header.RequestsHash)
+	require.Equal(t, payload.BlockHash, header.Hash())
+
+	// the header rebuilt without the requests doesn't match the payload
+	invalid, err = client.NewPayload(context.Background(), payload, &parentRoot, nil, nil)
+	require.ErrorContains(t, err, "mismatching hash")
+	require.True(t, invalid)
+
+	// requests must be typed and in increasing type order
+	invalid, err = client.NewPayload(context.Background(), payload, &parentRoot, nil, [][]byte{{0x02, 0x03}, {0x00, 0x01}})
+	require.ErrorContains(t, err, "invalid execution request at index 1")
+	require.True(t, invalid)
+	require.Len(t, module.inserted, 1)
+}
@@ -2,20 +2,26 @@ package execution_client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
 	"strings"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+
 	"github.com/erigontech/erigon-lib/common/hexutil"
+	"github.com/erigontech/erigon-lib/common/hexutility"
 
 	"github.com/erigontech/erigon-lib/log/v3"
 
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon/cl/clparams"
 	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/cltypes/solid"
 	"github.com/erigontech/erigon/cl/phase1/execution_client/rpc_helper"
+	"github.com/erigontech/erigon/cl/utils"
 	"github.com/erigontech/erigon/core/types"
 	"github.com/erigontech/erigon/rpc"
 	"github.com/erigontech/erigon/turbo/engineapi/engine_types"
@@ -23,13 +29,22 @@ import (
 
 const DefaultRPCHTTPTimeout = time.Second * 30
 
+// payloadVersionsLimit bounds the payload ids remembered, only the few most
+// recent payloads being built are ever polled
+const payloadVersionsLimit = 64
+
 type ExecutionClientRpc struct {
-	client    *rpc.Client
-	addr      string
-	jwtSecret []byte
+	client       *rpc.Client
+	addr         string
+	jwtSecret    []byte
+	beaconConfig *clparams.BeaconChainConfig
+
+	// payloadVersions maps the ids of payloads being built to the earliest
+	// fork their attributes allow
+	payloadVersions *lru.Cache[string, clparams.StateVersion]
 }
 
-func NewExecutionClientRPC(jwtSecret []byte, addr string, port int) (*ExecutionClientRpc, error) {
+func NewExecutionClientRPC(jwtSecret []byte, addr string, port int, beaconConfig *clparams.BeaconChainConfig) (*ExecutionClientRpc, error) {
 	roundTripper := rpc_helper.NewJWTRoundTripper(jwtSecret)
 	client := &http.Client{Timeout: DefaultRPCHTTPTimeout, Transport: roundTripper}
 
@@ -46,17 +61,27 @@ func NewExecutionClientRPC(jwtSecret []byte, addr string, port int) (*ExecutionC
 		return nil, err
 	}
 
+	payloadVersions, err := lru.New[string, clparams.StateVersion](payloadVersionsLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ExecutionClientRpc{
-		client:    rpcClient,
-		addr:      addr,
-		jwtSecret: jwtSecret,
+		client:          rpcClient,
+		addr:            addr,
+		jwtSecret:       jwtSecret,
+		beaconConfig:    beaconConfig,
+		payloadVersions: payloadVersions,
 	}, nil
 }
 
-func (cc *ExecutionClientRpc) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash) (invalid bool, err error) {
+func (cc *ExecutionClientRpc) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (invalid bool, err error) {
 	if payload == nil {
 		return
 	}
+	if err = checkExecutionRequests(payload, executionRequests); err != nil {
+		return false, err
+	}
 
 	reversedBaseFeePerGas := libcommon.Copy(payload.BaseFeePerGas[:])
 	for i, j := 0, len(reversedBaseFeePerGas)-1; i < j; i, j = i+1, j-1 {
@@ -117,6 +142,13 @@ func (cc *ExecutionClientRpc) NewPayload(ctx context.Context, payload *cltypes.E
 	if versionedHashes != nil {
 		args = append(args, versionedHashes, *beaconParentRoot)
 	}
+	if payload.Version() >= clparams.ElectraVersion {
+		requests := make([]hexutility.Bytes, len(executionRequests))
+		for i, r := range executionRequests {
+			requests[i] = r
+		}
+		args = append(args, requests)
+	}
 	err = cc.client.CallContext(ctx, &payloadStatus, engineMethod, args...)
 	if err != nil {
 		err = fmt.Errorf("execution Client RPC failed to retrieve the NewPayload status response, err: %w", err)
@@ -158,10 +190,22 @@ func (cc *ExecutionClientRpc) ForkChoiceUpdate(ctx context.Context, finalized li
 	if forkChoiceResp.PayloadId == nil {
 		return []byte{}, checkPayloadStatus(forkChoiceResp.PayloadStatus)
 	}
+	if attributes != nil {
+		cc.payloadVersions.Add(string(*forkChoiceResp.PayloadId), payloadAttributesVersion(attributes))
+	}
 
 	return *forkChoiceResp.PayloadId, checkPayloadStatus(forkChoiceResp.PayloadStatus)
 }
 
+// checkExecutionRequests rejects execution requests passed with a payload
+// from before Electra, whose engine_newPayload versions don't take any
+func checkExecutionRequests(payload *cltypes.Eth1Block, executionRequests [][]byte) error {
+	if executionRequests != nil && payload.Version() < clparams.ElectraVersion {
+		return fmt.Errorf("%w: %s payload", ErrUnexpectedExecutionRequests, clparams.ClVersionToString(payload.Version()))
+	}
+	return nil
+}
+
 func checkPayloadStatus(payloadStatus *engine_types.PayloadStatus) error {
 	if payloadStatus == nil {
 		return fmt.Errorf("empty payloadStatus")
@@ -194,6 +238,15 @@ func (cc *ExecutionClientRpc) CurrentHeader(ctx context.Context) (*types.Header,
 	panic("unimplemented")
 }
 
+// GetHeaderByHash gets the header of the block with the given hash
+func (cc *ExecutionClientRpc) GetHeaderByHash(ctx context.Context, hash libcommon.Hash) (*types.Header, error) {
+	var header *types.Header
+	if err := cc.client.CallContext(ctx, &header, rpc_helper.GetBlockByHash, hash, false); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
 func (cc *ExecutionClientRpc) IsCanonicalHash(ctx context.Context, hash libcommon.Hash) (bool, error) {
 	panic("unimplemented")
 }
@@ -253,6 +306,123 @@ func (cc *ExecutionClientRpc) HasBlock(ctx context.Context, hash libcommon.Hash)
 
 // Block production
 
+// payloadAttributesVersion returns the earliest fork whose payload attributes
+// have the shape of attributes
+func payloadAttributesVersion(attributes *engine_types.PayloadAttributes) clparams.StateVersion {
+	switch {
+	case attributes.ParentBeaconBlockRoot != nil:
+		return clparams.DenebVersion
+	case attributes.Withdrawals != nil:
+		return clparams.CapellaVersion
+	default:
+		return clparams.BellatrixVersion
+	}
+}
+
+// getPayloadVersions returns the forks to request a payload built from
+// attributes of minVersion as, in order. Attributes don't change after deneb,
+// so these payloads are requested with the oldest method first and move on
+// whenever the EL reports the payload belongs to a later fork.
+func getPayloadVersions(minVersion clparams.StateVersion) []clparams.StateVersion {
+	if minVersion < clparams.DenebVersion {
+		return []clparams.StateVersion{minVersion}
+	}
+	var versions []clparams.StateVersion
+	for v := minVersion; v <= clparams.FuluVersion; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
 func (cc *ExecutionClientRpc) GetAssembledBlock(ctx context.Context, id []byte) (*cltypes.Eth1Block, *engine_types.BlobsBundleV1, *big.Int, error) {
-	panic("unimplemented")
+	minVersion, ok := cc.payloadVersions.Get(string(id))
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unknown payload id %x", id)
+	}
+
+	var err error
+	for _, version := range getPayloadVersions(minVersion) {
+		var engineMethod string
+		if engineMethod, err = rpc_helper.GetPayloadMethod(version); err != nil {
+			return nil, nil, nil, err
+		}
+		log.Debug("[ExecutionClientRpc] Calling EL", "method", engineMethod)
+
+		resp := &engine_types.GetPayloadResponse{}
+		if version == clparams.BellatrixVersion {
+			// engine_getPayloadV1 returns the bare payload
+			resp.ExecutionPayload = &engine_types.ExecutionPayload{}
+			err = cc.client.CallContext(ctx, resp.ExecutionPayload, engineMethod, hexutility.Bytes(id))
+		} else {
+			err = cc.client.CallContext(ctx, resp, engineMethod, hexutility.Bytes(id))
+		}
+
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == rpc_helper.UnsupportedForkErrorCode {
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("execution Client RPC failed to retrieve the GetPayload response, err: %w", err)
+		}
+		// later polls of the same payload go straight to its fork
+		cc.payloadVersions.Add(string(id), version)
+		return convertGetPayloadResponse(resp, version, cc.beaconConfig)
+	}
+	return nil, nil, nil, fmt.Errorf("execution Client RPC failed to retrieve the GetPayload response, err: %w", err)
+}
+
+func convertGetPayloadResponse(resp *engine_types.GetPayloadResponse, version clparams.StateVersion, beaconConfig *clparams.BeaconChainConfig) (*cltypes.Eth1Block, *engine_types.BlobsBundleV1, *big.Int, error) {
+	payload := resp.ExecutionPayload
+	if payload == nil {
+		return nil, nil, nil, nil
+	}
+
+	block := cltypes.NewEth1Block(version, beaconConfig)
+	block.ParentHash = payload.ParentHash
+	block.FeeRecipient = payload.FeeRecipient
+	block.StateRoot = payload.StateRoot
+	block.ReceiptsRoot = payload.ReceiptsRoot
+	copy(block.LogsBloom[:], payload.LogsBloom)
+	block.PrevRandao = payload.PrevRandao
+	block.BlockNumber = uint64(payload.BlockNumber)
+	block.GasLimit = uint64(payload.GasLimit)
+	block.GasUsed = uint64(payload.GasUsed)
+	block.Time = uint64(payload.Timestamp)
+	block.Extra = solid.NewExtraData()
+	block.Extra.SetBytes(payload.ExtraData)
+	block.BlockHash = payload.BlockHash
+	if payload.BaseFeePerGas != nil {
+		// base fee is stored little-endian
+		copy(block.BaseFeePerGas[:], utils.ReverseOfByteSlice(payload.BaseFeePerGas.ToInt().FillBytes(make([]byte, 32))))
+	}
+	transactions := make([][]byte, len(payload.Transactions))
+	for i, txn := range payload.Transactions {
+		transactions[i] = txn
+	}
+	block.Transactions = solid.NewTransactionsSSZFromTransactions(transactions)
+	block.Withdrawals = solid.NewStaticListSSZ[*cltypes.Withdrawal](int(beaconConfig.MaxWithdrawalsPerPayload), 44)
+	for _, w := range payload.Withdrawals {
+		block.Withdrawals.Append(&cltypes.Withdrawal{
+			Index:     w.Index,
+			Validator: w.Validator,
+			Address:   w.Address,
+			Amount:    w.Amount,
+		})
+	}
+	if payload.BlobGasUsed != nil {
+		block.BlobGasUsed = uint64(*payload.BlobGasUsed)
+	}
+	if payload.ExcessBlobGas != nil {
+		block.ExcessBlobGas = uint64(*payload.ExcessBlobGas)
+	}
+
+	bundle := resp.BlobsBundle
+	if bundle == nil {
+		bundle = &engine_types.BlobsBundleV1{}
+	}
+	var blockValue *big.Int
+	if resp.BlockValue != nil {
+		blockValue = resp.BlockValue.ToInt()
+	}
+	return block, bundle, blockValue, nil
 }
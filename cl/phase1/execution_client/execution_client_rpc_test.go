@@ -0,0 +1,32 @@
+package execution_client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/turbo/engineapi/engine_types"
+)
+
+func TestConvertGetPayloadResponseBeaconConfig(t *testing.T) {
+	cfg := clparams.MainnetBeaconConfig
+	cfg.MaxWithdrawalsPerPayload = 8
+	resp := &engine_types.GetPayloadResponse{ExecutionPayload: &engine_types.ExecutionPayload{
+		Withdrawals: []*types.Withdrawal{{Index: 1, Validator: 2, Amount: 3}},
+	}}
+
+	mainnet, _, _, err := convertGetPayloadResponse(resp, clparams.CapellaVersion, &clparams.MainnetBeaconConfig)
+	require.NoError(t, err)
+	custom, _, _, err := convertGetPayloadResponse(resp, clparams.CapellaVersion, &cfg)
+	require.NoError(t, err)
+	require.Equal(t, 1, custom.Withdrawals.Len())
+
+	// the withdrawals limit of the configured network sets the root
+	mainnetRoot, err := mainnet.Withdrawals.HashSSZ()
+	require.NoError(t, err)
+	customRoot, err := custom.Withdrawals.HashSSZ()
+	require.NoError(t, err)
+	require.NotEqual(t, mainnetRoot, customRoot)
+}
@@ -17,6 +17,7 @@ package execution_client
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -24,11 +25,132 @@ import (
 
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/metrics"
 	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/phase1/core/state/lru"
 	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/rpc"
 	"github.com/erigontech/erigon/turbo/engineapi/engine_types"
+	"golang.org/x/sync/errgroup"
 )
 
+// ErrEnginePoolBusy is returned by NewPayload under QueuePolicyFailFast when the batch queue is full
+var ErrEnginePoolBusy = errors.New("execution engine pool is busy")
+
+// ErrUnexpectedExecutionRequests is returned by NewPayload for execution
+// requests passed with a payload from before Electra
+var ErrUnexpectedExecutionRequests = errors.New("execution requests before electra")
+
+var (
+	enginePoolQueueDepthGauge   = metrics.GetOrCreateGauge("execution_engine_pool_queue_depth")
+	enginePoolProbeLatency      = metrics.GetOrCreateHistogram("execution_engine_pool_probe_latency_seconds")
+	enginePoolProbeHealthyGauge = metrics.GetOrCreateGauge("execution_engine_pool_probe_healthy")
+	enginePoolRequestsGauge     = metrics.GetOrCreateGauge("execution_engine_pool_requests")
+	enginePoolCacheHitsGauge    = metrics.GetOrCreateGauge("execution_engine_pool_cache_hits")
+	enginePoolCacheMissesGauge  = metrics.GetOrCreateGauge("execution_engine_pool_cache_misses")
+)
+
+const (
+	defaultQueueDepth      = 1000
+	defaultProbeThreshold  = time.Second
+	defaultMetricsInterval = 10 * time.Second
+)
+
+// QueuePolicy decides what NewPayload does when the batch queue is full
+type QueuePolicy int
+
+const (
+	// QueuePolicyBlock waits for the batcher to make room
+	QueuePolicyBlock QueuePolicy = iota
+	// QueuePolicyFailFast returns ErrEnginePoolBusy immediately
+	QueuePolicyFailFast
+)
+
+// ExecutionEnginePoolOption configures an ExecutionEnginePool
+type ExecutionEnginePoolOption func(*ExecutionEnginePool)
+
+// WithQueueDepth sets how many NewPayload requests may wait for the batcher (default 1000)
+func WithQueueDepth(depth int) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.queueDepth = depth
+	}
+}
+
+// WithQueuePolicy sets the behaviour of NewPayload when the batch queue is full (default QueuePolicyBlock)
+func WithQueuePolicy(policy QueuePolicy) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.queuePolicy = policy
+	}
+}
+
+// WithCacheSizes sets the capacity of the header and block hash caches (default 1000 each)
+func WithCacheSizes(headers, blockHashes int) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.headerCacheSize = headers
+		p.blockHashCacheSize = blockHashes
+	}
+}
+
+// WithProbeThreshold sets the round-trip latency above which Probe reports the
+// execution engine as unhealthy (default 1s)
+func WithProbeThreshold(threshold time.Duration) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.probeThreshold = threshold
+	}
+}
+
+// WithBodyCache enables an LRU cache of the bodies returned by
+// GetBodiesByRange, holding at most maxBytes of encoded bodies. GetBodiesByHashes
+// shares it for the canonical blocks whose headers are cached.
+func WithBodyCache(maxBytes int) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.bodyCache = newBodyCache(maxBytes)
+	}
+}
+
+// WithPreservedStatsOnReset keeps the request and cache counters when Reset
+// flushes the caches, instead of zeroing them
+func WithPreservedStatsOnReset() ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.preserveStatsOnReset = true
+	}
+}
+
+// WithForceBatching batches NewPayload requests even when the engine supports
+// direct insertion, which otherwise bypasses the batcher. Each payload may
+// then wait up to the batch timeout before being sent, trading latency for
+// throughput during bulk import.
+func WithForceBatching() ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.forceBatching = true
+	}
+}
+
+// WithCircuitBreaker fails calls fast with ErrEngineCircuitOpen for cooldown
+// after threshold consecutive engine failures, instead of sending each of them
+// to a failing engine. Once the cooldown has elapsed a single call is let
+// through, closing the breaker again if it succeeds.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithMetricsInterval sets how often the request and cache counters are
+// published to the metrics registry (default 10s). A non-positive interval
+// disables publishing; the counters are then only available through Stats.
+func WithMetricsInterval(interval time.Duration) ExecutionEnginePoolOption {
+	return func(p *ExecutionEnginePool) {
+		p.metricsInterval = interval
+	}
+}
+
+// ProbeResult is the outcome of a single Probe
+type ProbeResult struct {
+	Latency time.Duration
+	Healthy bool
+}
+
 // ExecutionEnginePool provides optimized EL-CL communication with
 // connection pooling, request batching, and caching
 type ExecutionEnginePool struct {
@@ -36,8 +158,11 @@ type ExecutionEnginePool struct {
 	
 	// Request batching
 	pendingNewPayloads chan *newPayloadRequest
+	queueDepth         int
+	queuePolicy        QueuePolicy
 	batchSize          int
 	batchTimeout       time.Duration
+	forceBatching      bool
 	
 	// Metrics
 	requestCount atomic.Uint64
@@ -45,13 +170,25 @@ type ExecutionEnginePool struct {
 	cacheMisses  atomic.Uint64
 	
 	// Header cache for frequent lookups
-	headerCache     sync.Map // map[libcommon.Hash]*types.Header
+	headerCache     *lru.Cache[libcommon.Hash, *types.Header]
 	headerCacheSize int
 	
 	// Block hash cache
-	blockHashCache     sync.Map // map[uint64]libcommon.Hash
+	blockHashCache     *lru.Cache[uint64, libcommon.Hash]
 	blockHashCacheSize int
 	
+	// Body cache, nil unless enabled with WithBodyCache
+	bodyCache *bodyCache
+
+	// Circuit breaker, nil unless enabled with WithCircuitBreaker
+	breaker *circuitBreaker
+	
+	probeThreshold       time.Duration
+	preserveStatsOnReset bool
+
+	metricsInterval       time.Duration
+	metricsReporterActive atomic.Bool
+	
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
@@ -59,10 +196,11 @@ type ExecutionEnginePool struct {
 }
 
 type newPayloadRequest struct {
-	payload        *cltypes.Eth1Block
-	beaconRoot     *libcommon.Hash
-	versionedHashes []libcommon.Hash
-	resultCh       chan newPayloadResult
+	payload           *cltypes.Eth1Block
+	beaconRoot        *libcommon.Hash
+	versionedHashes   []libcommon.Hash
+	executionRequests [][]byte
+	resultCh          chan newPayloadResult
 }
 
 type newPayloadResult struct {
@@ -76,28 +214,74 @@ func NewExecutionEnginePool(
 	batchSize int,
 	batchTimeout time.Duration,
 	logger log.Logger,
+	opts ...ExecutionEnginePoolOption,
 ) *ExecutionEnginePool {
 	ctx, cancel := context.WithCancel(context.Background())
 	
 	pool := &ExecutionEnginePool{
 		engine:             engine,
-		pendingNewPayloads: make(chan *newPayloadRequest, 1000),
+		queueDepth:         defaultQueueDepth,
 		batchSize:          batchSize,
 		batchTimeout:       batchTimeout,
 		headerCacheSize:    1000,
 		blockHashCacheSize: 1000,
+		probeThreshold:     defaultProbeThreshold,
+		metricsInterval:    defaultMetricsInterval,
 		ctx:                ctx,
 		cancel:             cancel,
 		logger:             logger,
 	}
+	for _, opt := range opts {
+		opt(pool)
+	}
+	pool.pendingNewPayloads = make(chan *newPayloadRequest, pool.queueDepth)
+	var err error
+	if pool.headerCache, err = lru.New[libcommon.Hash, *types.Header]("engine_pool_headers", pool.headerCacheSize); err != nil {
+		panic(err)
+	}
+	if pool.blockHashCache, err = lru.New[uint64, libcommon.Hash]("engine_pool_block_hashes", pool.blockHashCacheSize); err != nil {
+		panic(err)
+	}
 	
 	// Start batch processor
 	pool.wg.Add(1)
 	go pool.processBatches()
+	pool.startMetricsReporter()
 	
 	return pool
 }
 
+// startMetricsReporter starts publishing the counters every metricsInterval
+// until the pool is closed. It does nothing if the reporter already runs or
+// publishing is disabled.
+func (p *ExecutionEnginePool) startMetricsReporter() {
+	if p.metricsInterval <= 0 || !p.metricsReporterActive.CompareAndSwap(false, true) {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(p.metricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.publishMetrics()
+			}
+		}
+	}()
+}
+
+// publishMetrics sets the counter gauges to the current Stats
+func (p *ExecutionEnginePool) publishMetrics() {
+	requestCount, cacheHits, cacheMisses, _ := p.Stats()
+	enginePoolRequestsGauge.SetUint64(requestCount)
+	enginePoolCacheHitsGauge.SetUint64(cacheHits)
+	enginePoolCacheMissesGauge.SetUint64(cacheMisses)
+}
+
 // processBatches handles batched NewPayload requests
 func (p *ExecutionEnginePool) processBatches() {
 	defer p.wg.Done()
@@ -114,7 +298,7 @@ func (p *ExecutionEnginePool) processBatches() {
 		
 		// Process all requests in the batch
 		for _, req := range batch {
-			invalid, err := p.engine.NewPayload(p.ctx, req.payload, req.beaconRoot, req.versionedHashes)
+			invalid, err := p.engine.NewPayload(p.ctx, req.payload, req.beaconRoot, req.versionedHashes, req.executionRequests)
 			req.resultCh <- newPayloadResult{invalid: invalid, err: err}
 			close(req.resultCh)
 		}
@@ -128,6 +312,7 @@ func (p *ExecutionEnginePool) processBatches() {
 			processBatch()
 			return
 		case req := <-p.pendingNewPayloads:
+			enginePoolQueueDepthGauge.SetInt(len(p.pendingNewPayloads))
 			batch = append(batch, req)
 			if len(batch) >= p.batchSize {
 				processBatch()
@@ -138,28 +323,105 @@ func (p *ExecutionEnginePool) processBatches() {
 	}
 }
 
-// NewPayload submits a new payload with batching optimization
-func (p *ExecutionEnginePool) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash) (bool, error) {
+// guard sends call to the engine unless the circuit breaker is open, and
+// records its outcome. Errors caused by the caller giving up or by a full
+// batch queue, and verdicts of the engine on the request, are not held
+// against the engine.
+func (p *ExecutionEnginePool) guard(ctx context.Context, call func() error) error {
+	if err := p.breaker.allow(); err != nil {
+		return err
+	}
+	err := call()
+	switch {
+	case err == nil:
+		p.breaker.success()
+	case ctx.Err() != nil, errors.Is(err, ErrEnginePoolBusy), !engineFailure(err):
+		p.breaker.release()
+	default:
+		p.breaker.failure()
+	}
+	var rejected *invalidPayloadError
+	if errors.As(err, &rejected) {
+		return rejected.err
+	}
+	return err
+}
+
+// invalidPayloadError wraps the error returned with an invalid payload, an
+// answer of the engine rather than a failure
+type invalidPayloadError struct {
+	err error
+}
+
+func (e *invalidPayloadError) Error() string { return e.err.Error() }
+
+func (e *invalidPayloadError) Unwrap() error { return e.err }
+
+// engineFailure reports whether err, returned by a call to the engine, is an
+// engine failure: a transport error, a timeout or an internal error. Invalid
+// payloads and Engine API errors answering the request are not.
+func engineFailure(err error) bool {
+	var rejected *invalidPayloadError
+	if errors.As(err, &rejected) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		// invalid params, and the -38xxx Engine API errors such as an
+		// unknown payload or an invalid forkchoice state
+		code := rpcErr.ErrorCode()
+		return code != -32602 && (code > -38000 || code <= -39000)
+	}
+	return true
+}
+
+// NewPayload submits a new payload with batching optimization. Execution
+// requests passed with a payload from before Electra are rejected without
+// reaching the engine.
+func (p *ExecutionEnginePool) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (invalid bool, err error) {
 	p.requestCount.Add(1)
-	
+	if err := checkExecutionRequests(payload, executionRequests); err != nil {
+		return false, err
+	}
+	err = p.guard(ctx, func() (err error) {
+		invalid, err = p.newPayload(ctx, payload, beaconParentRoot, versionedHashes, executionRequests)
+		if invalid && err != nil {
+			return &invalidPayloadError{err: err}
+		}
+		return err
+	})
+	return invalid, err
+}
+
+func (p *ExecutionEnginePool) newPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error) {
 	// For direct execution client, bypass batching for better latency
-	if p.engine.SupportInsertion() {
-		return p.engine.NewPayload(ctx, payload, beaconParentRoot, versionedHashes)
+	if p.engine.SupportInsertion() && !p.forceBatching {
+		return p.engine.NewPayload(ctx, payload, beaconParentRoot, versionedHashes, executionRequests)
 	}
 	
 	// Use batching for RPC clients
 	req := &newPayloadRequest{
-		payload:        payload,
-		beaconRoot:     beaconParentRoot,
-		versionedHashes: versionedHashes,
-		resultCh:       make(chan newPayloadResult, 1),
+		payload:           payload,
+		beaconRoot:        beaconParentRoot,
+		versionedHashes:   versionedHashes,
+		executionRequests: executionRequests,
+		resultCh:          make(chan newPayloadResult, 1),
 	}
 	
-	select {
-	case p.pendingNewPayloads <- req:
-	case <-ctx.Done():
-		return false, ctx.Err()
+	if p.queuePolicy == QueuePolicyFailFast {
+		select {
+		case p.pendingNewPayloads <- req:
+		default:
+			return false, ErrEnginePoolBusy
+		}
+	} else {
+		select {
+		case p.pendingNewPayloads <- req:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
 	}
+	enginePoolQueueDepthGauge.SetInt(len(p.pendingNewPayloads))
 	
 	select {
 	case result := <-req.resultCh:
@@ -170,8 +432,12 @@ func (p *ExecutionEnginePool) NewPayload(ctx context.Context, payload *cltypes.E
 }
 
 // ForkChoiceUpdate forwards to underlying engine
-func (p *ExecutionEnginePool) ForkChoiceUpdate(ctx context.Context, finalized libcommon.Hash, head libcommon.Hash, attributes *engine_types.PayloadAttributes) ([]byte, error) {
-	return p.engine.ForkChoiceUpdate(ctx, finalized, head, attributes)
+func (p *ExecutionEnginePool) ForkChoiceUpdate(ctx context.Context, finalized libcommon.Hash, head libcommon.Hash, attributes *engine_types.PayloadAttributes) (payloadID []byte, err error) {
+	err = p.guard(ctx, func() (err error) {
+		payloadID, err = p.engine.ForkChoiceUpdate(ctx, finalized, head, attributes)
+		return err
+	})
+	return payloadID, err
 }
 
 // SupportInsertion forwards to underlying engine
@@ -181,42 +447,307 @@ func (p *ExecutionEnginePool) SupportInsertion() bool {
 
 // InsertBlocks forwards to underlying engine
 func (p *ExecutionEnginePool) InsertBlocks(ctx context.Context, blocks []*types.Block, wait bool) error {
-	return p.engine.InsertBlocks(ctx, blocks, wait)
+	return p.guard(ctx, func() error {
+		return p.engine.InsertBlocks(ctx, blocks, wait)
+	})
 }
 
 // InsertBlock forwards to underlying engine
 func (p *ExecutionEnginePool) InsertBlock(ctx context.Context, block *types.Block) error {
-	return p.engine.InsertBlock(ctx, block)
+	return p.guard(ctx, func() error {
+		return p.engine.InsertBlock(ctx, block)
+	})
 }
 
 // CurrentHeader with caching
-func (p *ExecutionEnginePool) CurrentHeader(ctx context.Context) (*types.Header, error) {
-	return p.engine.CurrentHeader(ctx)
+func (p *ExecutionEnginePool) CurrentHeader(ctx context.Context) (header *types.Header, err error) {
+	err = p.guard(ctx, func() (err error) {
+		header, err = p.engine.CurrentHeader(ctx)
+		return err
+	})
+	if err != nil || header == nil {
+		return header, err
+	}
+	p.cacheHeader(header)
+	return header, nil
+}
+
+// GetHeaderByHash serves the header from the header cache, fetching and
+// caching it on a miss
+func (p *ExecutionEnginePool) GetHeaderByHash(ctx context.Context, hash libcommon.Hash) (*types.Header, error) {
+	if header, ok := p.cachedHeader(hash); ok {
+		return header, nil
+	}
+	return p.fetchHeader(ctx, hash)
+}
+
+// fetchHeader gets a header from the engine and caches it if known
+func (p *ExecutionEnginePool) fetchHeader(ctx context.Context, hash libcommon.Hash) (header *types.Header, err error) {
+	err = p.guard(ctx, func() (err error) {
+		header, err = p.engine.GetHeaderByHash(ctx, hash)
+		return err
+	})
+	if err != nil || header == nil {
+		return header, err
+	}
+	p.cacheHeader(header)
+	return header, nil
+}
+
+// warmHeadersConcurrency bounds the header requests of WarmHeaders in flight
+const warmHeadersConcurrency = 8
+
+// WarmHeaders fetches the headers with the given hashes that aren't cached
+// yet, concurrently, and caches them so that later lookups are hits. The
+// cache keeps its size bound: warming more headers than it holds evicts the
+// least recently used ones. Unknown hashes are skipped. The first error, or
+// ctx being done, stops the warming and is returned. Warming isn't counted in
+// the cache stats.
+func (p *ExecutionEnginePool) WarmHeaders(ctx context.Context, hashes []libcommon.Hash) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(warmHeadersConcurrency)
+	for _, hash := range hashes {
+		if gctx.Err() != nil {
+			break
+		}
+		if p.headerCache.Contains(hash) {
+			continue
+		}
+		g.Go(func() error {
+			_, err := p.fetchHeader(gctx, hash)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// cacheHeader stores header in the header and block hash caches
+func (p *ExecutionEnginePool) cacheHeader(header *types.Header) {
+	hash := header.Hash()
+	p.headerCache.Add(hash, header)
+	p.blockHashCache.Add(header.Number.Uint64(), hash)
+}
+
+// cachedHeader looks up a header by hash, counting the hit or miss
+func (p *ExecutionEnginePool) cachedHeader(hash libcommon.Hash) (*types.Header, bool) {
+	header, ok := p.headerCache.Get(hash)
+	p.countCacheLookup(ok)
+	return header, ok
+}
+
+// cachedBlockHash looks up a block hash by number, counting the hit or miss
+func (p *ExecutionEnginePool) cachedBlockHash(number uint64) (libcommon.Hash, bool) {
+	hash, ok := p.blockHashCache.Get(number)
+	p.countCacheLookup(ok)
+	return hash, ok
+}
+
+func (p *ExecutionEnginePool) countCacheLookup(hit bool) {
+	if hit {
+		p.cacheHits.Add(1)
+	} else {
+		p.cacheMisses.Add(1)
+	}
+}
+
+// Reset flushes the header, block hash and body caches, e.g. after a reorg deeper
+// than they cover, and zeroes the counters unless WithPreservedStatsOnReset
+// was given. It is safe to call concurrently with lookups, which either see
+// the old entries or miss.
+func (p *ExecutionEnginePool) Reset() {
+	p.headerCache.Purge()
+	p.blockHashCache.Purge()
+	if p.bodyCache != nil {
+		p.bodyCache.purge()
+	}
+	if p.preserveStatsOnReset {
+		return
+	}
+	p.requestCount.Store(0)
+	p.cacheHits.Store(0)
+	p.cacheMisses.Store(0)
 }
 
 // IsCanonicalHash forwards to underlying engine
-func (p *ExecutionEnginePool) IsCanonicalHash(ctx context.Context, hash libcommon.Hash) (bool, error) {
-	return p.engine.IsCanonicalHash(ctx, hash)
+func (p *ExecutionEnginePool) IsCanonicalHash(ctx context.Context, hash libcommon.Hash) (canonical bool, err error) {
+	err = p.guard(ctx, func() (err error) {
+		canonical, err = p.engine.IsCanonicalHash(ctx, hash)
+		return err
+	})
+	return canonical, err
 }
 
 // Ready forwards to underlying engine
-func (p *ExecutionEnginePool) Ready(ctx context.Context) (bool, error) {
-	return p.engine.Ready(ctx)
+func (p *ExecutionEnginePool) Ready(ctx context.Context) (ready bool, err error) {
+	err = p.guard(ctx, func() (err error) {
+		ready, err = p.engine.Ready(ctx)
+		return err
+	})
+	return ready, err
 }
 
-// GetBodiesByRange forwards to underlying engine
+// Probe checks that the execution engine is responsive, not just ready, by
+// timing a CurrentHeader round trip. The engine is healthy if the call
+// succeeds within the probe threshold; a failed call is returned as an error
+// together with an unhealthy result.
+func (p *ExecutionEnginePool) Probe(ctx context.Context) (ProbeResult, error) {
+	start := time.Now()
+	_, err := p.engine.CurrentHeader(ctx)
+	result := ProbeResult{Latency: time.Since(start)}
+	result.Healthy = err == nil && result.Latency <= p.probeThreshold
+
+	enginePoolProbeLatency.ObserveDuration(start)
+	if result.Healthy {
+		enginePoolProbeHealthyGauge.SetInt(1)
+	} else {
+		enginePoolProbeHealthyGauge.SetInt(0)
+	}
+	return result, err
+}
+
+// GetBodiesByRange serves the cached bodies of the range and fetches only the
+// missing runs from the underlying engine. Like the engine, it returns fewer
+// bodies than requested if the end of the range is unknown.
 func (p *ExecutionEnginePool) GetBodiesByRange(ctx context.Context, start, count uint64) ([]*types.RawBody, error) {
-	return p.engine.GetBodiesByRange(ctx, start, count)
+	if p.bodyCache == nil {
+		return p.getBodiesByRange(ctx, start, count)
+	}
+	bodies := make([]*types.RawBody, 0, count)
+	for i := uint64(0); i < count; {
+		if body, ok := p.bodyCache.get(start + i); ok {
+			p.countCacheLookup(true)
+			bodies = append(bodies, body)
+			i++
+			continue
+		}
+		// fetch the whole run of missing bodies at once
+		run := uint64(1)
+		for i+run < count {
+			if _, ok := p.bodyCache.get(start + i + run); ok {
+				break
+			}
+			run++
+		}
+		for j := uint64(0); j < run; j++ {
+			p.countCacheLookup(false)
+		}
+		fetched, err := p.getBodiesByRange(ctx, start+i, run)
+		if err != nil {
+			return nil, err
+		}
+		for j, body := range fetched {
+			if body != nil {
+				p.bodyCache.add(start+i+uint64(j), body)
+			}
+		}
+		bodies = append(bodies, fetched...)
+		if uint64(len(fetched)) < run {
+			break
+		}
+		i += run
+	}
+	return bodies, nil
 }
 
-// GetBodiesByHashes forwards to underlying engine
+func (p *ExecutionEnginePool) getBodiesByRange(ctx context.Context, start, count uint64) (bodies []*types.RawBody, err error) {
+	err = p.guard(ctx, func() (err error) {
+		bodies, err = p.engine.GetBodiesByRange(ctx, start, count)
+		return err
+	})
+	return bodies, err
+}
+
+// GetBodiesByHashes requests each distinct hash once from the underlying
+// engine, serving the bodies in the body cache from memory, and returns the
+// bodies in the order of hashes, duplicates included. Bodies the engine
+// doesn't know are nil.
 func (p *ExecutionEnginePool) GetBodiesByHashes(ctx context.Context, hashes []libcommon.Hash) ([]*types.RawBody, error) {
-	return p.engine.GetBodiesByHashes(ctx, hashes)
+	found := make(map[libcommon.Hash]*types.RawBody, len(hashes))
+	var missing []libcommon.Hash
+	for _, hash := range hashes {
+		if _, ok := found[hash]; ok {
+			continue
+		}
+		body, ok := p.cachedBodyByHash(hash)
+		if p.bodyCache != nil {
+			p.countCacheLookup(ok)
+		}
+		if !ok {
+			missing = append(missing, hash)
+		}
+		found[hash] = body
+	}
+
+	if len(missing) > 0 {
+		var fetched []*types.RawBody
+		err := p.guard(ctx, func() (err error) {
+			fetched, err = p.engine.GetBodiesByHashes(ctx, missing)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, body := range fetched {
+			if i >= len(missing) {
+				break
+			}
+			found[missing[i]] = body
+			p.cacheBodyByHash(missing[i], body)
+		}
+	}
+
+	bodies := make([]*types.RawBody, len(hashes))
+	for i, hash := range hashes {
+		bodies[i] = found[hash]
+	}
+	return bodies, nil
+}
+
+// canonicalNumber returns the number of the block with the given hash if both
+// its header and the canonical hash at its number are cached. The body cache is
+// keyed by number, so only canonical blocks can be looked up in it.
+func (p *ExecutionEnginePool) canonicalNumber(hash libcommon.Hash) (uint64, bool) {
+	header, ok := p.headerCache.Get(hash)
+	if !ok {
+		return 0, false
+	}
+	number := header.Number.Uint64()
+	canonical, ok := p.blockHashCache.Get(number)
+	return number, ok && canonical == hash
+}
+
+// cachedBodyByHash looks up the body of a cached canonical block
+func (p *ExecutionEnginePool) cachedBodyByHash(hash libcommon.Hash) (*types.RawBody, bool) {
+	if p.bodyCache == nil {
+		return nil, false
+	}
+	number, ok := p.canonicalNumber(hash)
+	if !ok {
+		return nil, false
+	}
+	return p.bodyCache.get(number)
+}
+
+// cacheBodyByHash caches the body of a cached canonical block
+func (p *ExecutionEnginePool) cacheBodyByHash(hash libcommon.Hash, body *types.RawBody) {
+	if p.bodyCache == nil || body == nil {
+		return
+	}
+	if number, ok := p.canonicalNumber(hash); ok {
+		p.bodyCache.add(number, body)
+	}
 }
 
 // HasBlock forwards to underlying engine
-func (p *ExecutionEnginePool) HasBlock(ctx context.Context, hash libcommon.Hash) (bool, error) {
-	return p.engine.HasBlock(ctx, hash)
+func (p *ExecutionEnginePool) HasBlock(ctx context.Context, hash libcommon.Hash) (has bool, err error) {
+	err = p.guard(ctx, func() (err error) {
+		has, err = p.engine.HasBlock(ctx, hash)
+		return err
+	})
+	return has, err
 }
 
 // FrozenBlocks forwards to underlying engine
@@ -225,18 +756,23 @@ func (p *ExecutionEnginePool) FrozenBlocks(ctx context.Context) uint64 {
 }
 
 // GetAssembledBlock forwards to underlying engine
-func (p *ExecutionEnginePool) GetAssembledBlock(ctx context.Context, id []byte) (*cltypes.Eth1Block, *engine_types.BlobsBundleV1, *big.Int, error) {
-	return p.engine.GetAssembledBlock(ctx, id)
+func (p *ExecutionEnginePool) GetAssembledBlock(ctx context.Context, id []byte) (block *cltypes.Eth1Block, blobs *engine_types.BlobsBundleV1, value *big.Int, err error) {
+	err = p.guard(ctx, func() (err error) {
+		block, blobs, value, err = p.engine.GetAssembledBlock(ctx, id)
+		return err
+	})
+	return block, blobs, value, err
 }
 
-// Close stops the pool and waits for pending requests
+// Close stops the pool and its metrics reporter, and waits for pending requests
 func (p *ExecutionEnginePool) Close() {
 	p.cancel()
 	p.wg.Wait()
 }
 
-// Stats returns pool statistics
-func (p *ExecutionEnginePool) Stats() (requestCount, cacheHits, cacheMisses uint64) {
-	return p.requestCount.Load(), p.cacheHits.Load(), p.cacheMisses.Load()
+// Stats returns pool statistics and the circuit breaker state, which is
+// always CircuitClosed unless enabled with WithCircuitBreaker
+func (p *ExecutionEnginePool) Stats() (requestCount, cacheHits, cacheMisses uint64, circuit CircuitState) {
+	return p.requestCount.Load(), p.cacheHits.Load(), p.cacheMisses.Load(), p.breaker.currentState()
 }
 
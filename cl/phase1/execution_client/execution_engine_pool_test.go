@@ -0,0 +1,661 @@
+package execution_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/rpc"
+)
+
+// blockingEngine is an RPC-like engine whose NewPayload blocks until released
+type blockingEngine struct {
+	ExecutionEngine
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingEngine() *blockingEngine {
+	return &blockingEngine{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (e *blockingEngine) SupportInsertion() bool { return false }
+
+func (e *blockingEngine) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error) {
+	e.started <- struct{}{}
+	<-e.release
+	return false, nil
+}
+
+// saturate occupies the batcher with one request and fills the queue of a
+// pool with queue depth 1, returning the results of both requests
+func saturate(t *testing.T, pool *ExecutionEnginePool, engine *blockingEngine) chan error {
+	t.Helper()
+	results := make(chan error, 2)
+	submit := func() {
+		_, err := pool.NewPayload(context.Background(), &cltypes.Eth1Block{}, nil, nil, nil)
+		results <- err
+	}
+	go submit()
+	<-engine.started
+	go submit()
+	require.Eventually(t, func() bool { return len(pool.pendingNewPayloads) == 1 }, time.Second, time.Millisecond)
+	return results
+}
+
+func TestExecutionEnginePoolQueuePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy QueuePolicy
+		err    error
+	}{
+		{"block", QueuePolicyBlock, context.DeadlineExceeded},
+		{"fail-fast", QueuePolicyFailFast, ErrEnginePoolBusy},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := newBlockingEngine()
+			pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithQueueDepth(1), WithQueuePolicy(tc.policy))
+			results := saturate(t, pool, engine)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := pool.NewPayload(ctx, &cltypes.Eth1Block{}, nil, nil, nil)
+			require.True(t, errors.Is(err, tc.err), "got %v", err)
+			if tc.policy == QueuePolicyFailFast {
+				require.Less(t, time.Since(start), 50*time.Millisecond)
+			}
+
+			close(engine.release)
+			require.NoError(t, <-results)
+			require.NoError(t, <-results)
+			pool.Close()
+		})
+	}
+}
+
+func TestExecutionEnginePoolCacheEviction(t *testing.T) {
+	const capacity = 4
+	pool := NewExecutionEnginePool(newBlockingEngine(), 1, time.Hour, log.New(), WithCacheSizes(capacity, capacity))
+	defer pool.Close()
+
+	headers := make([]*types.Header, 3*capacity)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i))}
+		pool.cacheHeader(headers[i])
+		require.LessOrEqual(t, pool.headerCache.Len(), capacity)
+		require.LessOrEqual(t, pool.blockHashCache.Len(), capacity)
+		// keep the first header hot
+		_, ok := pool.cachedHeader(headers[0].Hash())
+		require.True(t, ok)
+	}
+
+	// the least recently used headers were evicted first
+	for i, header := range headers {
+		_, ok := pool.cachedHeader(header.Hash())
+		require.Equal(t, i == 0 || i >= len(headers)-capacity+1, ok, "header %d", i)
+	}
+	for i := range headers {
+		_, ok := pool.cachedBlockHash(uint64(i))
+		require.Equal(t, i >= len(headers)-capacity, ok, "block hash %d", i)
+	}
+
+	_, hits, misses, _ := pool.Stats()
+	require.Equal(t, uint64(len(headers)+capacity+capacity), hits)
+	require.Equal(t, uint64(len(headers)-capacity+len(headers)-capacity), misses)
+}
+
+func TestExecutionEnginePoolMetricsReporter(t *testing.T) {
+	pool := NewExecutionEnginePool(newBlockingEngine(), 1, time.Hour, log.New(), WithMetricsInterval(5*time.Millisecond))
+	// starting again doesn't add a second reporter
+	pool.startMetricsReporter()
+	require.True(t, pool.metricsReporterActive.Load())
+
+	header := &types.Header{Number: big.NewInt(1)}
+	pool.requestCount.Add(3)
+	_, ok := pool.cachedHeader(header.Hash())
+	require.False(t, ok)
+	pool.cacheHeader(header)
+	_, ok = pool.cachedHeader(header.Hash())
+	require.True(t, ok)
+
+	require.Eventually(t, func() bool {
+		return enginePoolRequestsGauge.GetValue() == 3 &&
+			enginePoolCacheHitsGauge.GetValue() == 1 &&
+			enginePoolCacheMissesGauge.GetValue() == 1
+	}, time.Second, time.Millisecond)
+
+	// no more updates once closed
+	pool.Close()
+	pool.requestCount.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, float64(3), enginePoolRequestsGauge.GetValue())
+}
+
+// slowEngine answers CurrentHeader after a fixed delay
+type slowEngine struct {
+	ExecutionEngine
+	delay time.Duration
+	err   error
+}
+
+func (e *slowEngine) CurrentHeader(ctx context.Context) (*types.Header, error) {
+	time.Sleep(e.delay)
+	return &types.Header{Number: big.NewInt(1)}, e.err
+}
+
+func TestExecutionEnginePoolProbe(t *testing.T) {
+	const threshold = 20 * time.Millisecond
+	errUnavailable := errors.New("unavailable")
+	for _, tc := range []struct {
+		name    string
+		engine  *slowEngine
+		healthy bool
+	}{
+		{"fast", &slowEngine{}, true},
+		{"slow", &slowEngine{delay: 2 * threshold}, false},
+		{"failing", &slowEngine{err: errUnavailable}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := NewExecutionEnginePool(tc.engine, 1, time.Hour, log.New(), WithProbeThreshold(threshold))
+			defer pool.Close()
+
+			result, err := pool.Probe(context.Background())
+			require.ErrorIs(t, err, tc.engine.err)
+			require.Equal(t, tc.healthy, result.Healthy)
+			require.GreaterOrEqual(t, result.Latency, tc.engine.delay)
+		})
+	}
+}
+
+func TestExecutionEnginePoolReset(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     []ExecutionEnginePoolOption
+		preserve bool
+	}{
+		{"reset stats", nil, false},
+		{"preserve stats", []ExecutionEnginePoolOption{WithPreservedStatsOnReset()}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := NewExecutionEnginePool(newBlockingEngine(), 1, time.Hour, log.New(), tc.opts...)
+			defer pool.Close()
+
+			header := &types.Header{Number: big.NewInt(7)}
+			pool.cacheHeader(header)
+			_, ok := pool.cachedHeader(header.Hash())
+			require.True(t, ok)
+			_, ok = pool.cachedBlockHash(7)
+			require.True(t, ok)
+
+			pool.Reset()
+			_, hits, misses, _ := pool.Stats()
+			if tc.preserve {
+				require.Equal(t, uint64(2), hits)
+			} else {
+				require.Zero(t, hits)
+			}
+			require.Zero(t, misses)
+
+			_, ok = pool.cachedHeader(header.Hash())
+			require.False(t, ok)
+			_, ok = pool.cachedBlockHash(7)
+			require.False(t, ok)
+			_, _, misses, _ = pool.Stats()
+			require.Equal(t, uint64(2), misses)
+		})
+	}
+}
+
+func TestExecutionEnginePoolConcurrentReset(t *testing.T) {
+	pool := NewExecutionEnginePool(newBlockingEngine(), 1, time.Hour, log.New())
+	defer pool.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			header := &types.Header{Number: big.NewInt(int64(i))}
+			pool.cacheHeader(header)
+			pool.cachedHeader(header.Hash())
+			pool.cachedBlockHash(uint64(i))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		pool.Reset()
+	}
+	<-done
+}
+
+// bodiesEngine serves bodies for blocks below head, recording the requested ranges
+type bodiesEngine struct {
+	ExecutionEngine
+	head   uint64
+	ranges [][2]uint64
+}
+
+func (e *bodiesEngine) GetBodiesByRange(ctx context.Context, start, count uint64) ([]*types.RawBody, error) {
+	e.ranges = append(e.ranges, [2]uint64{start, count})
+	var bodies []*types.RawBody
+	for n := start; n < start+count && n < e.head; n++ {
+		bodies = append(bodies, &types.RawBody{Transactions: [][]byte{{byte(n)}}})
+	}
+	return bodies, nil
+}
+
+func TestExecutionEnginePoolBodyCache(t *testing.T) {
+	engine := &bodiesEngine{head: 20}
+	pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithBodyCache(1<<20))
+	defer pool.Close()
+
+	check := func(start, count uint64, expected int) {
+		t.Helper()
+		bodies, err := pool.GetBodiesByRange(context.Background(), start, count)
+		require.NoError(t, err)
+		require.Len(t, bodies, expected)
+		for i, body := range bodies {
+			require.Equal(t, [][]byte{{byte(start + uint64(i))}}, body.Transactions)
+		}
+	}
+
+	check(0, 10, 10)
+	check(5, 10, 10)
+	check(2, 6, 6)
+	// only the missing head of the range is fetched, and the unknown tail is cut off
+	check(12, 10, 8)
+	require.Equal(t, [][2]uint64{{0, 10}, {10, 5}, {15, 7}}, engine.ranges)
+
+	_, hits, misses, _ := pool.Stats()
+	require.Equal(t, uint64(5+6+3), hits)
+	require.Equal(t, uint64(10+5+7), misses)
+
+	pool.Reset()
+	check(0, 2, 2)
+	require.Equal(t, [2]uint64{0, 2}, engine.ranges[len(engine.ranges)-1])
+}
+
+func TestBodyCacheByteBound(t *testing.T) {
+	body := func() *types.RawBody { return &types.RawBody{Transactions: [][]byte{make([]byte, 100)}} }
+	size := body().EncodingSize()
+	cache := newBodyCache(3 * size)
+
+	for n := uint64(0); n < 5; n++ {
+		cache.add(n, body())
+		require.LessOrEqual(t, cache.size, 3*size)
+	}
+	for n := uint64(0); n < 5; n++ {
+		_, ok := cache.get(n)
+		require.Equal(t, n >= 2, ok, "body %d", n)
+	}
+
+	// bodies larger than the cache are not kept
+	cache.add(10, &types.RawBody{Transactions: [][]byte{make([]byte, 4*size)}})
+	_, ok := cache.get(10)
+	require.False(t, ok)
+	require.Equal(t, 3*size, cache.size)
+}
+
+// insertingEngine is an insertion-capable engine counting NewPayload calls
+type insertingEngine struct {
+	ExecutionEngine
+	calls atomic.Int32
+}
+
+func (e *insertingEngine) SupportInsertion() bool { return true }
+
+func (e *insertingEngine) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error) {
+	e.calls.Add(1)
+	return false, nil
+}
+
+func TestExecutionEnginePoolForceBatching(t *testing.T) {
+	const batchSize = 3
+	for _, tc := range []struct {
+		name    string
+		opts    []ExecutionEnginePoolOption
+		batched bool
+	}{
+		{"direct", nil, false},
+		{"forced batching", []ExecutionEnginePoolOption{WithForceBatching()}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := &insertingEngine{}
+			pool := NewExecutionEnginePool(engine, batchSize, time.Hour, log.New(), tc.opts...)
+			defer pool.Close()
+
+			results := make(chan error, batchSize)
+			submit := func() {
+				_, err := pool.NewPayload(context.Background(), &cltypes.Eth1Block{}, nil, nil, nil)
+				results <- err
+			}
+			for i := 0; i < batchSize-1; i++ {
+				go submit()
+			}
+			if !tc.batched {
+				for i := 0; i < batchSize-1; i++ {
+					require.NoError(t, <-results)
+				}
+				require.Equal(t, int32(batchSize-1), engine.calls.Load())
+				return
+			}
+
+			// the requests wait for the batch to fill up
+			time.Sleep(20 * time.Millisecond)
+			require.Zero(t, engine.calls.Load())
+			go submit()
+			for i := 0; i < batchSize; i++ {
+				require.NoError(t, <-results)
+			}
+			require.Equal(t, int32(batchSize), engine.calls.Load())
+		})
+	}
+}
+
+// flakyEngine fails CurrentHeader with err while it is set, counting calls
+type flakyEngine struct {
+	ExecutionEngine
+	err   error
+	calls int
+}
+
+func (e *flakyEngine) CurrentHeader(ctx context.Context) (*types.Header, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &types.Header{Number: big.NewInt(1)}, nil
+}
+
+func TestExecutionEnginePoolCircuitBreaker(t *testing.T) {
+	const threshold, cooldown = 3, time.Minute
+	errDown := errors.New("engine down")
+	engine := &flakyEngine{err: errDown}
+	pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithCircuitBreaker(threshold, cooldown))
+	defer pool.Close()
+	now := time.Now()
+	pool.breaker.now = func() time.Time { return now }
+
+	call := func() error {
+		_, err := pool.CurrentHeader(context.Background())
+		return err
+	}
+	state := func() CircuitState {
+		_, _, _, circuit := pool.Stats()
+		return circuit
+	}
+
+	// closed: failures reach the engine until the threshold
+	for i := 0; i < threshold; i++ {
+		require.Equal(t, CircuitClosed, state())
+		require.ErrorIs(t, call(), errDown)
+	}
+	require.Equal(t, threshold, engine.calls)
+
+	// open: calls fail fast without reaching the engine
+	require.Equal(t, CircuitOpen, state())
+	require.ErrorIs(t, call(), ErrEngineCircuitOpen)
+	require.Equal(t, threshold, engine.calls)
+
+	// half-open: a failed probe reopens the breaker for another cooldown
+	now = now.Add(cooldown)
+	require.ErrorIs(t, call(), errDown)
+	require.Equal(t, CircuitOpen, state())
+	now = now.Add(cooldown / 2)
+	require.ErrorIs(t, call(), ErrEngineCircuitOpen)
+	require.Equal(t, threshold+1, engine.calls)
+
+	// a caller giving up during the probe doesn't count against the engine
+	now = now.Add(cooldown)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := pool.CurrentHeader(ctx)
+	require.ErrorIs(t, err, errDown)
+	require.Equal(t, CircuitHalfOpen, state())
+
+	// a successful probe closes the breaker and resets the failure count
+	engine.err = nil
+	require.NoError(t, call())
+	require.Equal(t, CircuitClosed, state())
+	engine.err = errDown
+	for i := 0; i < threshold-1; i++ {
+		require.ErrorIs(t, call(), errDown)
+	}
+	require.Equal(t, CircuitClosed, state())
+}
+
+// rejectingEngine is an insertion-capable engine rejecting every payload, and
+// failing CurrentHeader with err while it is set
+type rejectingEngine struct {
+	flakyEngine
+	payloads int
+}
+
+func (e *rejectingEngine) SupportInsertion() bool { return true }
+
+func (e *rejectingEngine) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error) {
+	e.payloads++
+	return true, errors.New("block hash mismatch")
+}
+
+func TestExecutionEnginePoolCircuitBreakerVerdicts(t *testing.T) {
+	const threshold = 2
+	engine := &rejectingEngine{}
+	pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithCircuitBreaker(threshold, time.Minute))
+	defer pool.Close()
+	state := func() CircuitState {
+		_, _, _, circuit := pool.Stats()
+		return circuit
+	}
+	payload := cltypes.NewEth1Block(clparams.DenebVersion, &clparams.MainnetBeaconConfig)
+
+	// invalid payloads are answers of a healthy engine
+	for i := 0; i < 2*threshold; i++ {
+		invalid, err := pool.NewPayload(context.Background(), payload, &libcommon.Hash{}, nil, nil)
+		require.True(t, invalid)
+		require.EqualError(t, err, "block hash mismatch")
+	}
+	require.Equal(t, 2*threshold, engine.payloads)
+	require.Equal(t, CircuitClosed, state())
+
+	// so are Engine API errors answering a request
+	engine.err = &rpc.CustomError{Code: -38002, Message: "Invalid forkchoice state"}
+	for i := 0; i < threshold; i++ {
+		_, err := pool.CurrentHeader(context.Background())
+		require.ErrorIs(t, err, engine.err)
+	}
+	require.Equal(t, CircuitClosed, state())
+
+	// internal errors are engine failures
+	engine.err = fmt.Errorf("execution Client RPC failed: %w", &rpc.CustomError{Code: -32603, Message: "internal error"})
+	for i := 0; i < threshold; i++ {
+		_, err := pool.CurrentHeader(context.Background())
+		require.Error(t, err)
+	}
+	require.Equal(t, CircuitOpen, state())
+	_, err := pool.NewPayload(context.Background(), payload, &libcommon.Hash{}, nil, nil)
+	require.ErrorIs(t, err, ErrEngineCircuitOpen)
+	require.Equal(t, 2*threshold, engine.payloads)
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	require.NoError(t, b.allow())
+	b.failure()
+	require.ErrorIs(t, b.allow(), ErrEngineCircuitOpen)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.allow())
+	require.Equal(t, CircuitHalfOpen, b.currentState())
+	// only one call probes the engine at a time
+	require.ErrorIs(t, b.allow(), ErrEngineCircuitOpen)
+	b.release()
+	require.NoError(t, b.allow())
+	b.success()
+	require.Equal(t, CircuitClosed, b.currentState())
+
+	// a nil breaker is always closed
+	var disabled *circuitBreaker
+	require.NoError(t, disabled.allow())
+	disabled.failure()
+	require.Equal(t, CircuitClosed, disabled.currentState())
+}
+
+// hashBodiesEngine serves a body for every hash, recording the requested hashes
+type hashBodiesEngine struct {
+	ExecutionEngine
+	requests [][]libcommon.Hash
+}
+
+func (e *hashBodiesEngine) GetBodiesByHashes(ctx context.Context, hashes []libcommon.Hash) ([]*types.RawBody, error) {
+	e.requests = append(e.requests, hashes)
+	bodies := make([]*types.RawBody, len(hashes))
+	for i, hash := range hashes {
+		bodies[i] = &types.RawBody{Transactions: [][]byte{hash[:1]}}
+	}
+	return bodies, nil
+}
+
+func TestExecutionEnginePoolGetBodiesByHashes(t *testing.T) {
+	engine := &hashBodiesEngine{}
+	pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithBodyCache(1<<20))
+	defer pool.Close()
+
+	// a canonical block whose body is cached
+	header := &types.Header{Number: big.NewInt(7)}
+	pool.cacheHeader(header)
+	cached := header.Hash()
+	pool.bodyCache.add(7, &types.RawBody{Transactions: [][]byte{{0xca}}})
+
+	a, b := libcommon.Hash{0xa}, libcommon.Hash{0xb}
+	bodies, err := pool.GetBodiesByHashes(context.Background(), []libcommon.Hash{b, cached, a, b, cached, a})
+	require.NoError(t, err)
+	require.Equal(t, [][]libcommon.Hash{{b, a}}, engine.requests)
+	expected := [][]byte{{0xb}, {0xca}, {0xa}, {0xb}, {0xca}, {0xa}}
+	require.Len(t, bodies, len(expected))
+	for i, body := range bodies {
+		require.Equal(t, [][]byte{expected[i]}, body.Transactions, "body %d", i)
+	}
+	_, hits, misses, _ := pool.Stats()
+	require.Equal(t, uint64(1), hits)
+	require.Equal(t, uint64(2), misses)
+
+	// nothing to forward once every body is cached
+	bodies, err = pool.GetBodiesByHashes(context.Background(), []libcommon.Hash{cached, cached})
+	require.NoError(t, err)
+	require.Len(t, bodies, 2)
+	require.Len(t, engine.requests, 1)
+}
+
+// requestsEngine records the execution requests passed with every payload
+type requestsEngine struct {
+	ExecutionEngine
+	insertion bool
+	requests  chan [][]byte
+}
+
+func (e *requestsEngine) SupportInsertion() bool { return e.insertion }
+
+func (e *requestsEngine) NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error) {
+	e.requests <- executionRequests
+	return false, nil
+}
+
+func TestExecutionEnginePoolExecutionRequests(t *testing.T) {
+	executionRequests := [][]byte{{0x00, 0x01}, {0x02, 0x03}}
+	for _, insertion := range []bool{true, false} {
+		engine := &requestsEngine{insertion: insertion, requests: make(chan [][]byte, 1)}
+		pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New())
+
+		electra := cltypes.NewEth1Block(clparams.ElectraVersion, &clparams.MainnetBeaconConfig)
+		_, err := pool.NewPayload(context.Background(), electra, &libcommon.Hash{}, []libcommon.Hash{}, executionRequests)
+		require.NoError(t, err)
+		require.Equal(t, executionRequests, <-engine.requests, "insertion=%v", insertion)
+
+		for _, version := range []clparams.StateVersion{clparams.BellatrixVersion, clparams.DenebVersion} {
+			payload := cltypes.NewEth1Block(version, &clparams.MainnetBeaconConfig)
+			invalid, err := pool.NewPayload(context.Background(), payload, &libcommon.Hash{}, nil, executionRequests)
+			require.ErrorIs(t, err, ErrUnexpectedExecutionRequests)
+			require.False(t, invalid)
+			require.Empty(t, engine.requests)
+
+			_, err = pool.NewPayload(context.Background(), payload, &libcommon.Hash{}, nil, nil)
+			require.NoError(t, err)
+			require.Nil(t, <-engine.requests)
+		}
+		pool.Close()
+	}
+}
+
+// headersEngine serves the headers it knows, counting the requests
+type headersEngine struct {
+	ExecutionEngine
+	headers  map[libcommon.Hash]*types.Header
+	requests atomic.Int32
+}
+
+func (e *headersEngine) GetHeaderByHash(ctx context.Context, hash libcommon.Hash) (*types.Header, error) {
+	e.requests.Add(1)
+	return e.headers[hash], nil
+}
+
+func TestExecutionEnginePoolWarmHeaders(t *testing.T) {
+	engine := &headersEngine{headers: map[libcommon.Hash]*types.Header{}}
+	hashes := make([]libcommon.Hash, 5)
+	for i := range hashes {
+		header := &types.Header{Number: big.NewInt(int64(100 + i))}
+		hashes[i] = header.Hash()
+		engine.headers[hashes[i]] = header
+	}
+	pool := NewExecutionEnginePool(engine, 1, time.Hour, log.New())
+	defer pool.Close()
+
+	// unknown hashes are skipped
+	require.NoError(t, pool.WarmHeaders(context.Background(), append(hashes, libcommon.Hash{0xff})))
+	require.Equal(t, int32(len(hashes)+1), engine.requests.Load())
+	_, hits, misses, _ := pool.Stats()
+	require.Zero(t, hits+misses)
+
+	for i, hash := range hashes {
+		header, err := pool.GetHeaderByHash(context.Background(), hash)
+		require.NoError(t, err)
+		require.Equal(t, uint64(100+i), header.Number.Uint64())
+		number, ok := pool.cachedBlockHash(uint64(100 + i))
+		require.True(t, ok)
+		require.Equal(t, hash, number)
+	}
+	_, hits, misses, _ = pool.Stats()
+	require.Equal(t, uint64(2*len(hashes)), hits)
+	require.Zero(t, misses)
+	require.Equal(t, int32(len(hashes)+1), engine.requests.Load())
+
+	// cached headers aren't fetched again
+	require.NoError(t, pool.WarmHeaders(context.Background(), hashes))
+	require.Equal(t, int32(len(hashes)+1), engine.requests.Load())
+
+	// the cache keeps its bound
+	small := NewExecutionEnginePool(engine, 1, time.Hour, log.New(), WithCacheSizes(3, 3))
+	defer small.Close()
+	require.NoError(t, small.WarmHeaders(context.Background(), hashes))
+	require.Equal(t, 3, small.headerCache.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	requests := engine.requests.Load()
+	fresh := NewExecutionEnginePool(engine, 1, time.Hour, log.New())
+	defer fresh.Close()
+	require.ErrorIs(t, fresh.WarmHeaders(ctx, hashes), context.Canceled)
+	require.Equal(t, requests, engine.requests.Load())
+}
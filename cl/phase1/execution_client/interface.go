@@ -18,12 +18,16 @@ var errContextExceeded = "rpc error: code = DeadlineExceeded desc = context dead
 
 //go:generate mockgen -typed=true -source=./interface.go -destination=./execution_engine_mock.go -package=execution_client . ExecutionEngine
 type ExecutionEngine interface {
-	NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash) (bool, error)
+	// NewPayload imports a payload. executionRequests are the EIP-7685
+	// requests of the block, only allowed for Electra payloads onwards.
+	NewPayload(ctx context.Context, payload *cltypes.Eth1Block, beaconParentRoot *libcommon.Hash, versionedHashes []libcommon.Hash, executionRequests [][]byte) (bool, error)
 	ForkChoiceUpdate(ctx context.Context, finalized libcommon.Hash, head libcommon.Hash, attributes *engine_types.PayloadAttributes) ([]byte, error)
 	SupportInsertion() bool
 	InsertBlocks(ctx context.Context, blocks []*types.Block, wait bool) error
 	InsertBlock(ctx context.Context, block *types.Block) error
 	CurrentHeader(ctx context.Context) (*types.Header, error)
+	// GetHeaderByHash returns the header with the given hash, nil if unknown
+	GetHeaderByHash(ctx context.Context, hash libcommon.Hash) (*types.Header, error)
 	IsCanonicalHash(ctx context.Context, hash libcommon.Hash) (bool, error)
 	Ready(ctx context.Context) (bool, error)
 	// Range methods
@@ -1,5 +1,11 @@
 package rpc_helper
 
+import (
+	"fmt"
+
+	"github.com/erigontech/erigon/cl/clparams"
+)
+
 const EngineNewPayloadV1 = "engine_newPayloadV1"
 const EngineNewPayloadV2 = "engine_newPayloadV2"
 const EngineNewPayloadV3 = "engine_newPayloadV3"
@@ -10,5 +16,36 @@ const ForkChoiceUpdatedV2 = "engine_forkchoiceUpdatedV2"
 const ForkChoiceUpdatedV3 = "engine_forkchoiceUpdatedV3"
 const ForkChoiceUpdatedV4 = "engine_forkchoiceUpdatedV4"
 
+const GetPayloadV1 = "engine_getPayloadV1"
+const GetPayloadV2 = "engine_getPayloadV2"
+const GetPayloadV3 = "engine_getPayloadV3"
+const GetPayloadV4 = "engine_getPayloadV4"
+const GetPayloadV5 = "engine_getPayloadV5"
+
 const GetPayloadBodiesByHashV1 = "engine_getPayloadBodiesByHashV1"
 const GetPayloadBodiesByRangeV1 = "engine_getPayloadBodiesByRangeV1"
+
+// GetBlockByHash is one of the eth methods the engine API endpoint serves
+const GetBlockByHash = "eth_getBlockByHash"
+
+// UnsupportedForkErrorCode is returned by the engine API when a method
+// doesn't serve the fork of the requested payload
+const UnsupportedForkErrorCode = -38005
+
+// GetPayloadMethod returns the engine_getPayload method serving payloads of the given fork
+func GetPayloadMethod(version clparams.StateVersion) (string, error) {
+	switch version {
+	case clparams.BellatrixVersion:
+		return GetPayloadV1, nil
+	case clparams.CapellaVersion:
+		return GetPayloadV2, nil
+	case clparams.DenebVersion:
+		return GetPayloadV3, nil
+	case clparams.ElectraVersion:
+		return GetPayloadV4, nil
+	case clparams.FuluVersion:
+		return GetPayloadV5, nil
+	default:
+		return "", fmt.Errorf("no getPayload method for state version %d", version)
+	}
+}
@@ -0,0 +1,28 @@
+package rpc_helper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon/cl/clparams"
+)
+
+func TestGetPayloadMethod(t *testing.T) {
+	for version, method := range map[clparams.StateVersion]string{
+		clparams.BellatrixVersion: "engine_getPayloadV1",
+		clparams.CapellaVersion:   "engine_getPayloadV2",
+		clparams.DenebVersion:     "engine_getPayloadV3",
+		clparams.ElectraVersion:   "engine_getPayloadV4",
+		clparams.FuluVersion:      "engine_getPayloadV5",
+	} {
+		got, err := GetPayloadMethod(version)
+		require.NoError(t, err)
+		require.Equal(t, method, got, clparams.ClVersionToString(version))
+	}
+
+	for _, version := range []clparams.StateVersion{clparams.Phase0Version, clparams.AltairVersion, clparams.FuluVersion + 1} {
+		_, err := GetPayloadMethod(version)
+		require.Error(t, err)
+	}
+}
@@ -98,7 +98,14 @@ func (f *ForkChoiceStore) OnBlock(ctx context.Context, block *cltypes.SignedBeac
 			}
 		}
 
-		if invalidBlock, err = f.engine.NewPayload(ctx, block.Block.Body.ExecutionPayload, &block.Block.ParentRoot, versionedHashes); err != nil {
+		var executionRequests [][]byte
+		if block.Version() >= clparams.ElectraVersion {
+			if executionRequests, err = block.Block.Body.ExecutionRequests.EngineRequests(); err != nil {
+				return fmt.Errorf("OnBlock: failed to encode execution requests: %v", err)
+			}
+		}
+
+		if invalidBlock, err = f.engine.NewPayload(ctx, block.Block.Body.ExecutionPayload, &block.Block.ParentRoot, versionedHashes, executionRequests); err != nil {
 			if invalidBlock {
 				f.forkGraph.MarkHeaderAsInvalid(blockRoot)
 			}
@@ -0,0 +1,177 @@
+package downgrade
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/erigontech/erigon/cmd/utils"
+	"github.com/erigontech/erigon/turbo/logging"
+)
+
+var BackupsCommand = cli.Command{
+	Name:  "backups",
+	Usage: "clean up or restore the originals kept by downgrade --keep-original",
+	Subcommands: []*cli.Command{
+		{
+			Action: func(cliCtx *cli.Context) error {
+				return backups(cliCtx, "clean")
+			},
+			Name:      "clean",
+			Usage:     "delete the original files kept by a downgrade",
+			ArgsUsage: "<snapshots-dir>",
+			Flags:     []cli.Flag{&DryRunFlag},
+		},
+		{
+			Action: func(cliCtx *cli.Context) error {
+				return backups(cliCtx, "restore")
+			},
+			Name:      "restore",
+			Usage:     "revert a downgrade by moving the original files back in place of the converted ones",
+			ArgsUsage: "<snapshots-dir>",
+			Flags:     []cli.Flag{&DryRunFlag},
+		},
+	},
+	Flags: []cli.Flag{
+		&utils.DataDirFlag,
+		&logging.LogVerbosityFlag,
+		&logging.LogConsoleVerbosityFlag,
+		&logging.LogDirVerbosityFlag,
+	},
+	Description: `Originals kept by "snapshots downgrade --keep-original" carry the backup
+suffix of their format, such as .v11.bak.
+
+Example:
+  snapshots backups clean --dry-run /path/to/snapshots
+  snapshots backups restore /path/to/snapshots`,
+}
+
+// Backup is an original segment or index file kept by a downgrade
+type Backup struct {
+	Path         string
+	OriginalPath string // where the file was before the downgrade
+	// ConvertedPath is where the downgrade put the v1.0 file, which is the
+	// original path unless the file was renamed
+	ConvertedPath string
+}
+
+// FindBackups lists the backups in snapshotsDir, for every registered format
+func FindBackups(snapshotsDir string) ([]Backup, error) {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		for _, f := range segmentFormats {
+			if !strings.HasSuffix(name, f.backupSuffix) {
+				continue
+			}
+			original := strings.TrimSuffix(name, f.backupSuffix)
+			if original == "" {
+				continue
+			}
+			backups = append(backups, Backup{
+				Path:          filepath.Join(snapshotsDir, name),
+				OriginalPath:  filepath.Join(snapshotsDir, original),
+				ConvertedPath: filepath.Join(snapshotsDir, getV10FileName(original)),
+			})
+			break
+		}
+	}
+	return backups, nil
+}
+
+// CleanBackups deletes the backups in snapshotsDir, or only lists them if
+// dryRun is set
+func CleanBackups(snapshotsDir string, dryRun bool) ([]Backup, error) {
+	backups, err := FindBackups(snapshotsDir)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return backups, nil
+	}
+	for i, b := range backups {
+		if err := os.Remove(b.Path); err != nil {
+			return backups[:i], fmt.Errorf("failed to remove %s: %w", filepath.Base(b.Path), err)
+		}
+	}
+	return backups, nil
+}
+
+// RestoreBackups moves the backups in snapshotsDir back to their original
+// path, removing the files converted from them, or only lists them if dryRun
+// is set. Existing files at the original paths are replaced.
+func RestoreBackups(snapshotsDir string, dryRun bool) ([]Backup, error) {
+	backups, err := FindBackups(snapshotsDir)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return backups, nil
+	}
+	for i, b := range backups {
+		if b.ConvertedPath != b.OriginalPath {
+			if err := os.Remove(b.ConvertedPath); err != nil && !os.IsNotExist(err) {
+				return backups[:i], fmt.Errorf("failed to remove %s: %w", filepath.Base(b.ConvertedPath), err)
+			}
+		}
+		if err := os.Rename(b.Path, b.OriginalPath); err != nil {
+			return backups[:i], fmt.Errorf("failed to restore %s: %w", filepath.Base(b.Path), err)
+		}
+	}
+	return backups, nil
+}
+
+func backups(cliCtx *cli.Context, command string) error {
+	var snapshotsDir string
+
+	if cliCtx.Args().Len() > 0 {
+		snapshotsDir = cliCtx.Args().Get(0)
+	} else if dataDir := cliCtx.String(utils.DataDirFlag.Name); dataDir != "" {
+		snapshotsDir = filepath.Join(dataDir, "snapshots")
+	} else {
+		return fmt.Errorf("please provide snapshots directory as argument or use --datadir flag")
+	}
+
+	dryRun := cliCtx.Bool(DryRunFlag.Name)
+
+	var done []Backup
+	var err error
+	switch command {
+	case "clean":
+		done, err = CleanBackups(snapshotsDir, dryRun)
+	case "restore":
+		done, err = RestoreBackups(snapshotsDir, dryRun)
+	default:
+		return fmt.Errorf("unknown backups command %q", command)
+	}
+
+	for _, b := range done {
+		switch {
+		case dryRun && command == "clean":
+			fmt.Printf("  [DRY-RUN] Would remove: %s\n", filepath.Base(b.Path))
+		case dryRun:
+			fmt.Printf("  [DRY-RUN] Would restore: %s -> %s\n", filepath.Base(b.Path), filepath.Base(b.OriginalPath))
+		case command == "clean":
+			fmt.Printf("  Removed: %s\n", filepath.Base(b.Path))
+		default:
+			fmt.Printf("  Restored: %s -> %s\n", filepath.Base(b.Path), filepath.Base(b.OriginalPath))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d backups processed\n", len(done))
+	return nil
+}
@@ -0,0 +1,106 @@
+package downgrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// downgradeWithBackups writes a v1.1 segment and its index into dir, and
+// downgrades it keeping the originals
+func downgradeWithBackups(t *testing.T, dir string) (segment, index []byte) {
+	t.Helper()
+	data := createV10Segment(t, dir, "source.seg", [][]byte{[]byte("word")})
+	require.NoError(t, os.Remove(filepath.Join(dir, "source.seg")))
+	segment = append(make([]byte, v11HeaderSize), data...)
+	index = []byte("v1.1 index")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1.1-000000-000500-headers.seg"), segment, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1.1-000000-000500-headers.idx"), index, 0644))
+
+	plan, err := scanSegments(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.candidates, 1)
+	require.True(t, downgradeSegment(dir, plan.candidates[0], true))
+	// the index rebuilt for the converted segment
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1-000000-000500-headers.idx"), []byte("v1.0 index"), 0644))
+	return segment, index
+}
+
+func TestRestoreBackups(t *testing.T) {
+	dir := t.TempDir()
+	segment, index := downgradeWithBackups(t, dir)
+
+	backups, err := RestoreBackups(dir, true)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.FileExists(t, filepath.Join(dir, "v1-000000-000500-headers.seg"))
+	require.FileExists(t, filepath.Join(dir, "v1.1-000000-000500-headers.seg.v11.bak"))
+
+	backups, err = RestoreBackups(dir, false)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for _, b := range backups {
+		require.NoFileExists(t, b.Path)
+		require.NoFileExists(t, b.ConvertedPath)
+	}
+	restored, err := os.ReadFile(filepath.Join(dir, "v1.1-000000-000500-headers.seg"))
+	require.NoError(t, err)
+	require.Equal(t, segment, restored)
+	restored, err = os.ReadFile(filepath.Join(dir, "v1.1-000000-000500-headers.idx"))
+	require.NoError(t, err)
+	require.Equal(t, index, restored)
+
+	backups, err = FindBackups(dir)
+	require.NoError(t, err)
+	require.Empty(t, backups)
+}
+
+func TestRestoreBackupsInPlace(t *testing.T) {
+	dir := t.TempDir()
+	data := createV10Segment(t, dir, "source.seg", [][]byte{[]byte("word")})
+	require.NoError(t, os.Remove(filepath.Join(dir, "source.seg")))
+	// v1.1 content behind a v1 filename is converted without a rename
+	segment := append(make([]byte, v11HeaderSize), data...)
+	path := filepath.Join(dir, "v1-000000-000500-bodies.seg")
+	require.NoError(t, os.WriteFile(path, segment, 0644))
+	plan, err := scanSegments(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.candidates, 1)
+	require.True(t, downgradeSegment(dir, plan.candidates[0], true))
+
+	backups, err := RestoreBackups(dir, false)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, path, backups[0].OriginalPath)
+	require.Equal(t, path, backups[0].ConvertedPath)
+	restored, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, segment, restored)
+}
+
+func TestCleanBackups(t *testing.T) {
+	dir := t.TempDir()
+	downgradeWithBackups(t, dir)
+
+	backups, err := CleanBackups(dir, true)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for _, b := range backups {
+		require.FileExists(t, b.Path)
+	}
+
+	backups, err = CleanBackups(dir, false)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for _, b := range backups {
+		require.NoFileExists(t, b.Path)
+		require.FileExists(t, b.ConvertedPath)
+	}
+	require.NoFileExists(t, filepath.Join(dir, "v1.1-000000-000500-headers.seg"))
+
+	backups, err = FindBackups(dir)
+	require.NoError(t, err)
+	require.Empty(t, backups)
+}
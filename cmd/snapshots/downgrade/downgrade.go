@@ -2,14 +2,19 @@ package downgrade
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/urfave/cli/v2"
 
+	"github.com/erigontech/erigon-lib/common/datadir"
 	"github.com/erigontech/erigon-lib/downloader/snaptype"
 	"github.com/erigontech/erigon/cmd/snapshots/flags"
 	"github.com/erigontech/erigon/cmd/utils"
@@ -29,6 +34,25 @@ var (
 		Required: false,
 		Value:    true,
 	}
+
+	ProgressIntervalFlag = cli.DurationFlag{
+		Name:     "progress-interval",
+		Usage:    `How often to report the overall progress of the conversion to stderr`,
+		Required: false,
+		Value:    10 * time.Second,
+	}
+
+	OutDirFlag = cli.StringFlag{
+		Name:     "out-dir",
+		Usage:    `Write the converted files to this existing directory instead of next to the originals, which are left untouched`,
+		Required: false,
+	}
+
+	ForceFlag = cli.BoolFlag{
+		Name:     "force",
+		Usage:    `Convert even if the datadir appears to be in use by a running Erigon`,
+		Required: false,
+	}
 )
 
 var Command = cli.Command{
@@ -40,6 +64,9 @@ var Command = cli.Command{
 		&flags.SegTypes,
 		&DryRunFlag,
 		&KeepOriginalFlag,
+		&ProgressIntervalFlag,
+		&OutDirFlag,
+		&ForceFlag,
 		&utils.DataDirFlag,
 		&logging.LogVerbosityFlag,
 		&logging.LogConsoleVerbosityFlag,
@@ -51,89 +78,219 @@ This command detects v1.1 files by content (not filename) and strips the header.
 
 Note: Erigon 3.x v1.1 files may use "v1-" filename prefix but have different internal format.
 
+The datadir (--datadir, or the parent of <snapshots-dir>) is locked during the
+conversion. The command refuses to run while Erigon holds that lock, unless
+--force is given.
+
 Example:
   snapshots downgrade /path/to/snapshots
   snapshots downgrade --dry-run /path/to/snapshots
-  snapshots downgrade --types=headers,bodies /path/to/snapshots`,
+  snapshots downgrade --types=headers,bodies /path/to/snapshots
+  snapshots downgrade --out-dir=/mnt/fast/snapshots /path/to/snapshots`,
 }
 
+// FormatV10 is the format downgrade converts segments to
+const FormatV10 = "v1.0"
+
 const (
+	formatV11     = "v1.1"
 	v11HeaderSize = 32
 )
 
-// isV11Format detects if a file is in v1.1 format by checking the header content.
-// V1.1 format (Erigon 3.x) has a 32-byte header before the actual data.
-// V1.0 format starts directly with wordsCount, emptyWordsCount, dictSize.
-// We detect v1.1 by checking if the values at offset 0 are unreasonable for v1.0.
-func isV11Format(filePath string) (bool, error) {
+// segmentFormat describes a snapshot segment format that downgrade converts
+// to v1.0. Formats are v1.0 segments behind a fixed-size header, and are
+// named after their filename prefix.
+type segmentFormat struct {
+	name         string
+	headerSize   int64
+	backupSuffix string // appended to originals kept with --keep-original
+	// convert writes the v1.0 form of srcPath into dstDir, or next to it if
+	// dstDir is empty, returning its file name
+	convert func(f *segmentFormat, srcPath, dstDir string, keepOriginal, renameFile bool) (string, error)
+}
+
+// segmentFormats is the registry of convertible formats. Adding a format that
+// only prepends a header to v1.0 takes a registration with stripHeader as
+// converter.
+var segmentFormats = map[string]*segmentFormat{}
+
+func registerSegmentFormat(f *segmentFormat) {
+	segmentFormats[f.name] = f
+}
+
+func init() {
+	registerSegmentFormat(&segmentFormat{name: formatV11, headerSize: v11HeaderSize, backupSuffix: ".v11.bak", convert: stripHeader})
+}
+
+// formatOfFileName returns the registered format whose prefix name has, nil
+// if there is none
+// e.g., v1.1-000000-000500-headers.seg -> v1.1
+func formatOfFileName(name string) *segmentFormat {
+	for prefix, f := range segmentFormats {
+		if strings.HasPrefix(name, prefix+"-") {
+			return f
+		}
+	}
+	return nil
+}
+
+// detectSegmentFormat returns the registered format whose header precedes the
+// v1.0 layout of the segment at filePath, or nil for a v1.0 segment. The
+// format named by the filename, if any, is tried first, then the others in
+// name order.
+//
+// The headers of the formats define no constant or magic bytes that could be
+// matched directly, so detection validates the v1.0 segment layout
+// (see segmentLayoutValid) at offset 0 and after the header of each format.
+// For the 32-byte v1.1 header, the bytes checked at each candidate offset are:
+//
+//	[off+0  : off+8 ]  wordsCount         (big-endian, must be < 2^40)
+//	[off+8  : off+16]  emptyWordsCount    (big-endian, must be <= wordsCount)
+//	[off+16 : off+24]  patternsDictSize   (big-endian, dictionary must fit in the file)
+//	[p      : p+8   ]  posDictSize        (big-endian, at p = off+24+patternsDictSize,
+//	                                       dictionary must fit in the file)
+//
+// A file is reported as having a header only if the layout is inconsistent at
+// offset 0. A large but self-consistent v1.0 dictionary therefore can never
+// be mistaken for a header. An empty layout (all sizes zero) is only accepted
+// when nothing follows it. Files too small for any header are v1.0, other
+// files consistent at no offset are reported as an error.
+func detectSegmentFormat(filePath string, named *segmentFormat) (*segmentFormat, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer f.Close()
 
 	stat, err := f.Stat()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if stat.Size() < 64 { // Need at least 32 (header) + 24 (v1.0 fields) + some data
-		return false, nil // File too small
+	validV10, err := segmentLayoutValid(f, stat.Size(), 0)
+	if err != nil {
+		return nil, err
+	}
+	if validV10 {
+		return nil, nil
+	}
+
+	formats := make([]*segmentFormat, 0, len(segmentFormats))
+	for _, format := range segmentFormats {
+		if format != named {
+			formats = append(formats, format)
+		}
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].name < formats[j].name })
+	if named != nil {
+		formats = append([]*segmentFormat{named}, formats...)
+	}
+
+	fits := false
+	for _, format := range formats {
+		// Need at least the header + 24 (v1.0 fields) + 8 (posDictSize)
+		if stat.Size() < format.headerSize+32 {
+			continue
+		}
+		fits = true
+		valid, err := segmentLayoutValid(f, stat.Size(), format.headerSize)
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			return format, nil
+		}
+	}
+	if !fits {
+		return nil, nil // File too small
+	}
+	return nil, fmt.Errorf("unrecognized segment layout in %s", filepath.Base(filePath))
+}
+
+// DetectFormat reports the format of the segment at filePath, as detected by
+// detectSegmentFormat, and the size of the header preceding its v1.0 layout
+func DetectFormat(filePath string) (format string, headerSize int64, err error) {
+	f, err := detectSegmentFormat(filePath, formatOfFileName(filepath.Base(filePath)))
+	if err != nil {
+		return "", 0, err
+	}
+	if f == nil {
+		return FormatV10, 0, nil
+	}
+	return f.name, f.headerSize, nil
+}
+
+// segmentLayoutValid reports whether the data starting at offset parses as a
+// v1.0 segment: wordsCount, emptyWordsCount and patternsDictSize followed by
+// the patterns dictionary, posDictSize and the positions dictionary, with both
+// dictionaries fitting inside a file of the given size.
+func segmentLayoutValid(r io.ReaderAt, size int64, offset int64) (bool, error) {
+	if size < offset+32 {
+		return false, nil
 	}
 
-	header := make([]byte, 64)
-	if _, err := io.ReadFull(f, header); err != nil {
+	var fields [24]byte
+	if _, err := r.ReadAt(fields[:], offset); err != nil {
 		return false, err
 	}
 
-	// Try parsing as V1.0 format (starts with wordsCount, emptyWordsCount, dictSize)
-	wordsCount := binary.BigEndian.Uint64(header[:8])
-	emptyWordsCount := binary.BigEndian.Uint64(header[8:16])
-	dictSize := binary.BigEndian.Uint64(header[16:24])
+	wordsCount := binary.BigEndian.Uint64(fields[:8])
+	emptyWordsCount := binary.BigEndian.Uint64(fields[8:16])
+	patternsDictSize := binary.BigEndian.Uint64(fields[16:24])
 
-	// If these values are unreasonable for V1.0, it's likely V1.1 format
-	// V1.1 format: first 32 bytes are header, then wordsCount at offset 32
-	if dictSize > uint64(stat.Size()) || dictSize > 1<<40 || wordsCount > 1<<40 {
-		// Verify by checking if values at offset 32 make sense
-		wordsCountV11 := binary.BigEndian.Uint64(header[32:40])
-		emptyWordsCountV11 := binary.BigEndian.Uint64(header[40:48])
-		dictSizeV11 := binary.BigEndian.Uint64(header[48:56])
+	if wordsCount >= 1<<40 || emptyWordsCount > wordsCount {
+		return false, nil
+	}
 
-		// Check if V1.1 values are reasonable
-		if dictSizeV11 <= uint64(stat.Size()) && wordsCountV11 < 1<<40 && emptyWordsCountV11 <= wordsCountV11 {
-			return true, nil
-		}
+	// offset+24 patterns dictionary, then 8 bytes of posDictSize
+	remaining := uint64(size - offset - 24)
+	if patternsDictSize > remaining-8 {
+		return false, nil
 	}
 
-	// Additional check: if emptyWordsCount > wordsCount, it's definitely wrong for V1.0
-	if emptyWordsCount > wordsCount && wordsCount > 0 {
-		return true, nil
+	var posField [8]byte
+	if _, err := r.ReadAt(posField[:], offset+24+int64(patternsDictSize)); err != nil {
+		return false, err
+	}
+	posDictSize := binary.BigEndian.Uint64(posField[:])
+	if posDictSize > remaining-8-patternsDictSize {
+		return false, nil
+	}
+
+	// A segment without words or dictionaries carries no word data
+	if wordsCount == 0 && patternsDictSize == 0 && posDictSize == 0 {
+		return size == offset+32, nil
 	}
 
-	return false, nil
+	return true, nil
 }
 
-// getV10FileName converts a v1.1 filename to v1.0 filename
+// getV10FileName converts the filename of a registered format to v1.0 filename
 // e.g., v1.1-000000-000500-headers.seg -> v1-000000-000500-headers.seg
 func getV10FileName(name string) string {
-	if strings.HasPrefix(name, "v1.1-") {
-		return "v1-" + name[5:]
+	if f := formatOfFileName(name); f != nil {
+		return "v1-" + name[len(f.name)+1:]
 	}
 	return name
 }
 
-// convertV11ToV10 converts a v1.1 file to v1.0 format by stripping the 32-byte header
-// and optionally renaming the file from v1.1-xxx to v1-xxx
-func convertV11ToV10(srcPath string, keepOriginal bool, renameFile bool) (string, error) {
+// stripHeader converts a file of format f to v1.0 by dropping its header, and
+// optionally renames it to its v1.0 filename. Written to another directory,
+// the converted file leaves the original in place whatever keepOriginal.
+func stripHeader(f *segmentFormat, srcPath, dstDir string, keepOriginal bool, renameFile bool) (string, error) {
 	srcDir := filepath.Dir(srcPath)
 	srcName := filepath.Base(srcPath)
-	
+	if dstDir == "" {
+		dstDir = srcDir
+	}
+	inPlace := filepath.Clean(dstDir) == filepath.Clean(srcDir)
+
 	// Determine destination filename
 	dstName := srcName
 	if renameFile {
 		dstName = getV10FileName(srcName)
 	}
-	dstPath := filepath.Join(srcDir, dstName)
+	dstPath := filepath.Join(dstDir, dstName)
 	
 	// Open source file
 	srcFile, err := os.Open(srcPath)
@@ -147,8 +304,8 @@ func convertV11ToV10(srcPath string, keepOriginal bool, renameFile bool) (string
 		return "", fmt.Errorf("failed to stat source: %w", err)
 	}
 
-	// Skip the 32-byte header
-	if _, err := srcFile.Seek(v11HeaderSize, io.SeekStart); err != nil {
+	// Skip the header
+	if _, err := srcFile.Seek(f.headerSize, io.SeekStart); err != nil {
 		return "", fmt.Errorf("failed to seek: %w", err)
 	}
 
@@ -171,7 +328,7 @@ func convertV11ToV10(srcPath string, keepOriginal bool, renameFile bool) (string
 		return "", fmt.Errorf("failed to copy data: %w", err)
 	}
 
-	expectedSize := stat.Size() - v11HeaderSize
+	expectedSize := stat.Size() - f.headerSize
 	if written != expectedSize {
 		return "", fmt.Errorf("size mismatch: expected %d, got %d", expectedSize, written)
 	}
@@ -183,9 +340,11 @@ func convertV11ToV10(srcPath string, keepOriginal bool, renameFile bool) (string
 	srcFile.Close()
 
 	// Handle original file
-	if keepOriginal {
-		// Rename original to .v11.bak
-		bakPath := srcPath + ".v11.bak"
+	if !inPlace {
+		// the original is left untouched
+	} else if keepOriginal {
+		// Rename original to the format's backup name
+		bakPath := srcPath + f.backupSuffix
 		if err := os.Rename(srcPath, bakPath); err != nil {
 			os.Remove(tmpPath)
 			return "", fmt.Errorf("failed to backup original: %w", err)
@@ -206,36 +365,33 @@ func convertV11ToV10(srcPath string, keepOriginal bool, renameFile bool) (string
 	return dstName, nil
 }
 
-func downgrade(cliCtx *cli.Context) error {
-	var snapshotsDir string
-
-	if cliCtx.Args().Len() > 0 {
-		snapshotsDir = cliCtx.Args().Get(0)
-	} else if dataDir := cliCtx.String(utils.DataDirFlag.Name); dataDir != "" {
-		snapshotsDir = filepath.Join(dataDir, "snapshots")
-	} else {
-		return fmt.Errorf("please provide snapshots directory as argument or use --datadir flag")
-	}
-
-	dryRun := cliCtx.Bool(DryRunFlag.Name)
-	keepOriginal := cliCtx.Bool(KeepOriginalFlag.Name)
-
-	// Parse segment types filter
-	typeValues := cliCtx.StringSlice(flags.SegTypes.Name)
-	snapTypes := make(map[string]bool)
-	for _, val := range typeValues {
-		snapTypes[val] = true
-	}
+// downgradeCandidate is a segment the downgrade converts or renames
+type downgradeCandidate struct {
+	name        string
+	format      *segmentFormat // the format the segment is downgraded from
+	needsRename bool           // the filename has the prefix of format
+	hasHeader   bool           // the content has the header of format
+	size        int64
+}
 
-	fmt.Printf("Scanning for v1.1 format snapshot files in: %s (dry-run: %v)\n", snapshotsDir, dryRun)
+// downgradePlan is the result of scanning a snapshots directory up front,
+// giving the totals the progress is reported against
+type downgradePlan struct {
+	candidates []downgradeCandidate
+	bytesTotal int64
+	alreadyV10 int
+	skipped    int
+}
 
+// scanSegments lists the segments of snapshotsDir that need downgrading,
+// restricted to snapTypes if not empty
+func scanSegments(snapshotsDir string, snapTypes map[string]bool) (*downgradePlan, error) {
 	entries, err := os.ReadDir(snapshotsDir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	var converted, skipped, alreadyV10 int
-
+	plan := &downgradePlan{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -262,126 +418,324 @@ func downgrade(cliCtx *cli.Context) error {
 		// Apply type filter if specified
 		if len(snapTypes) > 0 && fileInfo.Type != nil {
 			if !snapTypes[fileInfo.Type.Name()] {
-				skipped++
+				plan.skipped++
 				continue
 			}
 		}
 
 		srcPath := filepath.Join(snapshotsDir, name)
 
-		// Check if filename has v1.1 prefix (needs renaming)
-		needsRename := strings.HasPrefix(name, "v1.1-")
-		
-		// Check if file content is v1.1 format (has 32-byte header)
-		isV11Content, err := isV11Format(srcPath)
+		// Check if filename has the prefix of a registered format (needs renaming)
+		named := formatOfFileName(name)
+
+		// Check if file content has the header of a registered format
+		format, err := detectSegmentFormat(srcPath, named)
 		if err != nil {
 			fmt.Printf("  Warning: Failed to check file format %s: %v\n", name, err)
 			continue
 		}
 
-		// Skip if neither filename nor content indicates v1.1
-		if !needsRename && !isV11Content {
-			alreadyV10++
+		// Skip if neither filename nor content indicates a registered format
+		if named == nil && format == nil {
+			plan.alreadyV10++
 			continue
 		}
+		hasHeader := format != nil
+		if format == nil {
+			format = named
+		}
+
+		size := int64(0)
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		plan.candidates = append(plan.candidates, downgradeCandidate{name: name, format: format, needsRename: named != nil, hasHeader: hasHeader, size: size})
+		plan.bytesTotal += size
+	}
+	return plan, nil
+}
+
+func downgrade(cliCtx *cli.Context) error {
+	var snapshotsDir string
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+
+	if cliCtx.Args().Len() > 0 {
+		snapshotsDir = cliCtx.Args().Get(0)
+	} else if dataDir != "" {
+		snapshotsDir = filepath.Join(dataDir, "snapshots")
+	} else {
+		return fmt.Errorf("please provide snapshots directory as argument or use --datadir flag")
+	}
+	// the datadir flag has a default, only an explicit one overrides the
+	// datadir of the snapshots directory given as argument
+	if dataDir == "" || (cliCtx.Args().Len() > 0 && !cliCtx.IsSet(utils.DataDirFlag.Name)) {
+		dataDir = filepath.Dir(filepath.Clean(snapshotsDir))
+	}
 
+	dryRun := cliCtx.Bool(DryRunFlag.Name)
+	keepOriginal := cliCtx.Bool(KeepOriginalFlag.Name)
+	outDir := cliCtx.String(OutDirFlag.Name)
+
+	if !dryRun {
+		unlock, err := lockDataDir(dataDir, cliCtx.Bool(ForceFlag.Name))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	// Parse segment types filter
+	typeValues := cliCtx.StringSlice(flags.SegTypes.Name)
+	snapTypes := make(map[string]bool)
+	for _, val := range typeValues {
+		snapTypes[val] = true
+	}
+
+	fmt.Printf("Scanning for v1.1 format snapshot files in: %s (dry-run: %v)\n", snapshotsDir, dryRun)
+
+	plan, err := scanSegments(snapshotsDir, snapTypes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Found %d v1.1 files (%.2f MB)\n", len(plan.candidates), float64(plan.bytesTotal)/1024/1024)
+
+	if outDir != "" {
+		if err := checkOutDir(snapshotsDir, outDir, plan.bytesTotal); err != nil {
+			return err
+		}
+		fmt.Printf("Writing converted files to: %s\n", outDir)
+	}
+
+	progress := newProgressTracker(len(plan.candidates), plan.bytesTotal, cliCtx.Duration(ProgressIntervalFlag.Name), func(p Progress) {
+		fmt.Fprintf(os.Stderr, "Progress: %s\n", p)
+	})
+
+	var converted int
+	for _, c := range plan.candidates {
 		if dryRun {
-			info, _ := entry.Info()
-			size := int64(0)
-			if info != nil {
-				size = info.Size()
+			dstName := c.name
+			if c.needsRename {
+				dstName = getV10FileName(c.name)
 			}
-			dstName := name
-			if needsRename {
-				dstName = getV10FileName(name)
+			if outDir != "" {
+				dstName = filepath.Join(outDir, dstName)
 			}
-			fmt.Printf("  [DRY-RUN] Would convert: %s -> %s (v1.1_content=%v, size=%.2f MB)\n",
-				name, dstName, isV11Content, float64(size)/1024/1024)
+			fmt.Printf("  [DRY-RUN] Would convert: %s -> %s (%s_content=%v, size=%.2f MB)\n",
+				c.name, dstName, c.format.name, c.hasHeader, float64(c.size)/1024/1024)
 			converted++
 			continue
 		}
 
-		// Convert: strip header if v1.1 content, rename if v1.1 filename
-		if isV11Content {
-			fmt.Printf("  Converting v1.1 to v1.0: %s (rename=%v)\n", name, needsRename)
-			dstName, err := convertV11ToV10(srcPath, keepOriginal, needsRename)
-			if err != nil {
-				fmt.Printf("    Error: Failed to convert %s: %v\n", name, err)
-				continue
+		if downgradeSegmentTo(snapshotsDir, outDir, c, keepOriginal) {
+			converted++
+		}
+		progress.fileDone(c.size)
+	}
+
+	fmt.Printf("\nScan complete:\n")
+	fmt.Printf("  v1.1 files found:    %d\n", converted)
+	fmt.Printf("  Already v1.0:        %d\n", plan.alreadyV10)
+	fmt.Printf("  Skipped by filter:   %d\n", plan.skipped)
+
+	if !dryRun && converted > 0 {
+		fmt.Println("\nConversion complete. Index files may need to be regenerated on next startup.")
+	}
+
+	return nil
+}
+
+// ErrDataDirInUse is returned by downgrade when a running Erigon holds the
+// lock of the datadir
+var ErrDataDirInUse = errors.New("datadir is in use by a running Erigon, stop it first or use --force")
+
+// lockDataDir takes the lock Erigon holds on dataDir while running, so that no
+// node starts while segments are converted. A datadir without a lock file has
+// never been used by a node and isn't locked. If force is set, a datadir in
+// use is only warned about.
+func lockDataDir(dataDir string, force bool) (unlock func(), err error) {
+	unlock = func() {}
+	lockPath := filepath.Join(dataDir, "LOCK")
+	if _, err := os.Stat(lockPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return unlock, nil
+		}
+		return nil, err
+	}
+
+	lock, locked, err := datadir.TryFlock(datadir.Dirs{DataDir: dataDir})
+	if err != nil && !errors.Is(err, datadir.ErrDataDirLocked) {
+		return nil, fmt.Errorf("failed to lock datadir %s: %w", dataDir, err)
+	}
+	if !locked {
+		if !force {
+			return nil, fmt.Errorf("%w: %s", ErrDataDirInUse, dataDir)
+		}
+		fmt.Printf("Warning: datadir %s is in use by a running Erigon, converting anyway (--force)\n", dataDir)
+		return unlock, nil
+	}
+	return func() { _ = lock.Unlock() }, nil
+}
+
+// freeSpace returns the space available to the process on the disk of dir
+var freeSpace = func(dir string) (uint64, error) {
+	usage, err := disk.Usage(dir)
+	if err != nil {
+		return 0, err
+	}
+	return usage.Free, nil
+}
+
+// checkOutDir checks that outDir is an existing directory, other than
+// snapshotsDir, with room for bytesNeeded
+func checkOutDir(snapshotsDir, outDir string, bytesNeeded int64) error {
+	info, err := os.Stat(outDir)
+	if err != nil {
+		return fmt.Errorf("output directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output directory: %s is not a directory", outDir)
+	}
+	if srcInfo, err := os.Stat(snapshotsDir); err == nil && os.SameFile(info, srcInfo) {
+		return errors.New("output directory must differ from the snapshots directory")
+	}
+	free, err := freeSpace(outDir)
+	if err != nil {
+		return fmt.Errorf("output directory: %w", err)
+	}
+	if bytesNeeded > 0 && free < uint64(bytesNeeded) {
+		return fmt.Errorf("output directory has %.2f MB free, the converted files need up to %.2f MB",
+			float64(free)/1024/1024, float64(bytesNeeded)/1024/1024)
+	}
+	return nil
+}
+
+// copyFile copies srcPath to dstPath, removing dstPath on failure
+func copyFile(srcPath, dstPath string) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dstFile, srcFile)
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
+
+// downgradeSegment strips the header of a segment of a registered format and
+// renames filenames with its prefix, together with their .idx files. It reports whether it succeeded.
+func downgradeSegment(snapshotsDir string, c downgradeCandidate, keepOriginal bool) bool {
+	return downgradeSegmentTo(snapshotsDir, "", c, keepOriginal)
+}
+
+// downgradeSegmentTo is downgradeSegment writing into outDir, if not empty,
+// and leaving the original files untouched. Only the indexes of renamed
+// segments are copied along, converted segments need theirs rebuilt.
+func downgradeSegmentTo(snapshotsDir, outDir string, c downgradeCandidate, keepOriginal bool) bool {
+	if outDir != "" {
+		return copySegmentTo(snapshotsDir, outDir, c)
+	}
+	name := c.name
+	srcPath := filepath.Join(snapshotsDir, name)
+
+	// Convert: strip header if the content has one, rename if the filename has a format prefix
+	if c.hasHeader {
+		fmt.Printf("  Converting %s to v1.0: %s (rename=%v)\n", c.format.name, name, c.needsRename)
+		dstName, err := c.format.convert(c.format, srcPath, "", keepOriginal, c.needsRename)
+		if err != nil {
+			fmt.Printf("    Error: Failed to convert %s: %v\n", name, err)
+			return false
+		}
+
+		// Also handle associated .idx files
+		srcIdxPath := strings.TrimSuffix(srcPath, ".seg") + ".idx"
+		if _, err := os.Stat(srcIdxPath); err == nil {
+			if keepOriginal {
+				os.Rename(srcIdxPath, srcIdxPath+c.format.backupSuffix)
+			} else {
+				os.Remove(srcIdxPath)
 			}
-			
-			// Also handle associated .idx files
-			srcIdxPath := strings.TrimSuffix(srcPath, ".seg") + ".idx"
-			if _, err := os.Stat(srcIdxPath); err == nil {
-				if keepOriginal {
-					os.Rename(srcIdxPath, srcIdxPath+".v11.bak")
-				} else {
-					os.Remove(srcIdxPath)
-				}
-				fmt.Printf("    Removed old index: %s\n", filepath.Base(srcIdxPath))
+			fmt.Printf("    Removed old index: %s\n", filepath.Base(srcIdxPath))
+		}
+
+		fmt.Printf("    Converted: %s -> %s\n", name, dstName)
+	} else if c.needsRename {
+		// Only rename, no content conversion needed
+		dstName := getV10FileName(name)
+		dstPath := filepath.Join(snapshotsDir, dstName)
+
+		if keepOriginal {
+			// Copy instead of rename
+			if err := copyFile(srcPath, dstPath); err != nil {
+				fmt.Printf("    Error: Failed to copy %s: %v\n", name, err)
+				return false
+			}
+			os.Rename(srcPath, srcPath+c.format.backupSuffix)
+		} else {
+			if err := os.Rename(srcPath, dstPath); err != nil {
+				fmt.Printf("    Error: Failed to rename %s: %v\n", name, err)
+				return false
 			}
-			
-			fmt.Printf("    Converted: %s -> %s\n", name, dstName)
-		} else if needsRename {
-			// Only rename, no content conversion needed
-			dstName := getV10FileName(name)
-			dstPath := filepath.Join(snapshotsDir, dstName)
-			
+		}
+
+		// Also rename associated .idx files
+		srcIdxPath := strings.TrimSuffix(srcPath, ".seg") + ".idx"
+		if _, err := os.Stat(srcIdxPath); err == nil {
+			dstIdxName := getV10FileName(strings.TrimSuffix(name, ".seg") + ".idx")
+			dstIdxPath := filepath.Join(snapshotsDir, dstIdxName)
 			if keepOriginal {
-				// Copy instead of rename
-				srcFile, err := os.Open(srcPath)
-				if err != nil {
-					fmt.Printf("    Error: Failed to open %s: %v\n", name, err)
-					continue
-				}
-				dstFile, err := os.Create(dstPath)
-				if err != nil {
-					srcFile.Close()
-					fmt.Printf("    Error: Failed to create %s: %v\n", dstName, err)
-					continue
-				}
-				_, err = io.Copy(dstFile, srcFile)
-				srcFile.Close()
-				dstFile.Close()
-				if err != nil {
-					os.Remove(dstPath)
-					fmt.Printf("    Error: Failed to copy %s: %v\n", name, err)
-					continue
-				}
-				os.Rename(srcPath, srcPath+".v11.bak")
+				os.Rename(srcIdxPath, srcIdxPath+c.format.backupSuffix)
 			} else {
-				if err := os.Rename(srcPath, dstPath); err != nil {
-					fmt.Printf("    Error: Failed to rename %s: %v\n", name, err)
-					continue
-				}
-			}
-			
-			// Also rename associated .idx files
-			srcIdxPath := strings.TrimSuffix(srcPath, ".seg") + ".idx"
-			if _, err := os.Stat(srcIdxPath); err == nil {
-				dstIdxName := getV10FileName(strings.TrimSuffix(name, ".seg") + ".idx")
-				dstIdxPath := filepath.Join(snapshotsDir, dstIdxName)
-				if keepOriginal {
-					os.Rename(srcIdxPath, srcIdxPath+".v11.bak")
-				} else {
-					os.Rename(srcIdxPath, dstIdxPath)
-				}
+				os.Rename(srcIdxPath, dstIdxPath)
 			}
-			
-			fmt.Printf("    Renamed: %s -> %s\n", name, dstName)
 		}
 
-		converted++
+		fmt.Printf("    Renamed: %s -> %s\n", name, dstName)
 	}
 
-	fmt.Printf("\nScan complete:\n")
-	fmt.Printf("  v1.1 files found:    %d\n", converted)
-	fmt.Printf("  Already v1.0:        %d\n", alreadyV10)
-	fmt.Printf("  Skipped by filter:   %d\n", skipped)
+	return true
+}
 
-	if !dryRun && converted > 0 {
-		fmt.Println("\nConversion complete. Index files may need to be regenerated on next startup.")
+// copySegmentTo writes the v1.0 form of a segment into outDir, together with
+// its index if the segment only needs renaming
+func copySegmentTo(snapshotsDir, outDir string, c downgradeCandidate) bool {
+	name := c.name
+	srcPath := filepath.Join(snapshotsDir, name)
+
+	if c.hasHeader {
+		fmt.Printf("  Converting %s to v1.0: %s -> %s (rename=%v)\n", c.format.name, name, outDir, c.needsRename)
+		dstName, err := c.format.convert(c.format, srcPath, outDir, false, c.needsRename)
+		if err != nil {
+			fmt.Printf("    Error: Failed to convert %s: %v\n", name, err)
+			return false
+		}
+		fmt.Printf("    Converted: %s -> %s\n", name, filepath.Join(outDir, dstName))
+		return true
 	}
 
-	return nil
+	dstName := getV10FileName(name)
+	if err := copyFile(srcPath, filepath.Join(outDir, dstName)); err != nil {
+		fmt.Printf("    Error: Failed to copy %s: %v\n", name, err)
+		return false
+	}
+	// the index of the unchanged content still applies
+	srcIdxPath := strings.TrimSuffix(srcPath, ".seg") + ".idx"
+	if _, err := os.Stat(srcIdxPath); err == nil {
+		dstIdxName := getV10FileName(strings.TrimSuffix(name, ".seg") + ".idx")
+		if err := copyFile(srcIdxPath, filepath.Join(outDir, dstIdxName)); err != nil {
+			fmt.Printf("    Error: Failed to copy %s: %v\n", filepath.Base(srcIdxPath), err)
+			return false
+		}
+	}
+	fmt.Printf("    Copied: %s -> %s\n", name, filepath.Join(outDir, dstName))
+	return true
 }
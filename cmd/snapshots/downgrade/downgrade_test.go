@@ -0,0 +1,295 @@
+package downgrade
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/erigontech/erigon-lib/common/datadir"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/seg"
+)
+
+// v11Headers is a corpus of synthetic 32-byte v1.1 headers prepended to
+// v1.0 segments. None were captured from real v1.1 segments, the cases cover
+// the extremes the detection has to cope with.
+var v11Headers = map[string][]byte{
+	"zeros":      make([]byte, v11HeaderSize),
+	"ones":       bytes.Repeat([]byte{0xff}, v11HeaderSize),
+	"versioned":  append([]byte{0x01, 0x01, 0x00, 0x00}, make([]byte, v11HeaderSize-4)...),
+	"ascii":      []byte("erigon-segment-v1.1-header-32byt"),
+	"large-dict": append(append(make([]byte, 16), 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00), make([]byte, 8)...),
+}
+
+// realSegments are v1.0 segments produced by a node, shared with the heimdall
+// simulator tests
+//
+//go:embed testdata/*.seg
+var realSegments embed.FS
+
+// createV10Segment compresses words into a v1.0 segment and returns its content
+func createV10Segment(t *testing.T, dir, name string, words [][]byte) []byte {
+	t.Helper()
+	logger := log.New()
+	path := filepath.Join(dir, name)
+	c, err := seg.NewCompressor(context.Background(), "test", path, dir, 1, 1, log.LvlDebug, logger)
+	require.NoError(t, err)
+	defer c.Close()
+	c.DisableFsync()
+	for _, w := range words {
+		require.NoError(t, c.AddWord(w))
+	}
+	require.NoError(t, c.Compress())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+func v10Corpus(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	corpus := map[string][][]byte{
+		"empty":  nil,
+		"single": {[]byte("word")},
+		"empty-words": {
+			{}, {}, {}, []byte("x"),
+		},
+	}
+
+	// Repetitive words produce a large patterns dictionary
+	var repetitive [][]byte
+	for i := 0; i < 2000; i++ {
+		repetitive = append(repetitive, []byte(fmt.Sprintf("repeated-pattern-%d-repeated-pattern-%d", i%17, i%13)))
+	}
+	corpus["large-dict"] = repetitive
+
+	var sequential [][]byte
+	for i := 0; i < 500; i++ {
+		sequential = append(sequential, []byte(fmt.Sprintf("%08d", i)))
+	}
+	corpus["sequential"] = sequential
+
+	segments := make(map[string][]byte, len(corpus))
+	for name, words := range corpus {
+		segments[name] = createV10Segment(t, dir, "v1-000000-000500-"+name+".seg", words)
+	}
+	return segments
+}
+
+func TestDetectSegmentFormatCorpus(t *testing.T) {
+	dir := t.TempDir()
+	segments := v10Corpus(t, dir)
+	v11 := segmentFormats[formatV11]
+
+	for name, data := range segments {
+		path := filepath.Join(dir, "v10-"+name+".seg")
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		format, err := detectSegmentFormat(path, nil)
+		require.NoError(t, err, name)
+		require.Nil(t, format, "v1.0 segment %q misclassified as v1.1", name)
+
+		for headerName, header := range v11Headers {
+			require.Len(t, header, v11HeaderSize)
+			path := filepath.Join(dir, "v11-"+name+"-"+headerName+".seg")
+			require.NoError(t, os.WriteFile(path, append(append([]byte{}, header...), data...), 0644))
+			format, err := detectSegmentFormat(path, nil)
+			require.NoError(t, err, "%s/%s", name, headerName)
+			require.Equal(t, v11, format, "v1.1 segment %q with %q header misclassified as v1.0", name, headerName)
+		}
+	}
+}
+
+func TestDetectSegmentFormatRealSegments(t *testing.T) {
+	entries, err := realSegments.ReadDir("testdata")
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	dir := t.TempDir()
+
+	for _, entry := range entries {
+		name := entry.Name()
+		data, err := realSegments.ReadFile("testdata/" + name)
+		require.NoError(t, err)
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		format, err := detectSegmentFormat(path, nil)
+		require.NoError(t, err, name)
+		require.Nil(t, format, "v1.0 segment %q misclassified", name)
+
+		for headerName, header := range v11Headers {
+			v11Name := "v1.1-" + name[len("v1-"):]
+			path := filepath.Join(dir, v11Name)
+			require.NoError(t, os.WriteFile(path, append(append([]byte{}, header...), data...), 0644))
+			format, err := detectSegmentFormat(path, formatOfFileName(v11Name))
+			require.NoError(t, err, "%s/%s", name, headerName)
+			require.Equal(t, segmentFormats[formatV11], format, "%s/%s", name, headerName)
+			dstName, err := stripHeader(segmentFormats[formatV11], path, "", false, true)
+			require.NoError(t, err, "%s/%s", name, headerName)
+			require.Equal(t, name, dstName)
+			converted, err := os.ReadFile(filepath.Join(dir, dstName))
+			require.NoError(t, err)
+			require.Equal(t, data, converted, "%s/%s", name, headerName)
+		}
+	}
+}
+
+func TestDetectSegmentFormatUnrecognized(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "v1-000000-000500-headers.seg")
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte{0xff}, 128), 0644))
+	_, err := detectSegmentFormat(path, nil)
+	require.Error(t, err)
+}
+
+func TestSegmentFormatRegistry(t *testing.T) {
+	const headerSize = 48
+	registerSegmentFormat(&segmentFormat{name: "v1.2", headerSize: headerSize, backupSuffix: ".v12.bak", convert: stripHeader})
+	t.Cleanup(func() { delete(segmentFormats, "v1.2") })
+
+	dir := t.TempDir()
+	data := createV10Segment(t, dir, "source.seg", [][]byte{[]byte("word")})
+	require.NoError(t, os.Remove(filepath.Join(dir, "source.seg")))
+	v12Header := bytes.Repeat([]byte{0xab}, headerSize)
+	files := map[string][]byte{
+		// named and detected v1.2
+		"v1.2-000000-000500-headers.seg": append(append([]byte{}, v12Header...), data...),
+		"v1.2-000000-000500-headers.idx": []byte("v1.2 index"),
+		// detected v1.2 behind a v1.0 filename
+		"v1-000000-000500-bodies.seg": append(append([]byte{}, v12Header...), data...),
+		// v1.1 still strips its own header size
+		"v1.1-000000-000500-transactions.seg": append(make([]byte, v11HeaderSize), data...),
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0644))
+	}
+
+	plan, err := scanSegments(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.candidates, 3)
+	formats := map[string]string{}
+	for _, c := range plan.candidates {
+		require.True(t, c.hasHeader, c.name)
+		formats[c.name] = c.format.name
+		require.True(t, downgradeSegmentTo(dir, "", c, true), c.name)
+	}
+	require.Equal(t, map[string]string{
+		"v1.2-000000-000500-headers.seg":      "v1.2",
+		"v1-000000-000500-bodies.seg":         "v1.2",
+		"v1.1-000000-000500-transactions.seg": formatV11,
+	}, formats)
+
+	for _, name := range []string{"v1-000000-000500-headers.seg", "v1-000000-000500-bodies.seg", "v1-000000-000500-transactions.seg"} {
+		converted, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		require.Equal(t, data, converted, name)
+	}
+	// the originals are kept with the backup suffix of their format
+	require.FileExists(t, filepath.Join(dir, "v1.2-000000-000500-headers.seg.v12.bak"))
+	require.FileExists(t, filepath.Join(dir, "v1.2-000000-000500-headers.idx.v12.bak"))
+	require.FileExists(t, filepath.Join(dir, "v1-000000-000500-bodies.seg.v12.bak"))
+	require.FileExists(t, filepath.Join(dir, "v1.1-000000-000500-transactions.seg.v11.bak"))
+}
+
+func TestDowngradeOutDir(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	data := createV10Segment(t, src, "source.seg", [][]byte{[]byte("word")})
+	require.NoError(t, os.Remove(filepath.Join(src, "source.seg")))
+	files := map[string][]byte{
+		// v1.1 content, converted
+		"v1.1-000000-000500-headers.seg": append(make([]byte, v11HeaderSize), data...),
+		"v1.1-000000-000500-headers.idx": []byte("v1.1 index"),
+		// v1.0 content behind a v1.1 filename, renamed
+		"v1.1-000000-000500-bodies.seg": data,
+		"v1.1-000000-000500-bodies.idx": []byte("bodies index"),
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), content, 0644))
+	}
+
+	plan, err := scanSegments(src, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.candidates, 2)
+	require.NoError(t, checkOutDir(src, out, plan.bytesTotal))
+	for _, c := range plan.candidates {
+		require.True(t, downgradeSegmentTo(src, out, c, false))
+	}
+
+	// the sources are untouched
+	entries, err := os.ReadDir(src)
+	require.NoError(t, err)
+	require.Len(t, entries, len(files))
+	for name, content := range files {
+		kept, err := os.ReadFile(filepath.Join(src, name))
+		require.NoError(t, err)
+		require.Equal(t, content, kept)
+	}
+
+	expected := map[string][]byte{
+		"v1-000000-000500-headers.seg": data,
+		"v1-000000-000500-bodies.seg":  data,
+		"v1-000000-000500-bodies.idx":  []byte("bodies index"),
+	}
+	entries, err = os.ReadDir(out)
+	require.NoError(t, err)
+	require.Len(t, entries, len(expected))
+	for name, content := range expected {
+		written, err := os.ReadFile(filepath.Join(out, name))
+		require.NoError(t, err)
+		require.Equal(t, content, written, name)
+	}
+}
+
+func TestCheckOutDir(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	require.NoError(t, checkOutDir(src, out, 1024))
+	require.ErrorContains(t, checkOutDir(src, filepath.Join(out, "missing"), 1024), "output directory")
+	require.ErrorContains(t, checkOutDir(src, src, 1024), "must differ")
+
+	saved := freeSpace
+	defer func() { freeSpace = saved }()
+	freeSpace = func(string) (uint64, error) { return 100, nil }
+	require.ErrorContains(t, checkOutDir(src, out, 1024), "MB free")
+	require.NoError(t, checkOutDir(src, out, 100))
+}
+
+func TestDowngradeDataDirInUse(t *testing.T) {
+	dataDir := t.TempDir()
+	snapshotsDir := filepath.Join(dataDir, "snapshots")
+	require.NoError(t, os.Mkdir(snapshotsDir, 0755))
+
+	// a datadir never used by a node has no lock to check
+	unlock, err := lockDataDir(dataDir, false)
+	require.NoError(t, err)
+	unlock()
+
+	// a running node holds the lock
+	node, locked, err := datadir.TryFlock(datadir.Dirs{DataDir: dataDir})
+	require.NoError(t, err)
+	require.True(t, locked)
+	defer node.Unlock()
+
+	app := cli.NewApp()
+	app.Commands = []*cli.Command{&Command}
+	err = app.Run([]string{"snapshots", "downgrade", snapshotsDir})
+	require.ErrorIs(t, err, ErrDataDirInUse)
+	require.ErrorContains(t, err, "stop it first or use --force")
+
+	require.NoError(t, app.Run([]string{"snapshots", "downgrade", "--dry-run", snapshotsDir}))
+	require.NoError(t, app.Run([]string{"snapshots", "downgrade", "--force", snapshotsDir}))
+
+	// the lock is held during the conversion and released after it
+	require.NoError(t, node.Unlock())
+	unlock, err = lockDataDir(dataDir, false)
+	require.NoError(t, err)
+	_, err = lockDataDir(dataDir, false)
+	require.ErrorIs(t, err, ErrDataDirInUse)
+	unlock()
+	unlock, err = lockDataDir(dataDir, false)
+	require.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,87 @@
+package downgrade
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress is the state of a downgrade run over a snapshots directory
+type Progress struct {
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+	Elapsed    time.Duration
+	// ETA extrapolates the bytes rate so far. It is zero before any bytes
+	// are done and after all of them are.
+	ETA time.Duration
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("files %d/%d, %.2f/%.2f MB (%.1f%%), elapsed %s, eta %s",
+		p.FilesDone, p.FilesTotal, float64(p.BytesDone)/1024/1024, float64(p.BytesTotal)/1024/1024,
+		p.percent(), p.Elapsed.Round(time.Second), p.ETA.Round(time.Second))
+}
+
+func (p Progress) percent() float64 {
+	if p.BytesTotal == 0 {
+		return 100
+	}
+	return 100 * float64(p.BytesDone) / float64(p.BytesTotal)
+}
+
+// progressTracker counts the files processed by a run against the totals of
+// the directory scan, and reports its Progress at most once per interval.
+// The last file is always reported.
+type progressTracker struct {
+	filesTotal int
+	bytesTotal int64
+	interval   time.Duration
+	report     func(Progress)
+	now        func() time.Time
+
+	start      time.Time
+	lastReport time.Time
+	filesDone  int
+	bytesDone  int64
+}
+
+func newProgressTracker(filesTotal int, bytesTotal int64, interval time.Duration, report func(Progress)) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		filesTotal: filesTotal,
+		bytesTotal: bytesTotal,
+		interval:   interval,
+		report:     report,
+		now:        time.Now,
+		start:      now,
+		lastReport: now,
+	}
+}
+
+// fileDone counts a processed file of the given size, whether or not its
+// conversion succeeded
+func (t *progressTracker) fileDone(size int64) {
+	t.filesDone++
+	t.bytesDone += size
+	now := t.now()
+	if t.filesDone < t.filesTotal && now.Sub(t.lastReport) < t.interval {
+		return
+	}
+	t.lastReport = now
+	t.report(t.progress(now))
+}
+
+func (t *progressTracker) progress(now time.Time) Progress {
+	p := Progress{
+		FilesDone:  t.filesDone,
+		FilesTotal: t.filesTotal,
+		BytesDone:  t.bytesDone,
+		BytesTotal: t.bytesTotal,
+		Elapsed:    now.Sub(t.start),
+	}
+	if t.bytesDone > 0 && t.bytesDone < t.bytesTotal {
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(t.bytesTotal-t.bytesDone) / float64(t.bytesDone))
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+package downgrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDowngradeProgress(t *testing.T) {
+	dir := t.TempDir()
+	data := createV10Segment(t, dir, "source.seg", [][]byte{[]byte("word")})
+	require.NoError(t, os.Remove(filepath.Join(dir, "source.seg")))
+	for _, name := range []string{"headers", "bodies", "transactions"} {
+		path := filepath.Join(dir, "v1.1-000000-000500-"+name+".seg")
+		require.NoError(t, os.WriteFile(path, append(make([]byte, v11HeaderSize), data...), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1-000500-001000-headers.seg"), data, 0644))
+
+	plan, err := scanSegments(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, plan.candidates, 3)
+	require.Equal(t, 1, plan.alreadyV10)
+	require.Equal(t, int64(3*(v11HeaderSize+len(data))), plan.bytesTotal)
+
+	var reports []Progress
+	progress := newProgressTracker(len(plan.candidates), plan.bytesTotal, 0, func(p Progress) {
+		reports = append(reports, p)
+	})
+	clock := progress.start
+	progress.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	for _, c := range plan.candidates {
+		require.True(t, downgradeSegment(dir, c, false))
+		progress.fileDone(c.size)
+	}
+
+	require.Len(t, reports, 3)
+	for i, p := range reports {
+		require.Equal(t, i+1, p.FilesDone)
+		require.Equal(t, 3, p.FilesTotal)
+		require.Equal(t, plan.bytesTotal, p.BytesTotal)
+		require.Equal(t, time.Duration(i+1)*time.Second, p.Elapsed)
+		if i > 0 {
+			require.Greater(t, p.BytesDone, reports[i-1].BytesDone)
+		}
+	}
+	require.Equal(t, 2*time.Second, reports[0].ETA)
+	last := reports[len(reports)-1]
+	require.Equal(t, plan.bytesTotal, last.BytesDone)
+	require.Zero(t, last.ETA)
+	require.Contains(t, last.String(), "files 3/3")
+
+	plan, err = scanSegments(dir, nil)
+	require.NoError(t, err)
+	require.Empty(t, plan.candidates)
+	require.Equal(t, 4, plan.alreadyV10)
+}
+
+func TestDowngradeProgressInterval(t *testing.T) {
+	var reports []Progress
+	progress := newProgressTracker(10, 10, time.Minute, func(p Progress) {
+		reports = append(reports, p)
+	})
+	clock := progress.start
+	progress.now = func() time.Time { return clock }
+
+	for i := 0; i < 5; i++ {
+		clock = clock.Add(10 * time.Second)
+		progress.fileDone(1)
+	}
+	require.Len(t, reports, 0)
+	clock = clock.Add(10 * time.Second)
+	progress.fileDone(1)
+	require.Len(t, reports, 1)
+	require.Equal(t, 6, reports[0].FilesDone)
+
+	// the last file is reported regardless of the interval
+	for i := 0; i < 4; i++ {
+		progress.fileDone(1)
+	}
+	require.Len(t, reports, 2)
+	require.Equal(t, 10, reports[1].FilesDone)
+}
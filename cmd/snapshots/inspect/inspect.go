@@ -0,0 +1,143 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/erigontech/erigon-lib/recsplit"
+	"github.com/erigontech/erigon/cmd/snapshots/downgrade"
+	"github.com/erigontech/erigon/turbo/logging"
+)
+
+var Command = cli.Command{
+	Action:    inspect,
+	Name:      "inspect",
+	Usage:     "print the format and header fields of a snapshot segment",
+	ArgsUsage: "<file.seg>",
+	Flags: []cli.Flag{
+		&logging.LogVerbosityFlag,
+		&logging.LogConsoleVerbosityFlag,
+		&logging.LogDirVerbosityFlag,
+	},
+	Description: `Detects whether a segment is in v1.0 or v1.1 format, the same way
+"snapshots downgrade" does, and prints the v1.0 header fields read at the
+offset of that format, together with the state of the segment's .idx file.
+
+Example:
+  snapshots inspect /path/to/snapshots/v1-000000-000500-headers.seg`,
+}
+
+// SegmentInfo describes a snapshot segment and its index
+type SegmentInfo struct {
+	Format          string
+	HeaderSize      int64 // bytes preceding the v1.0 layout
+	WordsCount      uint64
+	EmptyWordsCount uint64
+	DictSize        uint64 // size of the patterns dictionary
+	FileSize        int64
+
+	IdxPath   string
+	IdxExists bool
+	// IdxValid is set if the index opens and has a key per word
+	IdxValid bool
+	IdxError error
+}
+
+func inspect(cliCtx *cli.Context) error {
+	if cliCtx.Args().Len() == 0 {
+		return fmt.Errorf("please provide a segment file as argument")
+	}
+
+	info, err := Inspect(cliCtx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	info.Print(os.Stdout)
+	return nil
+}
+
+// Inspect reads the format and header fields of the .seg file at path, and
+// checks the .idx file of the same name
+func Inspect(path string) (*SegmentInfo, error) {
+	if !strings.HasSuffix(path, ".seg") {
+		return nil, fmt.Errorf("%s is not a segment file", path)
+	}
+
+	format, headerSize, err := downgrade.DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields [24]byte
+	if _, err := f.ReadAt(fields[:], headerSize); err != nil {
+		return nil, fmt.Errorf("failed to read header fields: %w", err)
+	}
+
+	info := &SegmentInfo{
+		Format:          format,
+		HeaderSize:      headerSize,
+		WordsCount:      binary.BigEndian.Uint64(fields[:8]),
+		EmptyWordsCount: binary.BigEndian.Uint64(fields[8:16]),
+		DictSize:        binary.BigEndian.Uint64(fields[16:24]),
+		FileSize:        stat.Size(),
+		IdxPath:         strings.TrimSuffix(path, ".seg") + ".idx",
+	}
+
+	if _, err := os.Stat(info.IdxPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return info, nil
+	}
+	info.IdxExists = true
+
+	idx, err := recsplit.OpenIndex(info.IdxPath)
+	if err != nil {
+		info.IdxError = err
+		return info, nil
+	}
+	defer idx.Close()
+
+	if idx.KeyCount() != info.WordsCount {
+		info.IdxError = fmt.Errorf("index has %d keys, segment has %d words", idx.KeyCount(), info.WordsCount)
+		return info, nil
+	}
+	info.IdxValid = true
+
+	return info, nil
+}
+
+// Print writes info in human readable form
+func (info *SegmentInfo) Print(w io.Writer) {
+	fmt.Fprintf(w, "Format:            %s (header: %d bytes)\n", info.Format, info.HeaderSize)
+	fmt.Fprintf(w, "File size:         %d\n", info.FileSize)
+	fmt.Fprintf(w, "Words count:       %d\n", info.WordsCount)
+	fmt.Fprintf(w, "Empty words count: %d\n", info.EmptyWordsCount)
+	fmt.Fprintf(w, "Dictionary size:   %d\n", info.DictSize)
+
+	switch {
+	case !info.IdxExists:
+		fmt.Fprintf(w, "Index:             missing (%s)\n", info.IdxPath)
+	case info.IdxValid:
+		fmt.Fprintf(w, "Index:             valid (%s)\n", info.IdxPath)
+	default:
+		fmt.Fprintf(w, "Index:             invalid (%s): %v\n", info.IdxPath, info.IdxError)
+	}
+}
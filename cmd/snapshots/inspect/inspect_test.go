@@ -0,0 +1,105 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/recsplit"
+	"github.com/erigontech/erigon-lib/seg"
+	"github.com/erigontech/erigon/cmd/snapshots/downgrade"
+)
+
+// createSegment compresses words into a v1.0 segment and returns its content
+func createSegment(t *testing.T, path string, words [][]byte) []byte {
+	t.Helper()
+	c, err := seg.NewCompressor(context.Background(), "test", path, filepath.Dir(path), 1, 1, log.LvlDebug, log.New())
+	require.NoError(t, err)
+	defer c.Close()
+	c.DisableFsync()
+	for _, w := range words {
+		require.NoError(t, c.AddWord(w))
+	}
+	require.NoError(t, c.Compress())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
+
+// createIndex writes a recsplit index with keyCount keys next to segPath
+func createIndex(t *testing.T, segPath string, keyCount int) {
+	t.Helper()
+	dir := filepath.Dir(segPath)
+	idx, err := recsplit.NewRecSplit(recsplit.RecSplitArgs{
+		KeyCount:   keyCount,
+		BucketSize: 10,
+		TmpDir:     dir,
+		IndexFile:  segPath[:len(segPath)-len(".seg")] + ".idx",
+		LeafSize:   8,
+	}, log.New())
+	require.NoError(t, err)
+	defer idx.Close()
+	idx.DisableFsync()
+	for i := 0; i < keyCount; i++ {
+		require.NoError(t, idx.AddKey([]byte(fmt.Sprintf("key-%d", i)), uint64(i)))
+	}
+	require.NoError(t, idx.Build(context.Background()))
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	words := [][]byte{{}, []byte("alpha"), {}, []byte("beta"), []byte("gamma")}
+	v10Path := filepath.Join(dir, "v1-000000-000500-headers.seg")
+	data := createSegment(t, v10Path, words)
+	v11Path := filepath.Join(dir, "v1.1-000000-000500-headers.seg")
+	require.NoError(t, os.WriteFile(v11Path, append(make([]byte, 32), data...), 0644))
+	dictSize := binary.BigEndian.Uint64(data[16:24])
+
+	createIndex(t, v10Path, len(words))
+	info, err := Inspect(v10Path)
+	require.NoError(t, err)
+	require.Equal(t, downgrade.FormatV10, info.Format)
+	require.Zero(t, info.HeaderSize)
+	require.Equal(t, uint64(len(words)), info.WordsCount)
+	require.Equal(t, uint64(2), info.EmptyWordsCount)
+	require.Equal(t, dictSize, info.DictSize)
+	require.Equal(t, int64(len(data)), info.FileSize)
+	require.True(t, info.IdxExists)
+	require.True(t, info.IdxValid, "%v", info.IdxError)
+
+	// the fields are read past the v1.1 header
+	info, err = Inspect(v11Path)
+	require.NoError(t, err)
+	require.Equal(t, "v1.1", info.Format)
+	require.Equal(t, int64(32), info.HeaderSize)
+	require.Equal(t, uint64(len(words)), info.WordsCount)
+	require.Equal(t, uint64(2), info.EmptyWordsCount)
+	require.Equal(t, dictSize, info.DictSize)
+	require.Equal(t, int64(len(data)+32), info.FileSize)
+	require.False(t, info.IdxExists)
+	require.False(t, info.IdxValid)
+
+	// an index that doesn't cover the words is reported invalid
+	createIndex(t, v11Path, 2)
+	info, err = Inspect(v11Path)
+	require.NoError(t, err)
+	require.True(t, info.IdxExists)
+	require.False(t, info.IdxValid)
+	require.ErrorContains(t, info.IdxError, "index has 2 keys, segment has 5 words")
+
+	var out bytes.Buffer
+	info.Print(&out)
+	require.Contains(t, out.String(), "Format:            v1.1 (header: 32 bytes)")
+	require.Contains(t, out.String(), "Words count:       5")
+	require.Contains(t, out.String(), "Index:             invalid")
+
+	_, err = Inspect(filepath.Join(dir, "v1-000000-000500-headers.idx"))
+	require.ErrorContains(t, err, "is not a segment file")
+}
@@ -16,7 +16,9 @@ import (
 	"github.com/erigontech/erigon/cmd/snapshots/cmp"
 	"github.com/erigontech/erigon/cmd/snapshots/copy"
 	"github.com/erigontech/erigon/cmd/snapshots/downgrade"
+	"github.com/erigontech/erigon/cmd/snapshots/inspect"
 	"github.com/erigontech/erigon/cmd/snapshots/manifest"
+	"github.com/erigontech/erigon/cmd/snapshots/reindex"
 	"github.com/erigontech/erigon/cmd/snapshots/sync"
 	"github.com/erigontech/erigon/cmd/snapshots/torrents"
 	"github.com/erigontech/erigon/cmd/snapshots/verify"
@@ -38,6 +40,9 @@ func main() {
 		&cmp.Command,
 		&copy.Command,
 		&downgrade.Command,
+		&downgrade.BackupsCommand,
+		&inspect.Command,
+		&reindex.Command,
 		&verify.Command,
 		&torrents.Command,
 		&manifest.Command,
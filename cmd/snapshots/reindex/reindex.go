@@ -0,0 +1,174 @@
+package reindex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/erigontech/erigon-lib/chain"
+	"github.com/erigontech/erigon-lib/downloader/snaptype"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon/cmd/snapshots/sync"
+	"github.com/erigontech/erigon/cmd/utils"
+	_ "github.com/erigontech/erigon/core/snaptype"
+	"github.com/erigontech/erigon/params"
+	"github.com/erigontech/erigon/turbo/logging"
+)
+
+var (
+	WorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: `Number of segments to index in parallel`,
+		Value: runtime.NumCPU(),
+	}
+)
+
+var Command = cli.Command{
+	Action:    reindex,
+	Name:      "reindex",
+	Usage:     "rebuild missing v1.0 indexes of snapshot segments",
+	ArgsUsage: "<snapshots-dir|file.seg>",
+	Flags: []cli.Flag{
+		&WorkersFlag,
+		&utils.ChainFlag,
+		&utils.DataDirFlag,
+		&logging.LogVerbosityFlag,
+		&logging.LogConsoleVerbosityFlag,
+		&logging.LogDirVerbosityFlag,
+	},
+	Description: `Builds the v1.0 indexes of snapshot segments which don't have a valid one,
+e.g. after "snapshots downgrade" removed them. Segments whose indexes already
+exist and are newer than the segment are left untouched.
+
+Example:
+  snapshots reindex /path/to/snapshots
+  snapshots reindex --workers=4 /path/to/snapshots/v1-000000-000500-headers.seg`,
+}
+
+func reindex(cliCtx *cli.Context) error {
+	var path string
+
+	if cliCtx.Args().Len() > 0 {
+		path = cliCtx.Args().Get(0)
+	} else if dataDir := cliCtx.String(utils.DataDirFlag.Name); dataDir != "" {
+		path = filepath.Join(dataDir, "snapshots")
+	} else {
+		return fmt.Errorf("please provide snapshots directory or segment as argument or use --datadir flag")
+	}
+
+	chainConfig := params.ChainConfigByChainName(cliCtx.String(utils.ChainFlag.Name))
+	if chainConfig == nil {
+		return fmt.Errorf("unknown chain: %s", cliCtx.String(utils.ChainFlag.Name))
+	}
+
+	logger := sync.Logger(cliCtx.Context)
+
+	built, err := Reindex(cliCtx.Context, path, chainConfig, cliCtx.Int(WorkersFlag.Name), logger)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rebuilt indexes of %d segments\n", built)
+	return nil
+}
+
+// Reindex builds the missing indexes of the v1.0 segments at path, which is
+// either a snapshots directory or a single .seg file, using up to workers
+// goroutines. It returns the number of segments that were indexed.
+func Reindex(ctx context.Context, path string, chainConfig *chain.Config, workers int, logger log.Logger) (int, error) {
+	segments, err := missingIndexes(path, logger)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(segments) == 0 {
+		return 0, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "snapshots-reindex")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+
+	for _, info := range segments {
+		info := info
+		g.Go(func() error {
+			logger.Info("[reindex] building", "segment", info.Name())
+			if err := info.Type.BuildIndexes(gctx, info, chainConfig, tmpDir, nil, log.LvlDebug, logger); err != nil {
+				return fmt.Errorf("%s: %w", info.Name(), err)
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return 0, err
+	}
+
+	return len(segments), nil
+}
+
+// missingIndexes returns the v1.0 segments at path which have a known type
+// and don't have all of their indexes
+func missingIndexes(path string, logger log.Logger) ([]snaptype.FileInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var dir string
+	var names []string
+
+	if stat.IsDir() {
+		dir = path
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".seg") {
+				names = append(names, entry.Name())
+			}
+		}
+	} else {
+		if !strings.HasSuffix(path, ".seg") {
+			return nil, fmt.Errorf("%s is not a segment file", path)
+		}
+		dir, names = filepath.Dir(path), []string{filepath.Base(path)}
+	}
+
+	var segments []snaptype.FileInfo
+
+	for _, name := range names {
+		info, _, ok := snaptype.ParseFileName(dir, name)
+		if !ok || info.Type == nil || info.Version != snaptype.V1_0 {
+			logger.Debug("[reindex] skipping", "file", name)
+			continue
+		}
+
+		if info.Type.HasIndexFiles(info, logger) {
+			continue
+		}
+
+		segments = append(segments, info)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Name() < segments[j].Name() })
+
+	return segments, nil
+}
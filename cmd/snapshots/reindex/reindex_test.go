@@ -0,0 +1,81 @@
+package reindex
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon-lib/downloader/snaptype"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/recsplit"
+	"github.com/erigontech/erigon-lib/rlp"
+	"github.com/erigontech/erigon-lib/seg"
+	coresnaptype "github.com/erigontech/erigon/core/snaptype"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/params"
+)
+
+// createHeadersSegment writes a v1.0 headers segment with count headers and
+// returns them
+func createHeadersSegment(t *testing.T, dir string, count int) []*types.Header {
+	t.Helper()
+	logger := log.New()
+	path := filepath.Join(dir, snaptype.SegmentFileName(snaptype.V1_0, 0, 500, coresnaptype.Enums.Headers))
+	c, err := seg.NewCompressor(context.Background(), "test", path, dir, 1, 1, log.LvlDebug, logger)
+	require.NoError(t, err)
+	defer c.Close()
+	c.DisableFsync()
+
+	headers := make([]*types.Header, count)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i)), Difficulty: big.NewInt(1)}
+		headerRlp, err := rlp.EncodeToBytes(headers[i])
+		require.NoError(t, err)
+		hash := headers[i].Hash()
+		require.NoError(t, c.AddWord(append([]byte{hash[0]}, headerRlp...)))
+	}
+	require.NoError(t, c.Compress())
+	return headers
+}
+
+func TestReindexHeaders(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New()
+	ctx := context.Background()
+	headers := createHeadersSegment(t, dir, 100)
+	segPath := filepath.Join(dir, snaptype.SegmentFileName(snaptype.V1_0, 0, 500, coresnaptype.Enums.Headers))
+	idxPath := filepath.Join(dir, snaptype.IdxFileName(snaptype.V1_0, 0, 500, coresnaptype.Indexes.HeaderHash.Name))
+
+	built, err := Reindex(ctx, dir, params.MainnetChainConfig, 2, logger)
+	require.NoError(t, err)
+	require.Equal(t, 1, built)
+
+	// a valid index is left alone
+	built, err = Reindex(ctx, dir, params.MainnetChainConfig, 2, logger)
+	require.NoError(t, err)
+	require.Equal(t, 0, built)
+
+	for _, path := range []string{dir, segPath} {
+		require.NoError(t, os.Remove(idxPath))
+
+		built, err = Reindex(ctx, path, params.MainnetChainConfig, 2, logger)
+		require.NoError(t, err)
+		require.Equal(t, 1, built)
+
+		idx, err := recsplit.OpenIndex(idxPath)
+		require.NoError(t, err)
+		require.Equal(t, uint64(len(headers)), idx.KeyCount())
+		reader := recsplit.NewIndexReader(idx)
+		for i, header := range headers {
+			hash := header.Hash()
+			ordinal, ok := reader.Lookup(hash[:])
+			require.True(t, ok)
+			require.Equal(t, uint64(i), ordinal)
+		}
+		idx.Close()
+	}
+}
@@ -983,6 +983,21 @@ var (
 		Usage: "enables archival node in caplin",
 		Value: false,
 	}
+	CaplinSkipWeakSubjectivityCheckFlag = cli.BoolFlag{
+		Name:  "caplin.checkpoint-sync.skip-ws-check",
+		Usage: "accept checkpoint states older than the weak subjectivity period",
+		Value: false,
+	}
+	CaplinCheckpointSyncAttemptsFlag = cli.IntFlag{
+		Name:  "caplin.checkpoint-sync.attempts",
+		Usage: "how many times all checkpoint sync endpoints are tried before starting from genesis",
+		Value: 3,
+	}
+	CaplinCheckpointSyncBackoffFlag = cli.DurationFlag{
+		Name:  "caplin.checkpoint-sync.backoff",
+		Usage: "wait before retrying the checkpoint sync endpoints, doubled for every further attempt",
+		Value: 5 * time.Second,
+	}
 	BeaconApiAllowCredentialsFlag = cli.BoolFlag{
 		Name:  "beacon.api.cors.allow-credentials",
 		Usage: "set the cors' allow credentials",
@@ -1669,6 +1684,9 @@ func setCaplin(ctx *cli.Context, cfg *ethconfig.Config) {
 	cfg.CaplinConfig.BlobBackfilling = ctx.Bool(CaplinBlobBackfillingFlag.Name)
 	cfg.CaplinConfig.BlobPruningDisabled = ctx.Bool(CaplinDisableBlobPruningFlag.Name)
 	cfg.CaplinConfig.Archive = ctx.Bool(CaplinArchiveFlag.Name)
+	cfg.CaplinConfig.SkipWeakSubjectivityCheck = ctx.Bool(CaplinSkipWeakSubjectivityCheckFlag.Name)
+	cfg.CaplinConfig.CheckpointSyncAttempts = ctx.Int(CaplinCheckpointSyncAttemptsFlag.Name)
+	cfg.CaplinConfig.CheckpointSyncBackoff = ctx.Duration(CaplinCheckpointSyncBackoffFlag.Name)
 }
 
 func setSilkworm(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -194,6 +194,13 @@ type EngineWriter interface {
 	APIs(chain ChainHeaderReader) []rpc.API
 }
 
+// SysCallAuthorer is implemented by engines whose system calls must run with
+// a specific author, the coinbase of their block context, instead of the
+// system address (or the header's coinbase on Bor)
+type SysCallAuthorer interface {
+	SysCallAuthor(header *types.Header) libcommon.Address
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
@@ -16,7 +16,12 @@
 
 package consensus
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+)
 
 var (
 	// ErrInvalidBlock is a generic error to wrap all non-transient genuine protocol validation errors.
@@ -50,3 +55,15 @@ var (
 	// ErrUnexpectedRequests is returned if a pre-Prague block has EIP-7685 requests.
 	ErrUnexpectedRequests = errors.New("unexpected requests")
 )
+
+// ErrRequestsHashMismatch is returned when the hash of the EIP-7685 requests
+// collected by the execution of a block differs from the requests hash of its
+// header.
+type ErrRequestsHashMismatch struct {
+	Computed libcommon.Hash
+	Expected libcommon.Hash
+}
+
+func (e *ErrRequestsHashMismatch) Error() string {
+	return fmt.Sprintf("requests hash computed from block: %x, in header: %x", e.Computed, e.Expected)
+}
@@ -182,10 +182,11 @@ func (s *Merge) Finalize(config *chain.Config, header *types.Header, state *stat
 		if consolidations != nil {
 			rs = append(rs, *consolidations)
 		}
+		// verifyHeader requires the hash, FinalizeAndAssemble clears it
 		if header.RequestsHash != nil {
 			rh := rs.Hash()
 			if *header.RequestsHash != *rh {
-				return nil, nil, nil, fmt.Errorf("error: invalid requests root hash in header, expected: %v, got :%v", header.RequestsHash, rh)
+				return nil, nil, nil, &consensus.ErrRequestsHashMismatch{Computed: *rh, Expected: *header.RequestsHash}
 			}
 		}
 	}
@@ -1,14 +1,17 @@
 package merge
 
 import (
+	"errors"
 	"math/big"
 	"testing"
 
 	"github.com/erigontech/erigon-lib/chain"
 	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/log/v3"
 
 	"github.com/erigontech/erigon/consensus"
 	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/params"
 )
 
 type readerMock struct{}
@@ -89,3 +92,32 @@ func TestVerifyHeaderNonce(t *testing.T) {
 		}
 	}
 }
+
+func TestFinalizeRequestsHash(t *testing.T) {
+	config := &chain.Config{PragueTime: big.NewInt(0)}
+	syscall := func(contract libcommon.Address, data []byte) ([]byte, error) {
+		if contract == params.WithdrawalRequestAddress {
+			return []byte{0x01}, nil
+		}
+		return nil, nil
+	}
+	expected := types.FlatRequests{{Type: types.WithdrawalRequestType, RequestData: []byte{0x01}}}.Hash()
+	finalize := func(requestsHash *libcommon.Hash) error {
+		header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0), RequestsHash: requestsHash}
+		_, _, _, err := New(nil).Finalize(config, header, nil, nil, nil, nil, nil, nil, syscall, log.New())
+		return err
+	}
+
+	if err := finalize(expected); err != nil {
+		t.Fatalf("Merge engine should accept the requests hash, got %s", err.Error())
+	}
+
+	var mismatch *consensus.ErrRequestsHashMismatch
+	err := finalize(&libcommon.Hash{0x01})
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Merge engine should not accept a tampered requests hash, got %v", err)
+	}
+	if mismatch.Computed != *expected || mismatch.Expected != (libcommon.Hash{0x01}) {
+		t.Fatalf("unexpected mismatch %s", mismatch.Error())
+	}
+}
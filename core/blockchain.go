@@ -18,11 +18,14 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"slices"
 	"time"
 
+	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
 
 	math2 "github.com/erigontech/erigon-lib/common/math"
@@ -35,6 +38,7 @@ import (
 	"github.com/erigontech/erigon-lib/common/dbg"
 	"github.com/erigontech/erigon-lib/common/math"
 	"github.com/erigontech/erigon-lib/metrics"
+	types2 "github.com/erigontech/erigon-lib/types"
 	"github.com/erigontech/erigon/common/u256"
 	"github.com/erigontech/erigon/consensus"
 
@@ -67,59 +71,314 @@ type RejectedTx struct {
 type RejectedTxs []*RejectedTx
 
 type EphemeralExecResult struct {
-	StateRoot        libcommon.Hash         `json:"stateRoot"`
-	TxRoot           libcommon.Hash         `json:"txRoot"`
-	ReceiptRoot      libcommon.Hash         `json:"receiptsRoot"`
-	LogsHash         libcommon.Hash         `json:"logsHash"`
-	Bloom            types.Bloom            `json:"logsBloom"        gencodec:"required"`
-	Receipts         types.Receipts         `json:"receipts"`
-	Rejected         RejectedTxs            `json:"rejected,omitempty"`
-	Difficulty       *math2.HexOrDecimal256 `json:"currentDifficulty" gencodec:"required"`
-	GasUsed          math.HexOrDecimal64    `json:"gasUsed"`
-	StateSyncReceipt *types.Receipt         `json:"-"`
+	StateRoot   libcommon.Hash         `json:"stateRoot"`
+	TxRoot      libcommon.Hash         `json:"txRoot"`
+	ReceiptRoot libcommon.Hash         `json:"receiptsRoot"`
+	LogsHash    libcommon.Hash         `json:"logsHash"`
+	Bloom       types.Bloom            `json:"logsBloom"        gencodec:"required"`
+	Receipts    types.Receipts         `json:"receipts"`
+	Rejected    RejectedTxs            `json:"rejected,omitempty"`
+	Difficulty  *math2.HexOrDecimal256 `json:"currentDifficulty" gencodec:"required"`
+	GasUsed     math.HexOrDecimal64    `json:"gasUsed"`
+	// Fields of later forks, named and encoded as in the reference t8n output
+	BaseFee              *math2.HexOrDecimal256 `json:"currentBaseFee,omitempty"`
+	WithdrawalsRoot      *libcommon.Hash        `json:"withdrawalsRoot,omitempty"`
+	CurrentExcessBlobGas *math.HexOrDecimal64   `json:"currentExcessBlobGas,omitempty"`
+	CurrentBlobGasUsed   *math.HexOrDecimal64   `json:"blobGasUsed,omitempty"`
+	RequestsHash         *libcommon.Hash        `json:"requestsHash,omitempty"`
+	StateSyncReceipt     *types.Receipt         `json:"-"`
+	// HasStateSync reports whether StateSyncReceipt carries state-sync logs
+	HasStateSync bool `json:"-"`
+	// GasByTxType and CountByTxType tally the gas used and the number of the
+	// included transactions, keyed by transaction type
+	GasByTxType   map[uint8]uint64 `json:"-"`
+	CountByTxType map[uint8]int    `json:"-"`
+	// AccessLists holds the accounts and storage slots touched by each
+	// transaction of the block, in block order, when vm.Config.CollectAccessLists is set
+	AccessLists []types2.AccessList `json:"-"`
+	// OpcodeGas tallies the gas charged by each opcode across the transactions
+	// of the block when vm.Config.CollectOpcodeGas is set
+	OpcodeGas map[vm.OpCode]uint64 `json:"-"`
+	// TxOrderingViolations lists the transactions breaking the nonce and base
+	// fee ordering of the block when vm.Config.ValidateTxOrdering is set
+	TxOrderingViolations []TxOrderingViolation `json:"-"`
+	// Logs holds the logs of the block in order, Bor state-sync logs last,
+	// with their block and transaction fields derived, when
+	// vm.Config.CollectLogs is set and the execution wasn't stopped early
+	Logs []*types.Log `json:"-"`
+	// PartialState is the live intra-block state of an execution stopped by
+	// vm.Config.StopAfterTxIndex, nil otherwise. A reused IntraBlockState
+	// passed to ExecuteBlockEphemerally is only valid until its next use.
+	PartialState *state.IntraBlockState `json:"-"`
+}
+
+// Equal reports whether r and other describe the same execution outcome, see Diff
+func (r *EphemeralExecResult) Equal(other *EphemeralExecResult) bool {
+	return r.Diff(other) == ""
+}
+
+// Diff describes the first field in which r and other differ, or returns ""
+// if they are equal. Receipts are compared through ReceiptRoot.
+func (r *EphemeralExecResult) Diff(other *EphemeralExecResult) string {
+	switch {
+	case r == nil || other == nil:
+		if r == other {
+			return ""
+		}
+		return fmt.Sprintf("result: %v != %v", r != nil, other != nil)
+	case r.StateRoot != other.StateRoot:
+		return fmt.Sprintf("stateRoot: %x != %x", r.StateRoot, other.StateRoot)
+	case r.TxRoot != other.TxRoot:
+		return fmt.Sprintf("txRoot: %x != %x", r.TxRoot, other.TxRoot)
+	case r.ReceiptRoot != other.ReceiptRoot:
+		return fmt.Sprintf("receiptsRoot: %x != %x", r.ReceiptRoot, other.ReceiptRoot)
+	case r.LogsHash != other.LogsHash:
+		return fmt.Sprintf("logsHash: %x != %x", r.LogsHash, other.LogsHash)
+	case r.Bloom != other.Bloom:
+		return fmt.Sprintf("logsBloom: %x != %x", r.Bloom, other.Bloom)
+	case r.GasUsed != other.GasUsed:
+		return fmt.Sprintf("gasUsed: %d != %d", r.GasUsed, other.GasUsed)
+	case !hexOrDecimalEqual(r.Difficulty, other.Difficulty):
+		return fmt.Sprintf("currentDifficulty: %v != %v", (*big.Int)(r.Difficulty), (*big.Int)(other.Difficulty))
+	}
+	if len(r.Rejected) != len(other.Rejected) {
+		return fmt.Sprintf("rejected: %d txs != %d txs", len(r.Rejected), len(other.Rejected))
+	}
+	for i := range r.Rejected {
+		if *r.Rejected[i] != *other.Rejected[i] {
+			return fmt.Sprintf("rejected[%d]: %+v != %+v", i, *r.Rejected[i], *other.Rejected[i])
+		}
+	}
+	return ""
+}
+
+func hexOrDecimalEqual(a, b *math2.HexOrDecimal256) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return (*big.Int)(a).Cmp((*big.Int)(b)) == 0
+}
+
+// TracerFactory provides the tracers used by ExecuteBlockEphemerally when
+// vmConfig.Debug is set and no vmConfig.Tracer is configured.
+// NewTracer is called before every transaction; tracers implementing
+// vm.FlushableTracer are flushed after it. OnBlockEnd is called exactly once
+// after all transactions of the block, so block-level tracers can emit results.
+type TracerFactory interface {
+	NewTracer(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error)
+	OnBlockEnd()
+}
+
+// TracerFactoryFunc adapts a plain per-transaction tracer constructor to TracerFactory
+type TracerFactoryFunc func(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error)
+
+func (f TracerFactoryFunc) NewTracer(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error) {
+	return f(txIndex, txHash)
+}
+
+func (f TracerFactoryFunc) OnBlockEnd() {}
+
+// MultiTracerFactoryFunc adapts a constructor of several tracers per
+// transaction to TracerFactory, fanning the EVM hooks out to all of them
+// through a vm.MultiTracer
+type MultiTracerFactoryFunc func(txIndex int, txHash libcommon.Hash) ([]vm.EVMLogger, error)
+
+func (f MultiTracerFactoryFunc) NewTracer(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error) {
+	tracers, err := f(txIndex, txHash)
+	if err != nil {
+		return nil, err
+	}
+	return vm.NewMultiTracer(tracers...), nil
+}
+
+func (f MultiTracerFactoryFunc) OnBlockEnd() {}
+
+// ExecutionBuffers holds the per-block scratch state of ExecuteBlockEphemerally
+// so sync loops can reuse it across blocks instead of reallocating it.
+// Buffers are reset at the start of every block: the Receipts of a result
+// produced with them are only valid until the buffers are used again.
+// Not safe for concurrent use.
+type ExecutionBuffers struct {
+	includedTxs types.Transactions
+	receipts    types.Receipts
+	gasPool     GasPool
+	usedGas     uint64
+	usedBlobGas uint64
+	senders     *SenderCache // not reset between blocks
+}
+
+func NewExecutionBuffers() *ExecutionBuffers {
+	return &ExecutionBuffers{}
+}
+
+// WithSenderCache makes the blocks executed with b share senders through
+// cache, so that transactions seen in earlier blocks of a batch aren't
+// recovered again
+func (b *ExecutionBuffers) WithSenderCache(cache *SenderCache) *ExecutionBuffers {
+	b.senders = cache
+	return b
+}
+
+func (b *ExecutionBuffers) reset(txCount int) {
+	clear(b.includedTxs)
+	clear(b.receipts)
+	b.includedTxs = slices.Grow(b.includedTxs[:0], txCount)
+	b.receipts = slices.Grow(b.receipts[:0], txCount)
+	b.gasPool = GasPool{}
+	b.usedGas, b.usedBlobGas = 0, 0
+}
+
+// validateWithdrawalsRoot checks withdrawals against the withdrawals root of
+// header. Headers without a root, from before Shanghai, accept no withdrawals.
+func validateWithdrawalsRoot(header *types.Header, withdrawals types.Withdrawals, root *libcommon.Hash) error {
+	if header.WithdrawalsHash == nil {
+		if len(withdrawals) > 0 {
+			return ErrUnexpectedWithdrawals
+		}
+		return nil
+	}
+	if root == nil {
+		derived := types.DeriveSha(withdrawals)
+		root = &derived
+	}
+	if *root != *header.WithdrawalsHash {
+		return &ErrWithdrawalsRootMismatch{Computed: *root, Expected: *header.WithdrawalsHash}
+	}
+	return nil
+}
+
+// ExpectedRequestsHash returns the EIP-7685 requests hash the header of a block
+// with the given requests commits to: nil before Prague, the hash of an empty
+// list if the engine collected no requests.
+func ExpectedRequestsHash(cc *chain.Config, header *types.Header, requests types.FlatRequests) *libcommon.Hash {
+	if !cc.IsPrague(header.Time) {
+		return nil
+	}
+	if requests == nil {
+		requests = types.FlatRequests{}
+	}
+	return requests.Hash()
+}
+
+// validatePostMergeUncles rejects uncles in a block of a chain past the merge,
+// which a zero difficulty marks as proof-of-stake
+func validatePostMergeUncles(chainConfig *chain.Config, block *types.Block) error {
+	header := block.HeaderNoCopy()
+	if chainConfig.TerminalTotalDifficulty == nil || header.Difficulty == nil || header.Difficulty.Sign() != 0 {
+		return nil
+	}
+	if len(block.Uncles()) > 0 || header.UncleHash != types.EmptyUncleHash {
+		return fmt.Errorf("%w: block %d has %d uncles, uncle hash %x", ErrPostMergeUncles, header.Number.Uint64(), len(block.Uncles()), header.UncleHash)
+	}
+	return nil
 }
 
 // ExecuteBlockEphemerally runs a block from provided stateReader and
-// writes the result to the provided stateWriter
+// writes the result to the provided stateWriter.
+// buffers is optional; pass the same ExecutionBuffers across blocks to reuse allocations,
+// and set a SenderCache on them to reuse recovered senders. Senders already
+// cached on the transactions are trusted and never recovered again.
+// ibs is optional too; a non-nil ibs is Reset and re-pointed at stateReader
+// instead of allocating a new IntraBlockState for the block.
 func ExecuteBlockEphemerally(
 	chainConfig *chain.Config, vmConfig *vm.Config,
 	blockHashFunc func(n uint64) libcommon.Hash,
 	engine consensus.Engine, block *types.Block,
 	stateReader state.StateReader, stateWriter state.WriterWithChangeSets,
-	chainReader consensus.ChainReader, getTracer func(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error),
-	logger log.Logger,
+	chainReader consensus.ChainReader, tracerFactory TracerFactory,
+	buffers *ExecutionBuffers, ibs *state.IntraBlockState, logger log.Logger,
 ) (*EphemeralExecResult, error) {
 
-	defer blockExecutionTimer.ObserveDuration(time.Now())
-	block.Uncles()
-	ibs := state.New(stateReader)
+	start := time.Now()
+	defer blockExecutionTimer.ObserveDuration(start)
+	if tracerFactory != nil {
+		defer tracerFactory.OnBlockEnd()
+	}
+	if !vmConfig.StatelessExec {
+		if err := validatePostMergeUncles(chainConfig, block); err != nil {
+			return nil, err
+		}
+	}
+	if ibs == nil {
+		ibs = state.New(stateReader)
+	} else {
+		ibs.Reset()
+		ibs.SetStateReader(stateReader)
+	}
 	header := block.Header()
 
-	usedGas := new(uint64)
-	usedBlobGas := new(uint64)
-	gp := new(GasPool)
-	gp.AddGas(block.GasLimit()).AddBlobGas(chainConfig.GetMaxBlobGasPerBlock(block.Time()))
+	if buffers == nil {
+		buffers = &ExecutionBuffers{}
+	}
+	buffers.reset(block.Transactions().Len())
+	signer := types.MakeSigner(chainConfig, header.Number.Uint64(), header.Time)
+	if buffers.senders != nil {
+		buffers.senders.useChain(chainConfig)
+		buffers.senders.setSenders(block.Transactions(), signer)
+	}
+	var orderingViolations []TxOrderingViolation
+	if vmConfig.ValidateTxOrdering {
+		orderingViolations = txOrderingViolations(block.Transactions(), header, signer)
+	}
+	usedGas := &buffers.usedGas
+	usedBlobGas := &buffers.usedBlobGas
+	gp := &buffers.gasPool
+	maxBlobGas := chainConfig.GetMaxBlobGasPerBlock(block.Time())
+	if vmConfig.MaxBlobGasPerBlockOverride != nil {
+		maxBlobGas = vmConfig.MaxBlobGasPerBlockOverride(block.Time())
+	}
+	gp.AddGas(block.GasLimit()).AddBlobGas(maxBlobGas)
 
 	if err := InitializeBlockExecution(engine, chainReader, block.Header(), chainConfig, ibs, logger); err != nil {
 		return nil, err
 	}
 
 	var rejectedTxs []*RejectedTx
-	includedTxs := make(types.Transactions, 0, block.Transactions().Len())
-	receipts := make(types.Receipts, 0, block.Transactions().Len())
+	includedTxs := buffers.includedTxs
+	receipts := buffers.receipts
 	noop := state.NewNoopWriter()
+	gasByTxType := map[uint8]uint64{}
+	countByTxType := map[uint8]int{}
+	rules := chainConfig.Rules(header.Number.Uint64(), header.Time)
+	isEIP3860 := vmConfig.HasEip3860(rules)
+	var accessLists []types2.AccessList
+	if vmConfig.CollectAccessLists {
+		accessLists = make([]types2.AccessList, 0, block.Transactions().Len())
+	}
+	var opcodeGas *vm.OpcodeGasTracer
+	if vmConfig.CollectOpcodeGas {
+		opcodeGas = vm.NewOpcodeGasTracer()
+	}
 	for i, tx := range block.Transactions() {
 		ibs.SetTxContext(tx.Hash(), block.Hash(), i)
 		writeTrace := false
-		if vmConfig.Debug && vmConfig.Tracer == nil {
-			tracer, err := getTracer(i, tx.Hash())
+		if vmConfig.Debug && vmConfig.Tracer == nil && tracerFactory != nil {
+			tracer, err := tracerFactory.NewTracer(i, tx.Hash())
 			if err != nil {
 				return nil, fmt.Errorf("could not obtain tracer: %w", err)
 			}
 			vmConfig.Tracer = tracer
 			writeTrace = true
 		}
-		receipt, _, err := ApplyTransaction(chainConfig, blockHashFunc, engine, nil, gp, ibs, noop, header, tx, usedGas, usedBlobGas, *vmConfig)
+		gasBefore := *usedGas
+		var receipt *types.Receipt
+		if vmConfig.CollectAccessLists {
+			ibs.RecordAccesses()
+		}
+		var err error
+		if vmConfig.StatelessExec {
+			err = preValidateTransaction(tx, rules, isEIP3860)
+		}
+		if err == nil {
+			txConfig := *vmConfig
+			if opcodeGas != nil {
+				txConfig.Debug, txConfig.Tracer = true, vm.NewMultiTracer(txConfig.Tracer, opcodeGas)
+			}
+			receipt, _, err = ApplyTransaction(chainConfig, blockHashFunc, engine, nil, gp, ibs, noop, header, tx, usedGas, usedBlobGas, txConfig)
+		}
+		if vmConfig.CollectAccessLists {
+			accessLists = append(accessLists, ibs.TakeAccesses())
+		}
 		if writeTrace {
 			if ftracer, ok := vmConfig.Tracer.(vm.FlushableTracer); ok {
 				ftracer.Flush(tx)
@@ -130,22 +389,39 @@ func ExecuteBlockEphemerally(
 
 		if err != nil {
 			if !vmConfig.StatelessExec {
-				return nil, fmt.Errorf("could not apply tx %d from block %d [%v]: %w", i, block.NumberU64(), tx.Hash().Hex(), err)
+				return nil, &ErrTxApply{TxIndex: i, Block: block.NumberU64(), TxHash: tx.Hash(), Err: err}
 			}
 			rejectedTxs = append(rejectedTxs, &RejectedTx{i, err.Error()})
 		} else {
 			includedTxs = append(includedTxs, tx)
+			gasByTxType[tx.Type()] += *usedGas - gasBefore
+			countByTxType[tx.Type()]++
 			if !vmConfig.NoReceipts {
 				receipts = append(receipts, receipt)
 			}
 		}
+		if vmConfig.StopAfterTxIndex != nil && i >= *vmConfig.StopAfterTxIndex {
+			buffers.includedTxs, buffers.receipts = includedTxs, receipts
+			execRs := partialExecResult(ibs, header, includedTxs, receipts, rejectedTxs, *usedGas, vmConfig.NoReceipts)
+			execRs.GasByTxType, execRs.CountByTxType = gasByTxType, countByTxType
+			execRs.AccessLists = accessLists
+			if opcodeGas != nil {
+				execRs.OpcodeGas = opcodeGas.Gas()
+			}
+			execRs.TxOrderingViolations = orderingViolations
+			return execRs, nil
+		}
+	}
+
+	buffers.includedTxs, buffers.receipts = includedTxs, receipts
+	if chainConfig.Bor != nil {
+		// logs emitted from here on belong to the state-sync pseudo-transaction,
+		// which follows the transactions of the block
+		ibs.SetTxContext(bortypes.ComputeBorTxHash(block.NumberU64(), block.Hash()), block.Hash(), block.Transactions().Len())
 	}
 
 	receiptSha := types.DeriveSha(receipts)
 	if !vmConfig.StatelessExec && chainConfig.IsByzantium(header.Number.Uint64()) && !vmConfig.NoReceipts && receiptSha != block.ReceiptHash() {
-		if dbg.LogHashMismatchReason() {
-			logReceipts(receipts, includedTxs, chainConfig, header, logger)
-		}
 		// v18: Clean baseline - no CodeHash recovery diagnostics
 		logger.Warn("[DEBUG] Receipt mismatch details",
 			"block", block.NumberU64(),
@@ -154,66 +430,87 @@ func ExecuteBlockEphemerally(
 			"headerGasUsed", header.GasUsed,
 			"computedReceiptHash", receiptSha.Hex(),
 			"expectedReceiptHash", block.ReceiptHash().Hex())
-		// Log gas used per transaction
-		for i, receipt := range receipts {
-			logger.Warn("[DEBUG] TX receipt",
-				"txIndex", i,
-				"txHash", includedTxs[i].Hash().Hex(),
-				"gasUsed", receipt.GasUsed,
-				"cumulativeGas", receipt.CumulativeGasUsed,
-				"status", receipt.Status,
-				"logsCount", len(receipt.Logs))
+		if dbg.LogHashMismatchReason() {
+			// Full dump of every receipt, only on explicit request
+			logReceipts(receipts, includedTxs, chainConfig, header, logger)
+			for i, receipt := range receipts {
+				logger.Warn("[DEBUG] TX receipt",
+					"txIndex", i,
+					"txHash", includedTxs[i].Hash().Hex(),
+					"gasUsed", receipt.GasUsed,
+					"cumulativeGas", receipt.CumulativeGasUsed,
+					"status", receipt.Status,
+					"logsCount", len(receipt.Logs))
+			}
+		} else {
+			logReceiptDiff(receipts, includedTxs, header, logger)
 		}
-		return nil, fmt.Errorf("mismatched receipt headers for block %d (%s != %s)", block.NumberU64(), receiptSha.Hex(), block.ReceiptHash().Hex())
+		return nil, &ErrReceiptRootMismatch{Block: block.NumberU64(), Computed: receiptSha, Expected: block.ReceiptHash()}
 	}
 
 	if !vmConfig.StatelessExec && *usedGas != header.GasUsed {
-		return nil, fmt.Errorf("gas used by execution: %d, in header: %d", *usedGas, header.GasUsed)
+		return nil, &ErrGasUsedMismatch{Computed: *usedGas, Expected: header.GasUsed}
 	}
 
 	if header.BlobGasUsed != nil && *usedBlobGas != *header.BlobGasUsed {
-		return nil, fmt.Errorf("blob gas used by execution: %d, in header: %d", *usedBlobGas, *header.BlobGasUsed)
+		return nil, &ErrBlobGasMismatch{Computed: *usedBlobGas, Expected: *header.BlobGasUsed}
 	}
 
 	var bloom types.Bloom
-	if !vmConfig.NoReceipts {
+	if vmConfig.TrustHeaderBloom && vmConfig.StatelessExec {
+		bloom = header.Bloom
+	} else if !vmConfig.NoReceipts {
 		bloom = types.CreateBloom(receipts)
 		if !vmConfig.StatelessExec && bloom != header.Bloom {
-			return nil, fmt.Errorf("bloom computed by execution: %x, in header: %x", bloom, header.Bloom)
+			return nil, &ErrBloomMismatch{Computed: bloom, Expected: header.Bloom}
 		}
 	}
 
+	// the withdrawals root derived by finalization, if the block was finalized.
+	// The engine checks the requests hash in Finalize.
+	var withdrawalsRoot *libcommon.Hash
 	if !vmConfig.ReadOnly {
 		txs := block.Transactions()
-		if _, _, _, _, err := FinalizeBlockExecution(engine, stateReader, block.Header(), txs, block.Uncles(), stateWriter, chainConfig, ibs, receipts, block.Withdrawals(), chainReader, false, logger); err != nil {
+		var err error
+		if _, _, _, _, withdrawalsRoot, _, err = FinalizeBlockExecution(engine, stateReader, block.Header(), txs, block.Uncles(), stateWriter, chainConfig, ibs, receipts, block.Withdrawals(), chainReader, false, logger); err != nil {
+			return nil, err
+		}
+	}
+	if vmConfig.ValidateWithdrawalsRoot && !vmConfig.StatelessExec {
+		if err := validateWithdrawalsRoot(header, block.Withdrawals(), withdrawalsRoot); err != nil {
+			return nil, err
+		}
+	}
+	if vmConfig.StateRootHook != nil && !vmConfig.ReadOnly {
+		if err := checkStateRoot(stateWriter, block.NumberU64(), vmConfig.StateRootHook); err != nil {
 			return nil, err
 		}
 	}
 	blockLogs := ibs.Logs()
 	execRs := &EphemeralExecResult{
-		TxRoot:      types.DeriveSha(includedTxs),
-		ReceiptRoot: receiptSha,
-		Bloom:       bloom,
-		LogsHash:    rlpHash(blockLogs),
-		Receipts:    receipts,
-		Difficulty:  (*math2.HexOrDecimal256)(header.Difficulty),
-		GasUsed:     math.HexOrDecimal64(*usedGas),
-		Rejected:    rejectedTxs,
+		TxRoot:        types.DeriveSha(includedTxs),
+		ReceiptRoot:   receiptSha,
+		Bloom:         bloom,
+		LogsHash:      rlpHash(blockLogs),
+		Receipts:      receipts,
+		Difficulty:    (*math2.HexOrDecimal256)(header.Difficulty),
+		GasUsed:       math.HexOrDecimal64(*usedGas),
+		Rejected:      rejectedTxs,
+		GasByTxType:   gasByTxType,
+		CountByTxType: countByTxType,
+		AccessLists:   accessLists,
+	}
+	if opcodeGas != nil {
+		execRs.OpcodeGas = opcodeGas.Gas()
 	}
+	execRs.TxOrderingViolations = orderingViolations
+	setForkFields(execRs, header, *usedBlobGas)
 
 	if chainConfig.Bor != nil {
-		var logs []*types.Log
-		for _, receipt := range receipts {
-			logs = append(logs, receipt.Logs...)
-		}
-
 		stateSyncReceipt := &types.Receipt{}
-		if chainConfig.Consensus == chain.BorConsensus && len(blockLogs) > 0 {
-			slices.SortStableFunc(blockLogs, func(i, j *types.Log) int { return cmp.Compare(i.Index, j.Index) })
-
-			if len(blockLogs) > len(logs) {
-				stateSyncReceipt.Logs = blockLogs[len(logs):] // get state-sync logs from `state.Logs()`
-
+		if chainConfig.Consensus == chain.BorConsensus {
+			stateSyncReceipt.Logs = stateSyncLogs(blockLogs, block.Transactions().Len())
+			if len(stateSyncReceipt.Logs) > 0 {
 				// fill the state sync with the correct information
 				bortypes.DeriveFieldsForBorReceipt(stateSyncReceipt, block.Hash(), block.NumberU64(), receipts)
 				stateSyncReceipt.Status = types.ReceiptStatusSuccessful
@@ -221,11 +518,104 @@ func ExecuteBlockEphemerally(
 		}
 
 		execRs.StateSyncReceipt = stateSyncReceipt
+		execRs.HasStateSync = len(stateSyncReceipt.Logs) > 0
+	}
+
+	if vmConfig.RequireStateSync && chainConfig.Consensus == chain.BorConsensus && !execRs.HasStateSync {
+		return nil, fmt.Errorf("%w: block %d", ErrMissingStateSync, block.NumberU64())
+	}
+
+	if vmConfig.CollectLogs {
+		execRs.Logs = derivedLogs(ibs, includedTxs, block.NumberU64())
+		if execRs.HasStateSync {
+			execRs.Logs = append(execRs.Logs, execRs.StateSyncReceipt.Logs...)
+		}
+	}
+
+	if vmConfig.ExecEventSink != nil {
+		vmConfig.ExecEventSink(vm.BlockExecEvent{
+			Number:      block.NumberU64(),
+			Hash:        block.Hash(),
+			TxCount:     len(includedTxs),
+			GasUsed:     *usedGas,
+			BlobGasUsed: *usedBlobGas,
+			Duration:    time.Since(start),
+			Rejected:    len(rejectedTxs),
+		})
 	}
 
 	return execRs, nil
 }
 
+// partialExecResult describes the execution of a block prefix. The header
+// commits to the whole block, so it is neither checked nor finalised against.
+func partialExecResult(ibs *state.IntraBlockState, header *types.Header, includedTxs types.Transactions, receipts types.Receipts, rejectedTxs []*RejectedTx, usedGas uint64, noReceipts bool) *EphemeralExecResult {
+	var bloom types.Bloom
+	if !noReceipts {
+		bloom = types.CreateBloom(receipts)
+	}
+	return &EphemeralExecResult{
+		TxRoot:       types.DeriveSha(includedTxs),
+		ReceiptRoot:  types.DeriveSha(receipts),
+		Bloom:        bloom,
+		LogsHash:     rlpHash(ibs.Logs()),
+		Receipts:     receipts,
+		Difficulty:   (*math2.HexOrDecimal256)(header.Difficulty),
+		GasUsed:      math.HexOrDecimal64(usedGas),
+		Rejected:     rejectedTxs,
+		PartialState: ibs,
+	}
+}
+
+// derivedLogs returns the logs emitted by txs, in block order, with the block
+// number set. The intra-block state already derived their block hash,
+// transaction hash, transaction index and index, which receipts share.
+func derivedLogs(ibs *state.IntraBlockState, txs types.Transactions, blockNumber uint64) []*types.Log {
+	var logs []*types.Log
+	for _, tx := range txs {
+		for _, l := range ibs.GetLogs(tx.Hash()) {
+			l.BlockNumber = blockNumber
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// stateSyncLogs selects, in emission order, the logs of the Bor state-sync
+// pseudo-transaction, whose index follows the txCount transactions of the
+// block. Transactions emitting no logs don't shift the selection.
+func stateSyncLogs(logs []*types.Log, txCount int) []*types.Log {
+	var stateSync []*types.Log
+	for _, l := range logs {
+		if l.TxIndex == uint(txCount) {
+			stateSync = append(stateSync, l)
+		}
+	}
+	slices.SortStableFunc(stateSync, func(i, j *types.Log) int { return cmp.Compare(i.Index, j.Index) })
+	return stateSync
+}
+
+// setForkFields fills in the post-London fields of r from the header, with
+// the blob gas used taken from execution
+func setForkFields(r *EphemeralExecResult, header *types.Header, usedBlobGas uint64) {
+	if header.BaseFee != nil {
+		r.BaseFee = (*math2.HexOrDecimal256)(header.BaseFee)
+	}
+	r.WithdrawalsRoot = header.WithdrawalsHash
+	if header.ExcessBlobGas != nil {
+		r.CurrentExcessBlobGas = (*math.HexOrDecimal64)(header.ExcessBlobGas)
+	}
+	if header.BlobGasUsed != nil {
+		blobGasUsed := math.HexOrDecimal64(usedBlobGas)
+		r.CurrentBlobGasUsed = &blobGasUsed
+	}
+	r.RequestsHash = header.RequestsHash
+}
+
+// maxLoggedReceiptsSize caps the size of the receipts logged by logReceipts, in
+// bytes. The receipts that don't fit are only counted.
+var maxLoggedReceiptsSize = 1 << 20
+
 func logReceipts(receipts types.Receipts, txns types.Transactions, cc *chain.Config, header *types.Header, logger log.Logger) {
 	if len(receipts) == 0 {
 		// no-op, can happen if vmConfig.NoReceipts=true or vmConfig.StatelessExec=true
@@ -239,19 +629,78 @@ func logReceipts(receipts types.Receipts, txns types.Transactions, cc *chain.Con
 		return
 	}
 
-	marshalled := make([]map[string]interface{}, 0, len(receipts))
+	// receipts are encoded one at a time into a capped buffer, so that huge
+	// blocks neither allocate the whole encoding nor produce huge log lines
+	var result, scratch bytes.Buffer
+	enc := json.NewEncoder(&scratch)
+	result.WriteByte('[')
+	logged := 0
 	for i, receipt := range receipts {
 		txn := txns[i]
-		marshalled = append(marshalled, ethutils.MarshalReceipt(receipt, txn, cc, header, txn.Hash(), true))
+		scratch.Reset()
+		if err := enc.Encode(ethutils.MarshalReceipt(receipt, txn, cc, header, txn.Hash(), true)); err != nil {
+			logger.Error("marshalling error when logging receipts", "err", err)
+			return
+		}
+		encoded := bytes.TrimSuffix(scratch.Bytes(), []byte{'\n'})
+		if result.Len()+len(encoded)+2 > maxLoggedReceiptsSize {
+			break
+		}
+		if logged > 0 {
+			result.WriteByte(',')
+		}
+		result.Write(encoded)
+		logged++
 	}
+	result.WriteByte(']')
 
-	result, err := json.Marshal(marshalled)
-	if err != nil {
-		logger.Error("marshalling error when logging receipts", "err", err)
-		return
+	logger.Info("marshalled receipts", "result", result.String(), "omitted", len(receipts)-logged)
+}
+
+// firstDivergentReceipt returns the index of the first receipt whose cumulative gas
+// or status is inconsistent with re-deriving it from the preceding receipts and the
+// header, together with the reason. It returns -1 if all receipts are consistent.
+func firstDivergentReceipt(receipts types.Receipts, header *types.Header) (int, string) {
+	var cumulativeGas uint64
+	for i, receipt := range receipts {
+		cumulativeGas += receipt.GasUsed
+		switch {
+		case receipt.CumulativeGasUsed != cumulativeGas:
+			return i, fmt.Sprintf("cumulative gas %d, derived %d", receipt.CumulativeGasUsed, cumulativeGas)
+		case receipt.Status != types.ReceiptStatusFailed && receipt.Status != types.ReceiptStatusSuccessful:
+			return i, fmt.Sprintf("invalid status %d", receipt.Status)
+		case receipt.CumulativeGasUsed > header.GasUsed:
+			return i, fmt.Sprintf("cumulative gas %d exceeds header gas used %d", receipt.CumulativeGasUsed, header.GasUsed)
+		}
 	}
+	if cumulativeGas != header.GasUsed && len(receipts) > 0 {
+		return len(receipts) - 1, fmt.Sprintf("cumulative gas %d, header gas used %d", cumulativeGas, header.GasUsed)
+	}
+	return -1, ""
+}
 
-	logger.Info("marshalled receipts", "result", string(result))
+// logReceiptDiff logs only the first receipt that diverges from what re-derivation
+// implies, which pinpoints the offending transaction without dumping the whole block
+func logReceiptDiff(receipts types.Receipts, txns types.Transactions, header *types.Header, logger log.Logger) {
+	i, reason := firstDivergentReceipt(receipts, header)
+	if i < 0 {
+		logger.Warn("[DEBUG] No divergent receipt found, mismatch is in receipt content", "block", header.Number.Uint64())
+		return
+	}
+	receipt := receipts[i]
+	var txHash libcommon.Hash
+	if i < len(txns) {
+		txHash = txns[i].Hash()
+	}
+	logger.Warn("[DEBUG] First divergent receipt",
+		"block", header.Number.Uint64(),
+		"txIndex", i,
+		"txHash", txHash.Hex(),
+		"reason", reason,
+		"gasUsed", receipt.GasUsed,
+		"cumulativeGas", receipt.CumulativeGasUsed,
+		"status", receipt.Status,
+		"logsCount", len(receipt.Logs))
 }
 
 func rlpHash(x interface{}) (h libcommon.Hash) {
@@ -261,12 +710,14 @@ func rlpHash(x interface{}) (h libcommon.Hash) {
 	return h
 }
 
+// SysCallContract calls contract from the system address with the gas limit of
+// its SysCallType. A constCall reverts all state changes made by the call.
 func SysCallContract(contract libcommon.Address, data []byte, chainConfig *chain.Config, ibs *state.IntraBlockState, header *types.Header, engine consensus.EngineReader, constCall bool) (result []byte, err error) {
 	msg := types.NewMessage(
 		state.SystemAddress,
 		&contract,
 		0, u256.Num0,
-		SysCallGasLimit,
+		SysCallTypeOf(contract).GasLimit(),
 		u256.Num0,
 		nil, nil,
 		data, nil, false,
@@ -285,6 +736,10 @@ func SysCallContract(contract libcommon.Address, data []byte, chainConfig *chain
 		author = &state.SystemAddress
 		txContext = NewEVMTxContext(msg)
 	}
+	if authorer, ok := engine.(consensus.SysCallAuthorer); ok {
+		sysCallAuthor := authorer.SysCallAuthor(header)
+		author = &sysCallAuthor
+	}
 	blockContext := NewEVMBlockContext(header, GetHashFn(header, nil), engine, author, chainConfig)
 	evm := vm.NewEVM(blockContext, txContext, ibs, chainConfig, vmConfig)
 
@@ -302,13 +757,59 @@ func SysCallContract(contract libcommon.Address, data []byte, chainConfig *chain
 	return ret, err
 }
 
+// ConstCall runs a read-only call of to from an arbitrary sender on top of
+// ibs, with the state reverted afterwards. It returns the output of the call
+// and the gas it used. The revert is done here rather than through
+// vm.Config.RestoreState, which consumes all the gas left.
+func ConstCall(from, to libcommon.Address, data []byte, gas uint64, value *uint256.Int, chainConfig *chain.Config, ibs *state.IntraBlockState, header *types.Header, engine consensus.EngineReader) ([]byte, uint64, error) {
+	if value == nil {
+		value = u256.Num0
+	}
+	msg := types.NewMessage(
+		from,
+		&to,
+		0, value,
+		gas,
+		u256.Num0,
+		nil, nil,
+		data, nil, false,
+		true, // isFree
+		nil,  // maxFeePerBlobGas
+	)
+	vmConfig := vm.Config{NoReceipts: true}
+	blockContext := NewEVMBlockContext(header, GetHashFn(header, nil), engine, &header.Coinbase, chainConfig)
+	evm := vm.NewEVM(blockContext, NewEVMTxContext(msg), ibs, chainConfig, vmConfig)
+
+	snapshot := ibs.Snapshot()
+	defer ibs.RevertToSnapshot(snapshot)
+	ret, leftOverGas, err := evm.Call(
+		vm.AccountRef(msg.From()),
+		*msg.To(),
+		msg.Data(),
+		msg.Gas(),
+		msg.Value(),
+		false,
+	)
+	return ret, gas - leftOverGas, err
+}
+
 // SysCreate is a special (system) contract creation methods for genesis constructors.
+// Constructors get SysCallGasLimit, see SysCreateWithGasLimit.
 func SysCreate(contract libcommon.Address, data []byte, chainConfig chain.Config, ibs *state.IntraBlockState, header *types.Header) (result []byte, err error) {
+	return SysCreateWithGasLimit(contract, data, SysCallGasLimit, chainConfig, ibs, header)
+}
+
+// SysCreateWithGasLimit is SysCreate giving the constructor gasLimit gas, for
+// chains whose genesis constructors need more than SysCallGasLimit
+func SysCreateWithGasLimit(contract libcommon.Address, data []byte, gasLimit uint64, chainConfig chain.Config, ibs *state.IntraBlockState, header *types.Header) (result []byte, err error) {
+	if gasLimit == 0 {
+		return nil, fmt.Errorf("system create of %x: zero gas limit", contract)
+	}
 	msg := types.NewMessage(
 		contract,
 		nil, // to
 		0, u256.Num0,
-		SysCallGasLimit,
+		gasLimit,
 		u256.Num0,
 		nil, nil,
 		data, nil, false,
@@ -332,6 +833,16 @@ func SysCreate(contract libcommon.Address, data []byte, chainConfig chain.Config
 	return ret, err
 }
 
+// FinalizeBlockExecution finalizes the block with the engine and commits its
+// state to stateWriter. It also returns the withdrawals root and the requests
+// root of the block, derived from what was applied, which are nil before
+// Shanghai and Prague respectively.
+//
+// Finalization mutates ibs, so a failed call can't be retried on the same ibs.
+// An error from the engine leaves stateWriter untouched. A failed commit may
+// leave it partially written, and *ErrPartialFinalize means the state was
+// committed without its change sets; in both cases the transaction behind
+// stateWriter must be rolled back before the block is executed again.
 func FinalizeBlockExecution(
 	engine consensus.Engine, stateReader state.StateReader,
 	header *types.Header, txs types.Transactions, uncles []*types.Header,
@@ -340,6 +851,62 @@ func FinalizeBlockExecution(
 	withdrawals []*types.Withdrawal, chainReader consensus.ChainReader,
 	isMining bool,
 	logger log.Logger,
+) (newBlock *types.Block, newTxs types.Transactions, newReceipt types.Receipts, retRequests types.FlatRequests, withdrawalsRoot, requestsRoot *libcommon.Hash, err error) {
+	newBlock, newTxs, newReceipt, retRequests, err = FinalizeBlockExecutionDryRun(engine, header, txs, uncles, cc, ibs, receipts, withdrawals, chainReader, isMining, logger)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	if cc.IsShanghai(header.Time) {
+		root := types.DeriveSha(types.Withdrawals(withdrawals))
+		withdrawalsRoot = &root
+	}
+	requestsRoot = ExpectedRequestsHash(cc, header, retRequests)
+
+	if err := ibs.CommitBlock(cc.Rules(header.Number.Uint64(), header.Time), stateWriter); err != nil {
+		return nil, nil, nil, nil, nil, nil, fmt.Errorf("committing block %d failed: %w", header.Number.Uint64(), err)
+	}
+
+	if err := stateWriter.WriteChangeSets(); err != nil {
+		return nil, nil, nil, nil, nil, nil, &ErrPartialFinalize{Block: header.Number.Uint64(), Err: err}
+	}
+	return newBlock, newTxs, newReceipt, retRequests, withdrawalsRoot, requestsRoot, nil
+}
+
+// StateRootWriter is a state writer able to compute the state root of what
+// was committed to it, as needed by vm.Config.StateRootHook. It is
+// implemented by state.HashedStateWriter.
+type StateRootWriter interface {
+	state.WriterWithChangeSets
+	StateRoot() (libcommon.Hash, error)
+}
+
+// checkStateRoot passes the state root committed to stateWriter to hook
+func checkStateRoot(stateWriter state.WriterWithChangeSets, block uint64, hook func(libcommon.Hash) error) error {
+	rootWriter, ok := stateWriter.(StateRootWriter)
+	if !ok {
+		return fmt.Errorf("state root hook set, but the state writer %T can't compute state roots", stateWriter)
+	}
+	root, err := rootWriter.StateRoot()
+	if err != nil {
+		return fmt.Errorf("computing state root of block %d: %w", block, err)
+	}
+	if err := hook(root); err != nil {
+		return &ErrStateRootRejected{Block: block, Computed: root, Err: err}
+	}
+	return nil
+}
+
+// FinalizeBlockExecutionDryRun runs the engine's Finalize (or FinalizeAndAssemble when
+// isMining is set) without committing the block or writing change sets. The resulting
+// state stays in ibs for inspection, which is useful for block-building previews.
+func FinalizeBlockExecutionDryRun(
+	engine consensus.Engine,
+	header *types.Header, txs types.Transactions, uncles []*types.Header,
+	cc *chain.Config,
+	ibs *state.IntraBlockState, receipts types.Receipts,
+	withdrawals []*types.Withdrawal, chainReader consensus.ChainReader,
+	isMining bool,
+	logger log.Logger,
 ) (newBlock *types.Block, newTxs types.Transactions, newReceipt types.Receipts, retRequests types.FlatRequests, err error) {
 	syscall := func(contract libcommon.Address, data []byte) ([]byte, error) {
 		return SysCallContract(contract, data, cc, ibs, header, engine, false /* constCall */)
@@ -353,14 +920,6 @@ func FinalizeBlockExecution(
 	if err != nil {
 		return nil, nil, nil, nil, err
 	}
-
-	if err := ibs.CommitBlock(cc.Rules(header.Number.Uint64(), header.Time), stateWriter); err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("committing block %d failed: %w", header.Number.Uint64(), err)
-	}
-
-	if err := stateWriter.WriteChangeSets(); err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("writing changesets for block %d failed: %w", header.Number.Uint64(), err)
-	}
 	return newBlock, newTxs, newReceipt, retRequests, nil
 }
 
@@ -0,0 +1,1372 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon-lib/chain"
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/common/fixedgas"
+	"github.com/erigontech/erigon-lib/common/hexutility"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+	"github.com/erigontech/erigon-lib/log/v3"
+	types2 "github.com/erigontech/erigon-lib/types"
+
+	"github.com/erigontech/erigon/consensus"
+	"github.com/erigontech/erigon/consensus/ethash"
+	"github.com/erigontech/erigon/core/state"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/types/accounts"
+	"github.com/erigontech/erigon/core/vm"
+	"github.com/erigontech/erigon/params"
+	"github.com/erigontech/erigon/polygon/bor/borcfg"
+)
+
+// execTestEnv executes hand-built blocks against an in-memory plain state
+// holding a single funded sender account
+type execTestEnv struct {
+	t      testing.TB
+	config *chain.Config
+	engine consensus.Engine
+	tx     kv.RwTx
+	key    *ecdsa.PrivateKey
+	sender libcommon.Address
+	signer *types.Signer
+	logger log.Logger
+}
+
+func newExecTestEnv(t testing.TB, config *chain.Config) *execTestEnv {
+	t.Helper()
+	_, tx := memdb.NewTestTx(t)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	env := &execTestEnv{
+		t:      t,
+		config: config,
+		engine: ethash.NewFaker(),
+		tx:     tx,
+		key:    key,
+		sender: crypto.PubkeyToAddress(key.PublicKey),
+		signer: types.LatestSignerForChainID(config.ChainID),
+		logger: log.New(),
+	}
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(1e18)
+	env.setAccount(env.sender, &acc, nil)
+	return env
+}
+
+// setAccount writes an account, and its code if any, into the plain state
+func (e *execTestEnv) setAccount(address libcommon.Address, acc *accounts.Account, code []byte) {
+	e.t.Helper()
+	w := state.NewPlainStateWriterNoHistory(e.tx)
+	if len(code) > 0 {
+		acc.CodeHash = crypto.Keccak256Hash(code)
+		if acc.Incarnation == 0 {
+			acc.Incarnation = state.FirstContractIncarnation
+		}
+		require.NoError(e.t, w.UpdateAccountCode(address, acc.Incarnation, acc.CodeHash, code))
+	}
+	require.NoError(e.t, w.UpdateAccountData(address, &accounts.Account{}, acc))
+}
+
+func (e *execTestEnv) header(number uint64) *types.Header {
+	header := &types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		GasLimit:   30_000_000,
+		Difficulty: big.NewInt(1),
+		Time:       number,
+		Coinbase:   libcommon.HexToAddress("0xc0"),
+	}
+	if e.config.IsLondon(number) {
+		header.BaseFee = big.NewInt(1)
+	}
+	if e.config.IsCancun(header.Time) {
+		header.ExcessBlobGas = new(uint64)
+		header.BlobGasUsed = new(uint64)
+	}
+	return header
+}
+
+func (e *execTestEnv) sign(tx types.Transaction) types.Transaction {
+	return types.MustSignNewTx(e.key, *e.signer, tx)
+}
+
+// transfer returns a signed legacy value transfer from the funded sender
+func (e *execTestEnv) transfer(nonce uint64, to libcommon.Address) types.Transaction {
+	return e.sign(types.NewTransaction(nonce, to, uint256.NewInt(1), 21_000, uint256.NewInt(10), nil))
+}
+
+// call returns a signed legacy call from the funded sender
+func (e *execTestEnv) call(nonce uint64, to libcommon.Address, gas uint64, data []byte) types.Transaction {
+	return e.sign(types.NewTransaction(nonce, to, uint256.NewInt(0), gas, uint256.NewInt(10), data))
+}
+
+// blobTx returns a signed blob transaction carrying the given number of blobs
+func (e *execTestEnv) blobTx(nonce uint64, to libcommon.Address, blobs int) types.Transaction {
+	hashes := make([]libcommon.Hash, blobs)
+	for i := range hashes {
+		hashes[i][0] = 0x01
+		hashes[i][31] = byte(i)
+	}
+	tx := &types.BlobTx{
+		DynamicFeeTransaction: types.DynamicFeeTransaction{
+			CommonTx: types.CommonTx{Nonce: nonce, Gas: 21_000, To: &to, Value: uint256.NewInt(1)},
+			ChainID:  uint256.MustFromBig(e.config.ChainID),
+			Tip:      uint256.NewInt(1),
+			FeeCap:   uint256.NewInt(10),
+		},
+		MaxFeePerBlobGas:    uint256.NewInt(10),
+		BlobVersionedHashes: hashes,
+	}
+	// BlobTx inherits WithSignature from DynamicFeeTransaction, which would drop
+	// the blob fields, so the signature values are set in place
+	h := tx.SigningHash(e.config.ChainID)
+	sig, err := crypto.Sign(h[:], e.key)
+	require.NoError(e.t, err)
+	r, s, v, err := e.signer.SignatureValues(tx, sig)
+	require.NoError(e.t, err)
+	tx.R, tx.S, tx.V = *r, *s, *v
+	return tx
+}
+
+func (e *execTestEnv) execute(block *types.Block, vmConfig *vm.Config) (*EphemeralExecResult, error) {
+	return e.executeWithBuffers(block, vmConfig, nil)
+}
+
+func (e *execTestEnv) executeWithBuffers(block *types.Block, vmConfig *vm.Config, buffers *ExecutionBuffers) (*EphemeralExecResult, error) {
+	return e.executeWithState(block, vmConfig, buffers, nil)
+}
+
+func (e *execTestEnv) executeWithState(block *types.Block, vmConfig *vm.Config, buffers *ExecutionBuffers, ibs *state.IntraBlockState) (*EphemeralExecResult, error) {
+	return ExecuteBlockEphemerally(e.config, vmConfig, func(n uint64) libcommon.Hash { return libcommon.Hash{} },
+		e.engine, block, state.NewPlainStateReader(e.tx), state.NewNoopWriter(), nil, nil, buffers, ibs, e.logger)
+}
+
+// seal builds a block whose gas used, blob gas used, receipt root and bloom match
+// executing txs on top of the current state
+func (e *execTestEnv) seal(header *types.Header, txs types.Transactions, withdrawals []*types.Withdrawal) *types.Block {
+	e.t.Helper()
+	header = types.CopyHeader(header)
+	if header.BlobGasUsed != nil {
+		var blobGas uint64
+		for _, tx := range txs {
+			blobGas += tx.GetBlobGas()
+		}
+		header.BlobGasUsed = &blobGas
+	}
+	res, err := e.execute(types.NewBlock(header, txs, nil, nil, withdrawals), &vm.Config{StatelessExec: true, ReadOnly: true})
+	require.NoError(e.t, err)
+	require.Empty(e.t, res.Rejected)
+	header.GasUsed = uint64(res.GasUsed)
+	return types.NewBlock(header, txs, nil, res.Receipts, withdrawals)
+}
+
+// recordingStateWriter counts change-set writes and the accounts written,
+// discarding everything else. WriteChangeSets fails with changeSetErr if set.
+type recordingStateWriter struct {
+	*state.NoopWriter
+	changeSetWrites int
+	accountWrites   int
+	changeSetErr    error
+}
+
+func (w *recordingStateWriter) UpdateAccountData(address libcommon.Address, original, account *accounts.Account) error {
+	w.accountWrites++
+	return nil
+}
+
+func (w *recordingStateWriter) WriteChangeSets() error {
+	w.changeSetWrites++
+	return w.changeSetErr
+}
+
+func TestFirstDivergentReceipt(t *testing.T) {
+	header := &types.Header{Number: big.NewInt(1), GasUsed: 63_000}
+	receipts := types.Receipts{
+		{Status: types.ReceiptStatusSuccessful, GasUsed: 21_000, CumulativeGasUsed: 21_000},
+		{Status: types.ReceiptStatusSuccessful, GasUsed: 21_000, CumulativeGasUsed: 42_000},
+		{Status: types.ReceiptStatusFailed, GasUsed: 21_000, CumulativeGasUsed: 63_000},
+	}
+
+	i, reason := firstDivergentReceipt(receipts, header)
+	require.Equal(t, -1, i, reason)
+
+	receipts[1].CumulativeGasUsed = 43_000
+	i, reason = firstDivergentReceipt(receipts, header)
+	require.Equal(t, 1, i)
+	require.Contains(t, reason, "cumulative gas 43000, derived 42000")
+}
+
+func TestFinalizeBlockExecutionDryRun(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	logger := log.New()
+	engine := ethash.NewFaker()
+	coinbase := libcommon.HexToAddress("0xc0")
+	header := &types.Header{Number: big.NewInt(1), Coinbase: coinbase, Difficulty: big.NewInt(1), GasUsed: 21_000}
+	receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, GasUsed: 21_000, CumulativeGasUsed: 21_000}}
+	w := &recordingStateWriter{NoopWriter: state.NewNoopWriter()}
+
+	ibs := state.New(state.NewPlainStateReader(tx))
+	_, _, newReceipts, _, err := FinalizeBlockExecutionDryRun(engine, header, nil, nil, params.TestChainConfig, ibs, receipts, nil, nil, false, logger)
+	require.NoError(t, err)
+	require.Equal(t, receipts, newReceipts)
+	require.Zero(t, w.changeSetWrites)
+	// block reward is applied in memory only
+	require.False(t, ibs.GetBalance(coinbase).IsZero())
+
+	ibs = state.New(state.NewPlainStateReader(tx))
+	_, _, _, _, _, _, err = FinalizeBlockExecution(engine, nil, header, nil, nil, w, params.TestChainConfig, ibs, receipts, nil, nil, false, logger)
+	require.NoError(t, err)
+	require.Equal(t, 1, w.changeSetWrites)
+}
+
+func TestFinalizeBlockExecutionPartialWrite(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	coinbase := libcommon.HexToAddress("0xc0")
+	header := &types.Header{Number: big.NewInt(1), Coinbase: coinbase, Difficulty: big.NewInt(1)}
+	errDisk := errors.New("disk full")
+	w := &recordingStateWriter{NoopWriter: state.NewNoopWriter(), changeSetErr: errDisk}
+
+	ibs := state.New(state.NewPlainStateReader(tx))
+	_, _, _, _, _, _, err := FinalizeBlockExecution(ethash.NewFaker(), nil, header, nil, nil, w, params.TestChainConfig, ibs, nil, nil, nil, false, log.New())
+	require.ErrorIs(t, err, errDisk)
+	var partial *ErrPartialFinalize
+	require.True(t, errors.As(err, &partial), "got %v", err)
+	require.Equal(t, uint64(1), partial.Block)
+	// the block reward was committed before the change sets failed
+	require.NotZero(t, w.accountWrites)
+	require.Equal(t, 1, w.changeSetWrites)
+
+	// engine failures happen before anything is written
+	w = &recordingStateWriter{NoopWriter: state.NewNoopWriter()}
+	engine := &requestsEngine{Engine: ethash.NewFaker(), err: errDisk}
+	_, _, _, _, _, _, err = FinalizeBlockExecution(engine, nil, header, nil, nil, w, params.TestChainConfig, state.New(state.NewPlainStateReader(tx)), nil, nil, nil, false, log.New())
+	require.ErrorIs(t, err, errDisk)
+	require.False(t, errors.As(err, &partial))
+	require.Zero(t, w.accountWrites)
+	require.Zero(t, w.changeSetWrites)
+}
+
+// requestsEngine returns fixed execution requests from Finalize, or fails
+// with err if set
+type requestsEngine struct {
+	consensus.Engine
+	requests types.FlatRequests
+	err      error
+}
+
+func (e *requestsEngine) Finalize(config *chain.Config, header *types.Header, ibs *state.IntraBlockState,
+	txs types.Transactions, uncles []*types.Header, receipts types.Receipts, withdrawals []*types.Withdrawal,
+	chain consensus.ChainReader, syscall consensus.SystemCall, logger log.Logger,
+) (types.Transactions, types.Receipts, types.FlatRequests, error) {
+	if e.err != nil {
+		return nil, nil, nil, e.err
+	}
+	txs, receipts, _, err := e.Engine.Finalize(config, header, ibs, txs, uncles, receipts, withdrawals, chain, syscall, logger)
+	return txs, receipts, e.requests, err
+}
+
+func TestFinalizeBlockExecutionRoots(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	prague := *params.AllProtocolChanges
+	prague.PragueTime = big.NewInt(0)
+	engine := &requestsEngine{
+		Engine:   ethash.NewFaker(),
+		requests: types.FlatRequests{{Type: types.DepositRequestType, RequestData: []byte{0x01}}},
+	}
+	withdrawals := []*types.Withdrawal{
+		{Index: 0, Validator: 1, Address: libcommon.HexToAddress("0x0a"), Amount: 100},
+		{Index: 1, Validator: 2, Address: libcommon.HexToAddress("0x0b"), Amount: 200},
+	}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}
+	finalize := func(config *chain.Config, withdrawals []*types.Withdrawal) (*libcommon.Hash, *libcommon.Hash) {
+		t.Helper()
+		ibs := state.New(state.NewPlainStateReader(tx))
+		w := &recordingStateWriter{NoopWriter: state.NewNoopWriter()}
+		_, _, _, _, withdrawalsRoot, requestsRoot, err := FinalizeBlockExecution(engine, nil, header, nil, nil, w, config, ibs, nil, withdrawals, nil, false, log.New())
+		require.NoError(t, err)
+		return withdrawalsRoot, requestsRoot
+	}
+
+	withdrawalsRoot, requestsRoot := finalize(&prague, withdrawals)
+	require.NotNil(t, withdrawalsRoot)
+	require.Equal(t, types.DeriveSha(types.Withdrawals(withdrawals)), *withdrawalsRoot)
+	require.Equal(t, engine.requests.Hash(), requestsRoot)
+
+	// an empty withdrawals list still has a root after Shanghai
+	withdrawalsRoot, _ = finalize(&prague, nil)
+	require.Equal(t, types.EmptyRootHash, *withdrawalsRoot)
+
+	// neither root exists before the forks introducing them
+	withdrawalsRoot, requestsRoot = finalize(params.TestChainConfig, nil)
+	require.Nil(t, withdrawalsRoot)
+	require.Nil(t, requestsRoot)
+	withdrawalsRoot, requestsRoot = finalize(params.AllProtocolChanges, withdrawals)
+	require.NotNil(t, withdrawalsRoot)
+	require.Nil(t, requestsRoot)
+}
+
+func TestExecuteBlockEphemerallyRequestsHash(t *testing.T) {
+	prague := *params.AllProtocolChanges
+	prague.PragueTime = big.NewInt(0)
+	env := newExecTestEnv(t, &prague)
+	engine := &requestsEngine{
+		Engine:   ethash.NewFaker(),
+		requests: types.FlatRequests{{Type: types.DepositRequestType, RequestData: []byte{0x01}}},
+	}
+	env.engine = engine
+	expected := ExpectedRequestsHash(&prague, env.header(1), engine.requests)
+	require.Equal(t, engine.requests.Hash(), expected)
+
+	header := env.header(1)
+	header.RequestsHash = expected
+	block := env.seal(header, types.Transactions{env.transfer(0, libcommon.HexToAddress("0x02"))}, nil)
+	_, err := env.execute(block, &vm.Config{})
+	require.NoError(t, err)
+
+	// no requests commit to the hash of an empty list, no hash before Prague
+	require.Equal(t, types.EmptyRequestsHash, *ExpectedRequestsHash(&prague, header, nil))
+	require.Nil(t, ExpectedRequestsHash(params.AllProtocolChanges, header, engine.requests))
+}
+
+func TestExecuteBlockEphemerallyMaxBlobGasOverride(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	oneBlob := func(time uint64) uint64 { return fixedgas.BlobGasPerBlob }
+
+	block := env.seal(env.header(1), types.Transactions{env.blobTx(0, to, 1)}, nil)
+	_, err := env.execute(block, &vm.Config{ReadOnly: true, MaxBlobGasPerBlockOverride: oneBlob})
+	require.NoError(t, err)
+
+	block = env.seal(env.header(1), types.Transactions{env.blobTx(0, to, 2)}, nil)
+	_, err = env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	_, err = env.execute(block, &vm.Config{ReadOnly: true, MaxBlobGasPerBlockOverride: oneBlob})
+	require.ErrorIs(t, err, ErrBlobGasLimitReached)
+}
+
+type countingTracerFactory struct {
+	tracers   int
+	blockEnds int
+}
+
+func (f *countingTracerFactory) NewTracer(txIndex int, txHash libcommon.Hash) (vm.EVMLogger, error) {
+	f.tracers++
+	return vm.NewMultiTracer(), nil
+}
+
+func (f *countingTracerFactory) OnBlockEnd() { f.blockEnds++ }
+
+func TestExecuteBlockEphemerallyTracerFactory(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+
+	factory := &countingTracerFactory{}
+	_, err := ExecuteBlockEphemerally(env.config, &vm.Config{Debug: true, ReadOnly: true}, func(n uint64) libcommon.Hash { return libcommon.Hash{} },
+		env.engine, block, state.NewPlainStateReader(env.tx), state.NewNoopWriter(), nil, factory, nil, nil, env.logger)
+	require.NoError(t, err)
+	require.Equal(t, 2, factory.tracers)
+	require.Equal(t, 1, factory.blockEnds)
+}
+
+// opcodeTracer records the opcodes executed and counts its flushes. The
+// empty MultiTracer it embeds provides no-op hooks.
+type opcodeTracer struct {
+	vm.MultiTracer
+	ops     []vm.OpCode
+	flushed int
+}
+
+func (t *opcodeTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.ops = append(t.ops, op)
+}
+
+func (t *opcodeTracer) Flush(tx types.Transaction) { t.flushed++ }
+
+func TestExecuteBlockEphemerallyMultiTracer(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	contract := libcommon.HexToAddress("0x10")
+	acc := accounts.NewAccount()
+	// PUSH1 42 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	env.setAccount(contract, &acc, hexutility.MustDecodeHex("0x602a60005260206000f3"))
+	block := env.seal(env.header(1), types.Transactions{env.call(0, contract, 100_000, nil), env.call(1, contract, 100_000, nil)}, nil)
+
+	first, second := &opcodeTracer{}, &opcodeTracer{}
+	factory := MultiTracerFactoryFunc(func(txIndex int, txHash libcommon.Hash) ([]vm.EVMLogger, error) {
+		return []vm.EVMLogger{first, nil, second}, nil
+	})
+	_, err := ExecuteBlockEphemerally(env.config, &vm.Config{Debug: true, ReadOnly: true}, func(n uint64) libcommon.Hash { return libcommon.Hash{} },
+		env.engine, block, state.NewPlainStateReader(env.tx), state.NewNoopWriter(), nil, factory, nil, nil, env.logger)
+	require.NoError(t, err)
+
+	ops := []vm.OpCode{vm.PUSH1, vm.PUSH1, vm.MSTORE, vm.PUSH1, vm.PUSH1, vm.RETURN}
+	require.Equal(t, append(ops, ops...), first.ops)
+	require.Equal(t, first.ops, second.ops)
+	require.Equal(t, 2, first.flushed)
+	require.Equal(t, 2, second.flushed)
+}
+
+func TestExecuteBlockEphemerallyReusedBuffers(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	one := env.seal(env.header(1), types.Transactions{env.transfer(0, to)}, nil)
+	two := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+
+	buffers := NewExecutionBuffers()
+	for _, block := range []*types.Block{two, one, two} {
+		expected, err := env.execute(block, &vm.Config{ReadOnly: true})
+		require.NoError(t, err)
+		res, err := env.executeWithBuffers(block, &vm.Config{ReadOnly: true}, buffers)
+		require.NoError(t, err)
+		require.Equal(t, expected.ReceiptRoot, res.ReceiptRoot)
+		require.Equal(t, expected.GasUsed, res.GasUsed)
+		require.Len(t, res.Receipts, block.Transactions().Len())
+	}
+}
+
+func BenchmarkExecuteBlockEphemerallyBuffers(b *testing.B) {
+	const blocks = 10_000
+	env := newExecTestEnv(b, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+
+	for _, bc := range []struct {
+		name    string
+		buffers func() *ExecutionBuffers
+	}{
+		{"fresh", func() *ExecutionBuffers { return nil }},
+		{"reused", NewExecutionBuffers},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buffers := bc.buffers()
+				for j := 0; j < blocks; j++ {
+					if _, err := env.executeWithBuffers(block, &vm.Config{ReadOnly: true}, buffers); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteBlockEphemerallyReusedIntraBlockState(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0xbeef") // not a precompile, so the transfers succeed
+	one := env.seal(env.header(1), types.Transactions{env.transfer(0, to)}, nil)
+	two := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+
+	ibs := state.New(state.NewPlainStateReader(env.tx))
+	for _, block := range []*types.Block{two, one, two} {
+		expected, err := env.execute(block, &vm.Config{ReadOnly: true})
+		require.NoError(t, err)
+		res, err := env.executeWithState(block, &vm.Config{ReadOnly: true}, nil, ibs)
+		require.NoError(t, err)
+		require.True(t, expected.Equal(res), expected.Diff(res))
+	}
+
+	// the reused state only holds the last block's changes
+	stop := 0
+	res, err := env.executeWithState(two, &vm.Config{StopAfterTxIndex: &stop}, nil, ibs)
+	require.NoError(t, err)
+	require.Same(t, ibs, res.PartialState)
+	require.Equal(t, uint256.NewInt(1), ibs.GetBalance(to))
+}
+
+func BenchmarkExecuteBlockEphemerallyIntraBlockState(b *testing.B) {
+	const blocks = 10_000
+	env := newExecTestEnv(b, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+
+	for _, bc := range []struct {
+		name string
+		ibs  func() *state.IntraBlockState
+	}{
+		{"fresh", func() *state.IntraBlockState { return nil }},
+		{"reused", func() *state.IntraBlockState { return state.New(state.NewPlainStateReader(env.tx)) }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ibs := bc.ibs()
+				for j := 0; j < blocks; j++ {
+					if _, err := env.executeWithState(block, &vm.Config{ReadOnly: true}, nil, ibs); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEphemeralExecResultDiff(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to)}, nil)
+
+	a, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	b, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.True(t, a.Equal(b))
+	require.Empty(t, a.Diff(b))
+
+	for _, tc := range []struct {
+		field   string
+		perturb func(r *EphemeralExecResult)
+	}{
+		{"stateRoot", func(r *EphemeralExecResult) { r.StateRoot[0] ^= 1 }},
+		{"txRoot", func(r *EphemeralExecResult) { r.TxRoot[0] ^= 1 }},
+		{"receiptsRoot", func(r *EphemeralExecResult) { r.ReceiptRoot[0] ^= 1 }},
+		{"logsBloom", func(r *EphemeralExecResult) { r.Bloom[0] ^= 1 }},
+		{"gasUsed", func(r *EphemeralExecResult) { r.GasUsed++ }},
+		{"rejected", func(r *EphemeralExecResult) { r.Rejected = append(r.Rejected, &RejectedTx{0, "nonce too low"}) }},
+	} {
+		perturbed := *b
+		tc.perturb(&perturbed)
+		require.False(t, a.Equal(&perturbed), tc.field)
+		require.True(t, strings.HasPrefix(a.Diff(&perturbed), tc.field+":"), a.Diff(&perturbed))
+	}
+
+	// only the first differing field is reported
+	perturbed := *b
+	perturbed.TxRoot[0] ^= 1
+	perturbed.GasUsed++
+	require.Contains(t, a.Diff(&perturbed), "txRoot")
+}
+
+func TestSysCallContractGasLimit(t *testing.T) {
+	env := newExecTestEnv(t, params.TestChainConfig)
+	// GAS PUSH1 0 MSTORE; PUSH1 1 PUSH1 0 SSTORE; PUSH1 32 PUSH1 0 RETURN
+	code := []byte{0x5a, 0x60, 0x00, 0x52, 0x60, 0x01, 0x60, 0x00, 0x55, 0x60, 0x20, 0x60, 0x00, 0xf3}
+	var slot libcommon.Hash
+
+	for contract, typ := range map[libcommon.Address]SysCallType{
+		libcommon.HexToAddress("0x1234"):   SysCallGeneric,
+		params.BeaconRootsAddress:          SysCallBeaconRoots,
+		params.HistoryStorageAddress:       SysCallBlockHashHistory,
+		params.WithdrawalRequestAddress:    SysCallWithdrawalRequests,
+		params.ConsolidationRequestAddress: SysCallConsolidationRequests,
+	} {
+		t.Run(typ.String(), func(t *testing.T) {
+			require.Equal(t, typ, SysCallTypeOf(contract))
+			ibs := state.New(state.NewPlainStateReader(env.tx))
+			ibs.SetCode(contract, code)
+
+			for _, constCall := range []bool{true, false} {
+				ret, err := SysCallContract(contract, nil, env.config, ibs, env.header(1), env.engine, constCall)
+				require.NoError(t, err)
+				// GAS itself costs 2
+				require.Equal(t, typ.GasLimit()-2, new(uint256.Int).SetBytes(ret).Uint64())
+
+				var value uint256.Int
+				ibs.GetState(contract, &slot, &value)
+				require.Equal(t, !constCall, value.Eq(uint256.NewInt(1)), "constCall=%v", constCall)
+			}
+		})
+	}
+}
+
+func TestSysCreateGasLimit(t *testing.T) {
+	env := newExecTestEnv(t, params.TestChainConfig)
+	// a loop of 1,200,000 iterations of 26 gas, then RETURN(0x2a)
+	constructor := []byte{
+		byte(vm.PUSH3), 0x12, 0x4f, 0x80,
+		byte(vm.JUMPDEST), byte(vm.PUSH1), 0x01, byte(vm.SWAP1), byte(vm.SUB), byte(vm.DUP1), byte(vm.PUSH1), 0x04, byte(vm.JUMPI),
+		byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0x00, byte(vm.MSTORE8), byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	}
+	contract := libcommon.HexToAddress("0x1234")
+	header := env.header(0)
+
+	ibs := state.New(state.NewPlainStateReader(env.tx))
+	_, err := SysCreate(contract, constructor, *env.config, ibs, header)
+	require.ErrorIs(t, err, vm.ErrOutOfGas)
+	require.Empty(t, ibs.GetCode(contract))
+
+	ibs = state.New(state.NewPlainStateReader(env.tx))
+	_, err = SysCreateWithGasLimit(contract, constructor, 40_000_000, *env.config, ibs, header)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x2a}, ibs.GetCode(contract))
+
+	_, err = SysCreateWithGasLimit(contract, constructor, 0, *env.config, ibs, header)
+	require.Error(t, err)
+}
+
+// sysCallAuthorEngine runs system calls with a fixed author
+type sysCallAuthorEngine struct {
+	consensus.Engine
+	author libcommon.Address
+}
+
+func (e *sysCallAuthorEngine) SysCallAuthor(*types.Header) libcommon.Address {
+	return e.author
+}
+
+func TestSysCallContractAuthor(t *testing.T) {
+	env := newExecTestEnv(t, params.TestChainConfig)
+	contract := libcommon.HexToAddress("0x1234")
+	ibs := state.New(state.NewPlainStateReader(env.tx))
+	// COINBASE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	ibs.SetCode(contract, hexutility.MustDecodeHex("0x4160005260206000f3"))
+	header := env.header(1)
+	header.Coinbase = libcommon.HexToAddress("0xc0")
+
+	ret, err := SysCallContract(contract, nil, env.config, ibs, header, env.engine, true)
+	require.NoError(t, err)
+	require.Equal(t, state.SystemAddress, libcommon.BytesToAddress(ret))
+
+	author := libcommon.HexToAddress("0xa0")
+	engine := &sysCallAuthorEngine{Engine: env.engine, author: author}
+	ret, err = SysCallContract(contract, nil, env.config, ibs, header, engine, true)
+	require.NoError(t, err)
+	require.Equal(t, author, libcommon.BytesToAddress(ret))
+}
+
+func TestConstCall(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	view := libcommon.HexToAddress("0x10")   // returns 42
+	writer := libcommon.HexToAddress("0x11") // stores 1 in slot 0, then returns 42
+	caller := libcommon.HexToAddress("0x12") // returns CALLER
+	returns42 := hexutility.MustDecodeHex("0x602a60005260206000f3")
+	acc := accounts.NewAccount()
+	env.setAccount(view, &acc, returns42)
+	env.setAccount(writer, &acc, append(hexutility.MustDecodeHex("0x6001600055"), returns42...))
+	env.setAccount(caller, &acc, hexutility.MustDecodeHex("0x3360005260206000f3"))
+
+	ibs := state.New(state.NewPlainStateReader(env.tx))
+	header := env.header(1)
+	call := func(from, to libcommon.Address) ([]byte, uint64) {
+		t.Helper()
+		out, gasUsed, err := ConstCall(from, to, nil, 100_000, nil, env.config, ibs, header, env.engine)
+		require.NoError(t, err)
+		return out, gasUsed
+	}
+
+	out, gasUsed := call(env.sender, view)
+	require.Equal(t, uint256.NewInt(42).PaddedBytes(32), out)
+	require.Equal(t, uint64(18), gasUsed)
+
+	// state changes are reverted
+	out, gasUsed = call(env.sender, writer)
+	require.Equal(t, uint256.NewInt(42).PaddedBytes(32), out)
+	require.Greater(t, gasUsed, params.SstoreSetGasEIP2200)
+	var slot uint256.Int
+	ibs.GetState(writer, &libcommon.Hash{}, &slot)
+	require.True(t, slot.IsZero())
+
+	// any sender can be used
+	from := libcommon.HexToAddress("0xabcd")
+	out, _ = call(from, caller)
+	require.Equal(t, from, libcommon.BytesToAddress(out))
+
+	_, _, err := ConstCall(env.sender, view, nil, 10, nil, env.config, ibs, header, env.engine)
+	require.ErrorIs(t, err, vm.ErrOutOfGas)
+}
+
+func TestExecuteBlockEphemerallyStopAfterTxIndex(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0xbeef") // not a precompile, so the transfers succeed
+	var txs types.Transactions
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		txs = append(txs, env.transfer(nonce, to))
+	}
+	block := env.seal(env.header(1), txs, nil)
+
+	stop := 2
+	res, err := env.execute(block, &vm.Config{StopAfterTxIndex: &stop})
+	require.NoError(t, err)
+	require.Len(t, res.Receipts, 3)
+	require.Equal(t, uint64(3*21_000), uint64(res.GasUsed))
+	require.Equal(t, types.DeriveSha(txs[:3]), res.TxRoot)
+	require.NotNil(t, res.PartialState)
+	require.Equal(t, uint64(3), res.PartialState.GetNonce(env.sender))
+	require.Equal(t, uint256.NewInt(3), res.PartialState.GetBalance(to))
+
+	full, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.Len(t, full.Receipts, 5)
+	require.Nil(t, full.PartialState)
+}
+
+func TestExecuteBlockEphemerallyErrors(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to)}, nil)
+
+	tamper := func(modify func(h *types.Header)) *types.Block {
+		h := types.CopyHeader(block.Header())
+		modify(h)
+		return block.WithSeal(h)
+	}
+
+	_, err := env.execute(tamper(func(h *types.Header) { h.ReceiptHash = libcommon.HexToHash("0x01") }), &vm.Config{ReadOnly: true})
+	var receiptErr *ErrReceiptRootMismatch
+	require.True(t, errors.As(err, &receiptErr), "got %v", err)
+	require.Equal(t, block.ReceiptHash(), receiptErr.Computed)
+	require.Equal(t, libcommon.HexToHash("0x01"), receiptErr.Expected)
+
+	_, err = env.execute(tamper(func(h *types.Header) { h.GasUsed++ }), &vm.Config{ReadOnly: true})
+	var gasErr *ErrGasUsedMismatch
+	require.True(t, errors.As(err, &gasErr), "got %v", err)
+	require.Equal(t, ErrGasUsedMismatch{Computed: 21_000, Expected: 21_001}, *gasErr)
+	require.EqualError(t, err, "gas used by execution: 21000, in header: 21001")
+
+	_, err = env.execute(tamper(func(h *types.Header) { *h.BlobGasUsed = 1 }), &vm.Config{ReadOnly: true})
+	var blobGasErr *ErrBlobGasMismatch
+	require.True(t, errors.As(err, &blobGasErr), "got %v", err)
+	require.Equal(t, ErrBlobGasMismatch{Computed: 0, Expected: 1}, *blobGasErr)
+
+	_, err = env.execute(tamper(func(h *types.Header) { h.Bloom[0] = 0xff }), &vm.Config{ReadOnly: true})
+	var bloomErr *ErrBloomMismatch
+	require.True(t, errors.As(err, &bloomErr), "got %v", err)
+	require.Equal(t, block.Bloom(), bloomErr.Computed)
+
+	badNonce := env.transfer(5, to)
+	_, err = env.execute(types.NewBlock(env.header(1), types.Transactions{badNonce}, nil, nil, nil), &vm.Config{ReadOnly: true})
+	var txErr *ErrTxApply
+	require.True(t, errors.As(err, &txErr), "got %v", err)
+	require.Equal(t, 0, txErr.TxIndex)
+	require.Equal(t, badNonce.Hash(), txErr.TxHash)
+	require.ErrorIs(t, err, ErrNonceTooHigh)
+}
+
+func TestExecuteBlockEphemerallyWithdrawalsRoot(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	withdrawals := []*types.Withdrawal{
+		{Index: 0, Validator: 1, Address: libcommon.HexToAddress("0x0a"), Amount: 100},
+		{Index: 1, Validator: 2, Address: libcommon.HexToAddress("0x0b"), Amount: 200},
+	}
+	block := env.seal(env.header(1), nil, withdrawals)
+	require.NotNil(t, block.WithdrawalsHash())
+	validate := &vm.Config{ReadOnly: true, ValidateWithdrawalsRoot: true}
+
+	_, err := env.execute(block, validate)
+	require.NoError(t, err)
+
+	tampered := types.NewBlock(block.Header(), nil, nil, nil, withdrawals[:1]).WithSeal(block.Header())
+	_, err = env.execute(tampered, validate)
+	var rootErr *ErrWithdrawalsRootMismatch
+	require.True(t, errors.As(err, &rootErr), "got %v", err)
+	require.Equal(t, *block.WithdrawalsHash(), rootErr.Expected)
+	require.Equal(t, types.DeriveSha(types.Withdrawals(withdrawals[:1])), rootErr.Computed)
+
+	// not checked in stateless execution or without the option
+	_, err = env.execute(tampered, &vm.Config{ReadOnly: true, StatelessExec: true, ValidateWithdrawalsRoot: true})
+	require.NoError(t, err)
+	_, err = env.execute(tampered, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+
+	// headers without a withdrawals root, from before Shanghai, take no withdrawals
+	preShanghai := env.seal(env.header(1), nil, nil)
+	require.Nil(t, preShanghai.WithdrawalsHash())
+	_, err = env.execute(preShanghai, validate)
+	require.NoError(t, err)
+	_, err = env.execute(block.WithSeal(preShanghai.Header()), validate)
+	require.ErrorIs(t, err, ErrUnexpectedWithdrawals)
+}
+
+// stateSyncEngine emits the given number of logs after the transactions when
+// a block is finalized, standing in for Bor state-sync events
+type stateSyncEngine struct {
+	consensus.Engine
+	events int
+}
+
+func (e *stateSyncEngine) Finalize(config *chain.Config, header *types.Header, ibs *state.IntraBlockState,
+	txs types.Transactions, uncles []*types.Header, receipts types.Receipts, withdrawals []*types.Withdrawal,
+	chain consensus.ChainReader, syscall consensus.SystemCall, logger log.Logger,
+) (types.Transactions, types.Receipts, types.FlatRequests, error) {
+	for i := 0; i < e.events; i++ {
+		ibs.AddLog(&types.Log{Address: libcommon.HexToAddress("0x1001"), Data: []byte{byte(i)}})
+	}
+	return e.Engine.Finalize(config, header, ibs, txs, uncles, receipts, withdrawals, chain, syscall, logger)
+}
+
+func TestExecuteBlockEphemerallyBorStateSync(t *testing.T) {
+	bor := *params.AllProtocolChanges
+	bor.Consensus = chain.BorConsensus
+	bor.Bor = &borcfg.BorConfig{}
+
+	for _, tc := range []struct {
+		name   string
+		events int
+	}{
+		{"with state sync", 2},
+		{"without state sync", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newExecTestEnv(t, &bor)
+			env.engine = &stateSyncEngine{Engine: env.engine, events: tc.events}
+			block := types.NewBlock(env.header(1), nil, nil, nil, nil)
+
+			res, err := env.execute(block, &vm.Config{})
+			require.NoError(t, err)
+			require.Equal(t, tc.events > 0, res.HasStateSync)
+			require.Len(t, res.StateSyncReceipt.Logs, tc.events)
+
+			res, err = env.execute(block, &vm.Config{RequireStateSync: true})
+			if tc.events == 0 {
+				require.ErrorIs(t, err, ErrMissingStateSync)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, types.ReceiptStatusSuccessful, res.StateSyncReceipt.Status)
+		})
+	}
+
+	// non-Bor chains are unaffected
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	res, err := env.execute(types.NewBlock(env.header(1), nil, nil, nil, nil), &vm.Config{ReadOnly: true, RequireStateSync: true})
+	require.NoError(t, err)
+	require.False(t, res.HasStateSync)
+	require.Nil(t, res.StateSyncReceipt)
+}
+
+func TestExecuteBlockEphemerallyBorStateSyncLogs(t *testing.T) {
+	bor := *params.AllProtocolChanges
+	bor.Consensus = chain.BorConsensus
+	bor.Bor = &borcfg.BorConfig{}
+	env := newExecTestEnv(t, &bor)
+	env.engine = &stateSyncEngine{Engine: env.engine, events: 3}
+	// PUSH1 0 PUSH1 0 LOG0
+	emitter := libcommon.HexToAddress("0xe0")
+	acc := accounts.NewAccount()
+	env.setAccount(emitter, &acc, []byte{0x60, 0x00, 0x60, 0x00, 0xa0})
+
+	for _, tc := range []struct {
+		name string
+		txs  types.Transactions
+		logs int // logs emitted by the transactions
+	}{
+		{"silent tx", types.Transactions{env.transfer(0, libcommon.HexToAddress("0x02"))}, 0},
+		{"silent tx after emitting tx", types.Transactions{
+			env.call(0, emitter, 100_000, nil),
+			env.transfer(1, libcommon.HexToAddress("0x02")),
+		}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			block := env.seal(env.header(1), tc.txs, nil)
+			res, err := env.execute(block, &vm.Config{})
+			require.NoError(t, err)
+			require.True(t, res.HasStateSync)
+			require.Equal(t, types.ReceiptStatusSuccessful, res.StateSyncReceipt.Status)
+			require.Equal(t, uint(len(tc.txs)), res.StateSyncReceipt.TransactionIndex)
+			require.Len(t, res.StateSyncReceipt.Logs, 3)
+			for i, l := range res.StateSyncReceipt.Logs {
+				require.Equal(t, []byte{byte(i)}, l.Data)
+				require.Equal(t, uint(len(tc.txs)), l.TxIndex)
+				require.Equal(t, uint(tc.logs+i), l.Index)
+			}
+			require.Empty(t, res.Receipts[len(res.Receipts)-1].Logs)
+		})
+	}
+}
+
+func TestExecuteBlockEphemerallyTxTypeTallies(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	dynamicFee := env.sign(&types.DynamicFeeTransaction{
+		CommonTx: types.CommonTx{Nonce: 3, Gas: 21_000, To: &to, Value: uint256.NewInt(1)},
+		ChainID:  uint256.MustFromBig(env.config.ChainID),
+		Tip:      uint256.NewInt(1),
+		FeeCap:   uint256.NewInt(10),
+	})
+	txs := types.Transactions{env.transfer(0, to), env.blobTx(1, to, 1), env.transfer(2, to), dynamicFee}
+	block := env.seal(env.header(1), txs, nil)
+
+	res, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, map[uint8]int{types.LegacyTxType: 2, types.BlobTxType: 1, types.DynamicFeeTxType: 1}, res.CountByTxType)
+	require.Equal(t, map[uint8]uint64{types.LegacyTxType: 42_000, types.BlobTxType: 21_000, types.DynamicFeeTxType: 21_000}, res.GasByTxType)
+
+	var total uint64
+	for _, gas := range res.GasByTxType {
+		total += gas
+	}
+	require.Equal(t, uint64(res.GasUsed), total)
+}
+
+func TestExecuteBlockEphemerallyExecEventSink(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.blobTx(1, to, 2)}, nil)
+
+	var events []vm.BlockExecEvent
+	sink := func(event vm.BlockExecEvent) { events = append(events, event) }
+	_, err := env.execute(block, &vm.Config{ReadOnly: true, ExecEventSink: sink})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	event := events[0]
+	require.Positive(t, event.Duration)
+	event.Duration = 0
+	require.Equal(t, vm.BlockExecEvent{
+		Number:      1,
+		Hash:        block.Hash(),
+		TxCount:     2,
+		GasUsed:     42_000,
+		BlobGasUsed: 2 * fixedgas.BlobGasPerBlob,
+	}, event)
+
+	// rejected transactions are counted apart in stateless execution
+	events = nil
+	// nonces are not checked in stateless execution, intrinsic gas is
+	lowGas := types.NewBlock(env.header(1), types.Transactions{env.transfer(0, to), env.call(1, to, 20_000, nil)}, nil, nil, nil)
+	_, err = env.execute(lowGas, &vm.Config{ReadOnly: true, StatelessExec: true, ExecEventSink: sink})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, 1, events[0].TxCount)
+	require.Equal(t, 1, events[0].Rejected)
+
+	// failed executions emit nothing
+	events = nil
+	h := types.CopyHeader(block.Header())
+	h.GasUsed++
+	_, err = env.execute(block.WithSeal(h), &vm.Config{ReadOnly: true, ExecEventSink: sink})
+	require.Error(t, err)
+	require.Empty(t, events)
+}
+
+// logEmitter returns code emitting n LOG1 records of 32 bytes each
+func logEmitter(n int) []byte {
+	code := make([]byte, 0, 7*n)
+	for i := 0; i < n; i++ {
+		// PUSH1 topic, PUSH1 32, PUSH1 0, LOG1
+		code = append(code, byte(vm.PUSH1), byte(i), byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.LOG1))
+	}
+	return code
+}
+
+func TestExecuteBlockEphemerallyTrustHeaderBloom(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	emitter := libcommon.HexToAddress("0x10")
+	acc := accounts.NewAccount()
+	env.setAccount(emitter, &acc, logEmitter(4))
+	block := env.seal(env.header(1), types.Transactions{env.call(0, emitter, 100_000, nil)}, nil)
+	require.NotEqual(t, types.Bloom{}, block.Bloom())
+
+	h := types.CopyHeader(block.Header())
+	h.Bloom[0] ^= 0xff
+	tampered := block.WithSeal(h)
+
+	// the header bloom is taken as is in stateless execution
+	res, err := env.execute(tampered, &vm.Config{ReadOnly: true, StatelessExec: true, TrustHeaderBloom: true})
+	require.NoError(t, err)
+	require.Equal(t, h.Bloom, res.Bloom)
+
+	// and still validated otherwise
+	_, err = env.execute(tampered, &vm.Config{ReadOnly: true, TrustHeaderBloom: true})
+	var bloomErr *ErrBloomMismatch
+	require.True(t, errors.As(err, &bloomErr), "got %v", err)
+}
+
+func BenchmarkExecuteBlockEphemerallyTrustHeaderBloom(b *testing.B) {
+	env := newExecTestEnv(b, params.AllProtocolChanges)
+	emitter := libcommon.HexToAddress("0x10")
+	acc := accounts.NewAccount()
+	env.setAccount(emitter, &acc, logEmitter(200))
+	txs := make(types.Transactions, 20)
+	for i := range txs {
+		txs[i] = env.call(uint64(i), emitter, 500_000, nil)
+	}
+	block := env.seal(env.header(1), txs, nil)
+
+	for _, bc := range []struct {
+		name  string
+		trust bool
+	}{
+		{"recompute", false},
+		{"trusted", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := env.execute(block, &vm.Config{ReadOnly: true, StatelessExec: true, TrustHeaderBloom: bc.trust}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLogReceiptsBounded(t *testing.T) {
+	defer func(max int) { maxLoggedReceiptsSize = max }(maxLoggedReceiptsSize)
+	maxLoggedReceiptsSize = 16 << 10
+
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	header := env.header(1)
+	const count = 500
+	txs := make(types.Transactions, count)
+	receipts := make(types.Receipts, count)
+	for i := range txs {
+		txs[i] = env.transfer(uint64(i), to)
+		receipts[i] = &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			GasUsed:           21_000,
+			CumulativeGasUsed: uint64(i+1) * 21_000,
+			TxHash:            txs[i].Hash(),
+			BlockNumber:       header.Number,
+			TransactionIndex:  uint(i),
+		}
+	}
+
+	var records []*log.Record
+	logger := log.New()
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	logReceipts(receipts, txs, env.config, header, logger)
+
+	require.Len(t, records, 1)
+	ctx := map[string]interface{}{}
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		ctx[records[0].Ctx[i].(string)] = records[0].Ctx[i+1]
+	}
+	result := ctx["result"].(string)
+	require.LessOrEqual(t, len(result), maxLoggedReceiptsSize)
+
+	var logged []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(result), &logged))
+	require.NotEmpty(t, logged)
+	require.Positive(t, ctx["omitted"].(int))
+	require.Equal(t, count, len(logged)+ctx["omitted"].(int))
+}
+
+func TestExecuteBlockEphemerallyPreValidation(t *testing.T) {
+	prague := *params.AllProtocolChanges
+	prague.PragueTime = big.NewInt(0)
+	to := libcommon.HexToAddress("0x02")
+	setCode := func(env *execTestEnv) types.Transaction {
+		return env.sign(&types.SetCodeTransaction{
+			DynamicFeeTransaction: types.DynamicFeeTransaction{
+				CommonTx: types.CommonTx{Nonce: 1, Gas: 100_000, To: &to, Value: uint256.NewInt(0)},
+				ChainID:  uint256.MustFromBig(env.config.ChainID),
+				Tip:      uint256.NewInt(1),
+				FeeCap:   uint256.NewInt(10),
+			},
+		})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		config *chain.Config
+		err    error
+	}{
+		{"empty authorization list", &prague, ErrSetCodeTxWithoutAuthorizations},
+		{"before prague", params.AllProtocolChanges, ErrTxTypeNotSupported},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newExecTestEnv(t, tc.config)
+			bad := setCode(env)
+			block := types.NewBlock(env.header(1), types.Transactions{env.transfer(0, to), bad}, nil, nil, nil)
+
+			// outside of stateless execution, ApplyTransaction rejects it
+			_, err := env.execute(block, &vm.Config{ReadOnly: true})
+			var txErr *ErrTxApply
+			require.True(t, errors.As(err, &txErr), "got %v", err)
+			require.Equal(t, 1, txErr.TxIndex)
+
+			// rejected with a precise reason, but not fatal, in stateless execution
+			res, err := env.execute(block, &vm.Config{ReadOnly: true, StatelessExec: true})
+			require.NoError(t, err)
+			require.Len(t, res.Rejected, 1)
+			require.Equal(t, 1, res.Rejected[0].Index)
+			require.Contains(t, res.Rejected[0].Err, tc.err.Error())
+			require.Equal(t, map[uint8]int{types.LegacyTxType: 1}, res.CountByTxType)
+		})
+	}
+}
+
+func TestPreValidateTransactionIntrinsicGas(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	rules := env.config.Rules(1, 1)
+	to := libcommon.HexToAddress("0x02")
+	require.NoError(t, preValidateTransaction(env.call(0, to, 21_000, nil), rules, false))
+	require.ErrorIs(t, preValidateTransaction(env.call(0, to, 21_000, []byte{0x01}), rules, false), ErrIntrinsicGas)
+}
+
+func TestEphemeralExecResultPragueGolden(t *testing.T) {
+	prague := *params.AllProtocolChanges
+	prague.PragueTime = big.NewInt(0)
+	env := newExecTestEnv(t, &prague)
+	header := env.header(1)
+	header.RequestsHash = &types.EmptyRequestsHash
+	block := types.NewBlock(header, nil, nil, nil, []*types.Withdrawal{})
+
+	res, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	encoded, err := json.Marshal(res)
+	require.NoError(t, err)
+
+	golden, err := os.ReadFile("testdata/exec_result_prague.json")
+	require.NoError(t, err)
+	require.JSONEq(t, string(golden), string(encoded))
+}
+
+func TestExecuteBlockEphemerallyCollectAccessLists(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	first, second := libcommon.HexToAddress("0xa1"), libcommon.HexToAddress("0xa2")
+	slot := libcommon.HexToHash("0x05")
+	// BALANCE(first), BALANCE(second), SLOAD(5)
+	code := append([]byte{byte(vm.PUSH20)}, first[:]...)
+	code = append(code, byte(vm.BALANCE), byte(vm.POP), byte(vm.PUSH20))
+	code = append(code, second[:]...)
+	code = append(code, byte(vm.BALANCE), byte(vm.POP), byte(vm.PUSH1), 0x05, byte(vm.SLOAD), byte(vm.POP), byte(vm.STOP))
+	reader := libcommon.HexToAddress("0x10")
+	acc := accounts.NewAccount()
+	env.setAccount(reader, &acc, code)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.call(0, reader, 100_000, nil), env.transfer(1, to)}, nil)
+
+	res, err := env.execute(block, &vm.Config{ReadOnly: true, CollectAccessLists: true})
+	require.NoError(t, err)
+	require.Len(t, res.AccessLists, 2)
+	list := res.AccessLists[0]
+	require.Contains(t, list, types2.AccessTuple{Address: reader, StorageKeys: []libcommon.Hash{slot}})
+	require.Contains(t, list, types2.AccessTuple{Address: first, StorageKeys: []libcommon.Hash{}})
+	require.Contains(t, list, types2.AccessTuple{Address: second, StorageKeys: []libcommon.Hash{}})
+	require.Contains(t, list, types2.AccessTuple{Address: env.sender, StorageKeys: []libcommon.Hash{}})
+
+	// recording restarts with each transaction
+	list = res.AccessLists[1]
+	require.Contains(t, list, types2.AccessTuple{Address: to, StorageKeys: []libcommon.Hash{}})
+	for _, tuple := range list {
+		require.NotContains(t, []libcommon.Address{reader, first, second}, tuple.Address)
+	}
+
+	res, err = env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.Nil(t, res.AccessLists)
+}
+
+func TestExecuteBlockEphemerallyCollectOpcodeGas(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	// 1 + 2, discarded
+	adder := libcommon.HexToAddress("0xa1")
+	acc := accounts.NewAccount()
+	env.setAccount(adder, &acc, []byte{byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x02, byte(vm.ADD), byte(vm.POP), byte(vm.STOP)})
+	// CALL(GAS, adder, 0, 0, 0, 0, 0), discarded
+	caller := libcommon.HexToAddress("0xa2")
+	code := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20)}
+	code = append(code, adder[:]...)
+	code = append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.POP), byte(vm.STOP))
+	env.setAccount(caller, &acc, code)
+	txs := types.Transactions{env.call(0, adder, 100_000, nil), env.call(1, caller, 100_000, nil), env.transfer(2, libcommon.HexToAddress("0xb0"))}
+	block := env.seal(env.header(1), txs, nil)
+
+	res, err := env.execute(block, &vm.Config{ReadOnly: true, CollectOpcodeGas: true})
+	require.NoError(t, err)
+	require.Equal(t, map[vm.OpCode]uint64{
+		vm.PUSH1:  2*3 + 5*3 + 2*3,
+		vm.ADD:    2 * 3,
+		vm.POP:    3 * 2,
+		vm.STOP:   0,
+		vm.PUSH20: 3,
+		vm.GAS:    2,
+		// the cold account access, the gas forwarded to adder is tallied by
+		// its opcodes
+		vm.CALL: 2600,
+	}, res.OpcodeGas)
+	// the tallies add up to the gas used beyond the intrinsic gas
+	var opcodes uint64
+	for _, gas := range res.OpcodeGas {
+		opcodes += gas
+	}
+	require.Equal(t, uint64(len(txs))*21_000+opcodes, uint64(res.GasUsed))
+
+	res, err = env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.Nil(t, res.OpcodeGas)
+}
+
+func TestExecuteBlockEphemerallyCollectLogs(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	// LOG0 and LOG1 with an empty payload
+	emitter := libcommon.HexToAddress("0xe0")
+	acc := accounts.NewAccount()
+	env.setAccount(emitter, &acc, []byte{
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG0),
+		byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG1),
+	})
+	txs := types.Transactions{
+		env.call(0, emitter, 100_000, nil),
+		env.transfer(1, libcommon.HexToAddress("0x02")),
+		env.call(2, emitter, 100_000, nil),
+	}
+	block := env.seal(env.header(1), txs, nil)
+
+	res, err := env.execute(block, &vm.Config{ReadOnly: true, CollectLogs: true})
+	require.NoError(t, err)
+	require.Len(t, res.Logs, 4)
+	var receiptLogs []*types.Log
+	for _, receipt := range res.Receipts {
+		for _, l := range receipt.Logs {
+			require.Equal(t, receipt.TxHash, l.TxHash)
+			require.Equal(t, receipt.TransactionIndex, l.TxIndex)
+			receiptLogs = append(receiptLogs, l)
+		}
+	}
+	require.Equal(t, receiptLogs, res.Logs)
+	for i, l := range res.Logs {
+		require.Equal(t, block.Hash(), l.BlockHash)
+		require.Equal(t, block.NumberU64(), l.BlockNumber)
+		require.Equal(t, uint(i), l.Index)
+	}
+	require.Equal(t, uint(2), res.Logs[2].TxIndex)
+	require.Equal(t, txs[2].Hash(), res.Logs[2].TxHash)
+
+	res, err = env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+	require.Nil(t, res.Logs)
+}
+
+func TestExecuteBlockEphemerallyValidateTxOrdering(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	inOrder := env.seal(env.header(1), types.Transactions{env.transfer(0, to), env.transfer(1, to)}, nil)
+	res, err := env.execute(inOrder, &vm.Config{ReadOnly: true, ValidateTxOrdering: true})
+	require.NoError(t, err)
+	require.Empty(t, res.TxOrderingViolations)
+
+	underpriced := env.sign(types.NewTransaction(2, to, uint256.NewInt(1), 21_000, uint256.NewInt(0), nil))
+	txs := types.Transactions{env.transfer(1, to), env.transfer(0, to), underpriced}
+	block := types.NewBlock(env.header(1), txs, nil, nil, nil)
+	// the checks precede execution, which rejects the out of order nonces
+	res, err = env.execute(block, &vm.Config{ReadOnly: true, StatelessExec: true, ValidateTxOrdering: true})
+	require.NoError(t, err)
+	require.Len(t, res.TxOrderingViolations, 2)
+	nonce := res.TxOrderingViolations[0]
+	require.Equal(t, 1, nonce.TxIndex)
+	require.Equal(t, txs[1].Hash(), nonce.TxHash)
+	require.Equal(t, env.sender, nonce.Sender)
+	require.ErrorIs(t, nonce.Reason, ErrTxOrderingNonce)
+	baseFee := res.TxOrderingViolations[1]
+	require.Equal(t, 2, baseFee.TxIndex)
+	require.ErrorIs(t, baseFee.Reason, ErrTxOrderingBaseFee)
+
+	res, err = env.execute(block, &vm.Config{ReadOnly: true, StatelessExec: true})
+	require.NoError(t, err)
+	require.Nil(t, res.TxOrderingViolations)
+}
+
+func TestExecuteBlockEphemerallyStateRootHook(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	block := env.seal(env.header(1), types.Transactions{env.transfer(0, to)}, nil)
+	execute := func(hook func(libcommon.Hash) error, w state.WriterWithChangeSets) error {
+		ibs := state.New(state.NewPlainStateReader(env.tx))
+		_, err := ExecuteBlockEphemerally(env.config, &vm.Config{StateRootHook: hook}, func(n uint64) libcommon.Hash { return libcommon.Hash{} },
+			env.engine, block, state.NewPlainStateReader(env.tx), w, nil, nil, nil, ibs, env.logger)
+		return err
+	}
+
+	// the hook needs a writer computing state roots
+	err := execute(func(libcommon.Hash) error { return nil }, state.NewNoopWriter())
+	require.ErrorContains(t, err, "can't compute state roots")
+
+	preRoot, err := CalcHashRootForTests(env.tx, block.Header(), false)
+	require.NoError(t, err)
+	var computed libcommon.Hash
+	errRoot := errors.New("state root mismatch")
+	err = execute(func(root libcommon.Hash) error {
+		computed = root
+		if root != block.Root() {
+			return errRoot
+		}
+		return nil
+	}, state.NewHashedStateWriter(env.tx, 1))
+	require.ErrorIs(t, err, errRoot)
+	var rejected *ErrStateRootRejected
+	require.True(t, errors.As(err, &rejected), "got %v", err)
+	require.Equal(t, uint64(1), rejected.Block)
+	require.Equal(t, computed, rejected.Computed)
+	// the root of the state after the block
+	postRoot, err := CalcHashRootForTests(env.tx, block.Header(), false)
+	require.NoError(t, err)
+	require.Equal(t, postRoot, computed)
+	require.NotEqual(t, preRoot, computed)
+	require.NotEqual(t, block.Root(), computed)
+}
+
+func TestExecuteBlockEphemerallyPostMergeUncles(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	header := env.header(1)
+	header.Difficulty = big.NewInt(0)
+	block := env.seal(header, types.Transactions{env.transfer(0, libcommon.HexToAddress("0x01"))}, nil)
+
+	_, err := env.execute(block, &vm.Config{ReadOnly: true})
+	require.NoError(t, err)
+
+	uncle := env.header(0)
+	withUncle := types.NewBlock(block.Header(), block.Transactions(), []*types.Header{uncle}, nil, nil)
+	_, err = env.execute(withUncle, &vm.Config{ReadOnly: true})
+	require.ErrorIs(t, err, ErrPostMergeUncles)
+
+	// the header must commit to an empty uncle list too
+	badHash := block.Header()
+	badHash.UncleHash = libcommon.Hash{1}
+	_, err = env.execute(block.WithSeal(badHash), &vm.Config{ReadOnly: true})
+	require.ErrorIs(t, err, ErrPostMergeUncles)
+
+	_, err = env.execute(withUncle, &vm.Config{ReadOnly: true, StatelessExec: true})
+	require.NoError(t, err)
+}
+
+func TestExecuteBlockEphemerallyTrustsCachedSenders(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	tx := env.transfer(0, libcommon.HexToAddress("0x02"))
+	// the cached sender is used as is: recovering the signer would find the
+	// funded sender instead
+	tx.SetSender(libcommon.HexToAddress("0xf0"))
+	_, err := env.execute(types.NewBlock(env.header(1), types.Transactions{tx}, nil, nil, nil), &vm.Config{ReadOnly: true})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+// BenchmarkExecuteBlockEphemerallyCachedSenders compares blocks whose senders
+// are recovered with blocks whose senders were cached upstream, which skip
+// recovery without any option
+func BenchmarkExecuteBlockEphemerallyCachedSenders(b *testing.B) {
+	env := newExecTestEnv(b, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	txs := make(types.Transactions, 100)
+	for i := range txs {
+		txs[i] = env.transfer(uint64(i), to)
+	}
+	block := env.seal(env.header(1), txs, nil)
+
+	for _, bc := range []struct {
+		name   string
+		sender libcommon.Address
+	}{
+		// a zero cached sender is recovered again
+		{"recover", libcommon.Address{}},
+		{"cached", env.sender},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, tx := range block.Transactions() {
+					tx.SetSender(bc.sender)
+				}
+				if _, err := env.execute(block, &vm.Config{ReadOnly: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -18,6 +18,9 @@ package core
 
 import (
 	"errors"
+	"fmt"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
 
 	"github.com/erigontech/erigon/core/types"
 )
@@ -116,3 +119,138 @@ var (
 	// See EIP-3607: Reject transactions from senders with deployed code.
 	ErrSenderNoEOA = errors.New("sender not an eoa")
 )
+
+// Transaction format errors, detected by ExecuteBlockEphemerally before a
+// transaction is applied.
+var (
+	// ErrBlobTxWithoutBlobs is returned for a blob transaction carrying no blob hashes.
+	ErrBlobTxWithoutBlobs = errors.New("blob transaction without blob hashes")
+
+	// ErrBlobTxCreate is returned for a blob transaction without a recipient.
+	ErrBlobTxCreate = errors.New("blob transaction cannot create a contract")
+
+	// ErrSetCodeTxWithoutAuthorizations is returned for a set code transaction
+	// with an empty authorization list.
+	ErrSetCodeTxWithoutAuthorizations = errors.New("set code transaction without authorizations")
+
+	// ErrSetCodeTxCreate is returned for a set code transaction without a recipient.
+	ErrSetCodeTxCreate = errors.New("set code transaction cannot create a contract")
+)
+
+// Block content errors returned by ExecuteBlockEphemerally.
+var (
+	// ErrUnexpectedWithdrawals is returned for a block carrying withdrawals
+	// whose header has no withdrawals root, i.e. before Shanghai.
+	ErrUnexpectedWithdrawals = errors.New("withdrawals in block without withdrawals root")
+
+	// ErrPostMergeUncles is returned for a proof-of-stake block carrying
+	// uncles, or whose header doesn't commit to an empty uncle list.
+	ErrPostMergeUncles = errors.New("uncles in post-merge block")
+
+	// ErrMissingStateSync is returned when vm.Config.RequireStateSync is set
+	// and execution of a Bor block produced no state-sync logs.
+	ErrMissingStateSync = errors.New("bor block without state-sync logs")
+)
+
+// Block execution errors returned by ExecuteBlockEphemerally. They carry the
+// details of the failure so callers can tell them apart with errors.As.
+
+// ErrTxApply is returned when a transaction of the block can't be applied.
+type ErrTxApply struct {
+	TxIndex int
+	Block   uint64
+	TxHash  libcommon.Hash
+	Err     error
+}
+
+func (e *ErrTxApply) Error() string {
+	return fmt.Sprintf("could not apply tx %d from block %d [%v]: %v", e.TxIndex, e.Block, e.TxHash.Hex(), e.Err)
+}
+
+func (e *ErrTxApply) Unwrap() error { return e.Err }
+
+// ErrReceiptRootMismatch is returned when the receipts produced by execution
+// don't match the receipt root of the header.
+type ErrReceiptRootMismatch struct {
+	Block    uint64
+	Computed libcommon.Hash
+	Expected libcommon.Hash
+}
+
+func (e *ErrReceiptRootMismatch) Error() string {
+	return fmt.Sprintf("mismatched receipt headers for block %d (%s != %s)", e.Block, e.Computed.Hex(), e.Expected.Hex())
+}
+
+// ErrGasUsedMismatch is returned when the gas used by execution differs from
+// the gas used of the header.
+type ErrGasUsedMismatch struct {
+	Computed uint64
+	Expected uint64
+}
+
+func (e *ErrGasUsedMismatch) Error() string {
+	return fmt.Sprintf("gas used by execution: %d, in header: %d", e.Computed, e.Expected)
+}
+
+// ErrBlobGasMismatch is returned when the blob gas used by execution differs
+// from the blob gas used of the header.
+type ErrBlobGasMismatch struct {
+	Computed uint64
+	Expected uint64
+}
+
+func (e *ErrBlobGasMismatch) Error() string {
+	return fmt.Sprintf("blob gas used by execution: %d, in header: %d", e.Computed, e.Expected)
+}
+
+// ErrBloomMismatch is returned when the bloom of the receipts produced by
+// execution differs from the bloom of the header.
+type ErrBloomMismatch struct {
+	Computed types.Bloom
+	Expected types.Bloom
+}
+
+func (e *ErrBloomMismatch) Error() string {
+	return fmt.Sprintf("bloom computed by execution: %x, in header: %x", e.Computed, e.Expected)
+}
+
+// ErrWithdrawalsRootMismatch is returned when the root of the withdrawals of
+// the block differs from the withdrawals root of the header.
+type ErrWithdrawalsRootMismatch struct {
+	Computed libcommon.Hash
+	Expected libcommon.Hash
+}
+
+func (e *ErrWithdrawalsRootMismatch) Error() string {
+	return fmt.Sprintf("withdrawals root computed from block: %x, in header: %x", e.Computed, e.Expected)
+}
+
+// ErrPartialFinalize is returned by FinalizeBlockExecution when the state of
+// the block was committed to the state writer but its change sets could not be
+// written. The writer then holds the state of the block without its history:
+// the transaction behind it must be rolled back, and the block can't be
+// finalized again on top of it.
+type ErrPartialFinalize struct {
+	Block uint64
+	Err   error
+}
+
+func (e *ErrPartialFinalize) Error() string {
+	return fmt.Sprintf("writing changesets for block %d failed: %v", e.Block, e.Err)
+}
+
+func (e *ErrPartialFinalize) Unwrap() error { return e.Err }
+
+// ErrStateRootRejected is returned when vm.Config.StateRootHook rejects the
+// state root computed for a block.
+type ErrStateRootRejected struct {
+	Block    uint64
+	Computed libcommon.Hash
+	Err      error
+}
+
+func (e *ErrStateRootRejected) Error() string {
+	return fmt.Sprintf("state root %x of block %d rejected: %v", e.Computed, e.Block, e.Err)
+}
+
+func (e *ErrStateRootRejected) Unwrap() error { return e.Err }
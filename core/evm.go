@@ -34,6 +34,7 @@ import (
 	"github.com/erigontech/erigon/consensus/misc"
 	"github.com/erigontech/erigon/core/types"
 	"github.com/erigontech/erigon/core/vm/evmtypes"
+	"github.com/erigontech/erigon/params"
 )
 
 // NewEVMBlockContext creates a new context for use in the EVM.
@@ -143,6 +144,26 @@ func GetHashFn(ref *types.Header, getHeader func(hash libcommon.Hash, number uin
 	}
 }
 
+// MakeBlockHashFunc returns the block hash lookup for executing the block of
+// header, walking back through its ancestors via chainReader. Lookups are
+// memoized, and limited to the last BlockHashOldWindow blocks, or to the
+// BlockHashHistoryServeWindow of EIP-2935 once Prague is active. Hashes
+// outside the window, or of unknown ancestors, are zero.
+func MakeBlockHashFunc(chainReader consensus.ChainReader, header *types.Header) func(n uint64) libcommon.Hash {
+	window := params.BlockHashOldWindow
+	if chainReader.Config().IsPrague(header.Time) {
+		window = params.BlockHashHistoryServeWindow
+	}
+	number := header.Number.Uint64()
+	getHash := GetHashFn(header, chainReader.GetHeader)
+	return func(n uint64) libcommon.Hash {
+		if n >= number || number-n > window {
+			return libcommon.Hash{}
+		}
+		return getHash(n)
+	}
+}
+
 // CanTransfer checks whether there are enough funds in the address' account to make a transfer.
 // This does not take the necessary gas in to account to make the transfer valid.
 func CanTransfer(db evmtypes.IntraBlockState, addr libcommon.Address, amount *uint256.Int) bool {
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/erigontech/erigon-lib/chain"
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/consensus"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/params"
+)
+
+// headerChainReader serves a linear chain of headers, counting header reads
+type headerChainReader struct {
+	consensus.ChainReader
+	config  *chain.Config
+	headers map[libcommon.Hash]*types.Header
+	reads   int
+}
+
+func newHeaderChainReader(config *chain.Config, length int) (*headerChainReader, []*types.Header) {
+	r := &headerChainReader{config: config, headers: map[libcommon.Hash]*types.Header{}}
+	headers := make([]*types.Header, length)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i)), Time: uint64(i)}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+		r.headers[headers[i].Hash()] = headers[i]
+	}
+	return r, headers
+}
+
+func (r *headerChainReader) Config() *chain.Config { return r.config }
+
+func (r *headerChainReader) GetHeader(hash libcommon.Hash, number uint64) *types.Header {
+	r.reads++
+	if h, ok := r.headers[hash]; ok && h.Number.Uint64() == number {
+		return h
+	}
+	return nil
+}
+
+func TestMakeBlockHashFuncWindow(t *testing.T) {
+	const length = 300
+	reader, headers := newHeaderChainReader(params.AllProtocolChanges, length)
+	head := headers[length-1]
+	getHash := MakeBlockHashFunc(reader, head)
+
+	// the 256 most recent ancestors are served, in any order
+	oldest := uint64(length-1) - params.BlockHashOldWindow
+	require.Equal(t, headers[oldest].Hash(), getHash(oldest))
+	require.Equal(t, headers[length-2].Hash(), getHash(length-2))
+	require.Equal(t, headers[100].Hash(), getHash(100))
+
+	// the walk to the oldest ancestor is memoized
+	reads := reader.reads
+	require.Equal(t, headers[oldest+1].Hash(), getHash(oldest+1))
+	require.Equal(t, reads, reader.reads)
+
+	require.Equal(t, libcommon.Hash{}, getHash(oldest-1))
+	require.Equal(t, libcommon.Hash{}, getHash(0))
+	require.Equal(t, libcommon.Hash{}, getHash(length-1))
+	require.Equal(t, libcommon.Hash{}, getHash(length))
+	require.Equal(t, reads, reader.reads)
+}
+
+func TestMakeBlockHashFuncHistoryWindow(t *testing.T) {
+	prague := *params.AllProtocolChanges
+	prague.PragueTime = big.NewInt(0)
+	const length = 300
+	reader, headers := newHeaderChainReader(&prague, length)
+	getHash := MakeBlockHashFunc(reader, headers[length-1])
+
+	// EIP-2935 extends the window beyond 256 blocks
+	require.Equal(t, headers[0].Hash(), getHash(0))
+	require.Equal(t, libcommon.Hash{}, getHash(length-1))
+}
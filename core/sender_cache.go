@@ -0,0 +1,93 @@
+package core
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/erigontech/erigon-lib/chain"
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/types"
+)
+
+// DefaultSenderCacheSize is the number of senders a SenderCache created with a
+// non-positive size holds
+const DefaultSenderCacheSize = 100_000
+
+// SenderCache keeps the senders recovered by ExecuteBlockEphemerally, keyed by
+// transaction hash, so that transactions executed again within a batch of
+// blocks, e.g. when replaying a reorg, aren't recovered again. The hash covers
+// the signature, so a hit is the sender recovery would return. The cache is
+// bounded, holds the senders of a single chain and is cleared when used with
+// another one. Safe for concurrent use.
+type SenderCache struct {
+	mu      sync.Mutex
+	chainID *big.Int
+	senders *lru.Cache[libcommon.Hash, libcommon.Address]
+
+	hits, recovered atomic.Uint64
+}
+
+func NewSenderCache(size int) *SenderCache {
+	if size <= 0 {
+		size = DefaultSenderCacheSize
+	}
+	senders, err := lru.New[libcommon.Hash, libcommon.Address](size)
+	if err != nil {
+		panic(err)
+	}
+	return &SenderCache{senders: senders}
+}
+
+// Clear drops the cached senders, e.g. on a switch to another chain
+func (c *SenderCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.senders.Purge()
+	c.chainID = nil
+}
+
+// Len returns the number of cached senders
+func (c *SenderCache) Len() int { return c.senders.Len() }
+
+// Stats returns the number of senders served from the cache and the number
+// recovered from signatures
+func (c *SenderCache) Stats() (hits, recovered uint64) {
+	return c.hits.Load(), c.recovered.Load()
+}
+
+// useChain clears the cache if it was populated for another chain
+func (c *SenderCache) useChain(chainConfig *chain.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chainID != nil && (chainConfig.ChainID == nil || c.chainID.Cmp(chainConfig.ChainID) != 0) {
+		c.senders.Purge()
+	}
+	c.chainID = chainConfig.ChainID
+}
+
+// setSenders sets the senders of txs, from the cache or recovered with signer,
+// and caches the recovered ones. Transactions whose sender can't be recovered
+// are left for their execution to reject.
+func (c *SenderCache) setSenders(txs types.Transactions, signer *types.Signer) {
+	for _, tx := range txs {
+		if sender, ok := tx.GetSender(); ok {
+			c.senders.Add(tx.Hash(), sender)
+			continue
+		}
+		if sender, ok := c.senders.Get(tx.Hash()); ok {
+			c.hits.Add(1)
+			tx.SetSender(sender)
+			continue
+		}
+		sender, err := tx.Sender(*signer)
+		if err != nil {
+			continue
+		}
+		c.recovered.Add(1)
+		c.senders.Add(tx.Hash(), sender)
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/rlp"
+
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/vm"
+	"github.com/erigontech/erigon/params"
+)
+
+// refetch returns block decoded from its encoding, with no senders recovered
+// yet, like a block fetched again when replaying a reorg
+func refetch(t *testing.T, block *types.Block) *types.Block {
+	t.Helper()
+	encoded, err := rlp.EncodeToBytes(block)
+	require.NoError(t, err)
+	decoded := new(types.Block)
+	require.NoError(t, rlp.DecodeBytes(encoded, decoded))
+	for _, tx := range decoded.Transactions() {
+		_, ok := tx.GetSender()
+		require.False(t, ok)
+	}
+	return decoded
+}
+
+func TestExecuteBlockEphemerallySenderCache(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	to := libcommon.HexToAddress("0x02")
+	// the canonical block and the fork block replacing it on a reorg, sharing
+	// the first transaction
+	shared := env.transfer(0, to)
+	// an empty withdrawals list gives the Cancun header a withdrawals root, so
+	// that it encodes
+	canonical := env.seal(env.header(1), types.Transactions{shared, env.transfer(1, to)}, []*types.Withdrawal{})
+	forkHeader := env.header(1)
+	forkHeader.Coinbase = libcommon.HexToAddress("0xc1")
+	fork := env.seal(forkHeader, types.Transactions{shared}, []*types.Withdrawal{})
+
+	cache := NewSenderCache(16)
+	buffers := NewExecutionBuffers().WithSenderCache(cache)
+	for _, block := range []*types.Block{canonical, fork, canonical} {
+		res, err := env.executeWithBuffers(refetch(t, block), &vm.Config{ReadOnly: true}, buffers)
+		require.NoError(t, err)
+		require.Len(t, res.Receipts, block.Transactions().Len())
+	}
+	// without the cache the replays recover 5 senders
+	hits, recovered := cache.Stats()
+	require.Equal(t, uint64(2), recovered)
+	require.Equal(t, uint64(3), hits)
+	require.Equal(t, 2, cache.Len())
+
+	// a cached sender is the one recovered
+	replayed := refetch(t, fork)
+	cache.setSenders(replayed.Transactions(), env.signer)
+	sender, ok := replayed.Transactions()[0].GetSender()
+	require.True(t, ok)
+	require.Equal(t, env.sender, sender)
+
+	// switching chains clears the cache
+	other := *env.config
+	other.ChainID = new(big.Int).Add(env.config.ChainID, big.NewInt(1))
+	cache.useChain(&other)
+	require.Zero(t, cache.Len())
+	cache.useChain(env.config)
+	require.Zero(t, cache.Len())
+
+	cache.setSenders(refetch(t, canonical).Transactions(), env.signer)
+	require.Equal(t, 2, cache.Len())
+	cache.Clear()
+	require.Zero(t, cache.Len())
+}
+
+func TestSenderCacheBounded(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	cache := NewSenderCache(2)
+	txs := make(types.Transactions, 4)
+	for i := range txs {
+		txs[i] = env.transfer(uint64(i), libcommon.HexToAddress("0x02"))
+	}
+	cache.setSenders(txs, env.signer)
+	require.Equal(t, 2, cache.Len())
+	_, recovered := cache.Stats()
+	require.Equal(t, uint64(4), recovered)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/state"
+	"github.com/erigontech/erigon/core/types"
+)
+
+var (
+	// ErrAuthorizationChainID is the reason for skipping an authorization
+	// signed for another chain
+	ErrAuthorizationChainID = errors.New("authorization chain id mismatch")
+	// ErrAuthorizationSignature is the reason for skipping an authorization
+	// whose authority can't be recovered
+	ErrAuthorizationSignature = errors.New("invalid authorization signature")
+	// ErrAuthorizationCode is the reason for skipping an authorization whose
+	// authority has code other than a delegation
+	ErrAuthorizationCode = errors.New("authority has code")
+	// ErrAuthorizationNonce is the reason for skipping an authorization that
+	// doesn't match the nonce of its authority
+	ErrAuthorizationNonce = errors.New("authorization nonce mismatch")
+)
+
+// AuthResult is the outcome of an EIP-7702 authorization of a set code
+// transaction
+type AuthResult struct {
+	Index     int
+	Authority libcommon.Address // zero if the signature didn't recover
+	// Reason is why the authorization would be skipped, nil if it applies
+	Reason error
+}
+
+// Applies reports whether the authorization would set the code of its
+// authority
+func (r AuthResult) Applies() bool { return r.Reason == nil }
+
+// ValidateAuthorizations checks the authorizations of a set code transaction
+// against ibs the same way its execution does, in order, so that block
+// builders can pre-screen transactions. The nonces and code set by earlier
+// authorizations, and the sender's nonce increment, are accounted for without
+// modifying ibs.
+func ValidateAuthorizations(tx types.Transaction, chainID *uint256.Int, ibs *state.IntraBlockState) ([]AuthResult, error) {
+	setCodeTx, ok := tx.(*types.SetCodeTransaction)
+	if !ok {
+		return nil, fmt.Errorf("transaction type %d has no authorizations", tx.Type())
+	}
+	sender, err := tx.Sender(*types.LatestSignerForChainID(chainID.ToBig()))
+	if err != nil {
+		return nil, err
+	}
+
+	// nonces and delegations as left by the transaction so far
+	nonces := map[libcommon.Address]uint64{sender: ibs.GetNonce(sender) + 1}
+	delegated := map[libcommon.Address]bool{}
+
+	auths := setCodeTx.GetAuthorizations()
+	results := make([]AuthResult, len(auths))
+	var b [32]byte
+	data := bytes.NewBuffer(nil)
+	for i := range auths {
+		auth := &auths[i]
+		results[i].Index = i
+		data.Reset()
+
+		if !auth.ChainID.IsZero() && !auth.ChainID.Eq(chainID) {
+			results[i].Reason = ErrAuthorizationChainID
+			continue
+		}
+
+		authorityPtr, err := auth.RecoverSigner(data, b[:])
+		if err != nil {
+			results[i].Reason = fmt.Errorf("%w: %w", ErrAuthorizationSignature, err)
+			continue
+		}
+		authority := *authorityPtr
+		results[i].Authority = authority
+
+		if !delegated[authority] {
+			codeHash := ibs.GetCodeHash(authority)
+			if codeHash != emptyCodeHash && codeHash != (libcommon.Hash{}) {
+				if _, ok := ibs.GetDelegatedDesignation(authority); !ok {
+					results[i].Reason = ErrAuthorizationCode
+					continue
+				}
+			}
+		}
+
+		nonce, ok := nonces[authority]
+		if !ok {
+			nonce = ibs.GetNonce(authority)
+		}
+		if nonce != auth.Nonce {
+			results[i].Reason = fmt.Errorf("%w: authority %x has %d, authorization %d", ErrAuthorizationNonce, authority, nonce, auth.Nonce)
+			continue
+		}
+
+		nonces[authority] = nonce + 1
+		delegated[authority] = true
+	}
+	return results, nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/rlp"
+
+	"github.com/erigontech/erigon/core/state"
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/types/accounts"
+	"github.com/erigontech/erigon/params"
+)
+
+// signAuthorization signs a delegation of the key's account to address
+func signAuthorization(t *testing.T, key *ecdsa.PrivateKey, chainID *uint256.Int, address libcommon.Address, nonce uint64) types.Authorization {
+	t.Helper()
+	payload, err := rlp.EncodeToBytes([]interface{}{chainID.ToBig(), address, nonce})
+	require.NoError(t, err)
+	sig, err := crypto.Sign(crypto.Keccak256(append([]byte{params.SetCodeMagicPrefix}, payload...)), key)
+	require.NoError(t, err)
+	auth := types.Authorization{ChainID: *chainID, Address: address, Nonce: nonce, YParity: sig[64]}
+	auth.R.SetBytes(sig[:32])
+	auth.S.SetBytes(sig[32:64])
+	return auth
+}
+
+func TestValidateAuthorizations(t *testing.T) {
+	env := newExecTestEnv(t, params.AllProtocolChanges)
+	chainID := uint256.MustFromBig(env.config.ChainID)
+	delegate := libcommon.HexToAddress("0xde")
+
+	fresh, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	stale, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	acc := accounts.NewAccount()
+	acc.Nonce = 5
+	env.setAccount(crypto.PubkeyToAddress(stale.PublicKey), &acc, nil)
+	withCode, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	acc = accounts.NewAccount()
+	env.setAccount(crypto.PubkeyToAddress(withCode.PublicKey), &acc, []byte{0x00})
+
+	invalid := signAuthorization(t, fresh, chainID, delegate, 0)
+	invalid.S.SetAllOne()
+	auths := []types.Authorization{
+		signAuthorization(t, fresh, chainID, delegate, 0),
+		signAuthorization(t, fresh, uint256.NewInt(12345), delegate, 1),
+		signAuthorization(t, stale, chainID, delegate, 3),
+		signAuthorization(t, stale, chainID, delegate, 5),
+		// the nonce incremented by the previous authorization
+		signAuthorization(t, fresh, chainID, delegate, 1),
+		// any chain
+		signAuthorization(t, fresh, new(uint256.Int), delegate, 2),
+		invalid,
+		signAuthorization(t, withCode, chainID, delegate, 0),
+		// the sender's nonce is incremented before the authorizations apply
+		signAuthorization(t, env.key, chainID, delegate, 1),
+	}
+	to := libcommon.HexToAddress("0x02")
+	tx := env.sign(&types.SetCodeTransaction{
+		DynamicFeeTransaction: types.DynamicFeeTransaction{
+			CommonTx: types.CommonTx{Nonce: 0, Gas: 100_000, To: &to, Value: uint256.NewInt(0)},
+			ChainID:  chainID,
+			Tip:      uint256.NewInt(1),
+			FeeCap:   uint256.NewInt(10),
+		},
+		Authorizations: auths,
+	})
+
+	ibs := state.New(state.NewPlainStateReader(env.tx))
+	results, err := ValidateAuthorizations(tx, chainID, ibs)
+	require.NoError(t, err)
+	require.Len(t, results, len(auths))
+
+	applies := []bool{true, false, false, true, true, true, false, false, true}
+	for i, r := range results {
+		require.Equal(t, i, r.Index)
+		require.Equal(t, applies[i], r.Applies(), "authorization %d: %v", i, r.Reason)
+	}
+	require.Equal(t, crypto.PubkeyToAddress(fresh.PublicKey), results[0].Authority)
+	require.ErrorIs(t, results[1].Reason, ErrAuthorizationChainID)
+	require.ErrorIs(t, results[2].Reason, ErrAuthorizationNonce)
+	require.ErrorIs(t, results[6].Reason, ErrAuthorizationSignature)
+	require.Equal(t, libcommon.Address{}, results[6].Authority)
+	require.ErrorIs(t, results[7].Reason, ErrAuthorizationCode)
+
+	// nothing was applied to the state
+	require.Zero(t, ibs.GetNonce(crypto.PubkeyToAddress(fresh.PublicKey)))
+	require.Equal(t, uint64(5), ibs.GetNonce(crypto.PubkeyToAddress(stale.PublicKey)))
+	require.Zero(t, ibs.GetNonce(env.sender))
+	require.Empty(t, ibs.GetCode(crypto.PubkeyToAddress(fresh.PublicKey)))
+
+	_, err = ValidateAuthorizations(env.transfer(0, to), chainID, ibs)
+	require.Error(t, err)
+}
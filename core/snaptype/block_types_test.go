@@ -3,6 +3,8 @@ package snaptype_test
 import (
 	"testing"
 
+	snaptype2 "github.com/erigontech/erigon-lib/downloader/snaptype"
+
 	"github.com/erigontech/erigon/core/snaptype"
 )
 
@@ -36,3 +38,15 @@ func TestNames(t *testing.T) {
 		t.Fatal("name mismatch", snaptype.Transactions, snaptype.Transactions.Name(), snaptype.Enums.Transactions.String())
 	}
 }
+
+func TestClassifySnapshot(t *testing.T) {
+	for _, name := range []string{"v1-000000-000500-headers.seg", "v1.1-000000-000500-headers.idx"} {
+		category, typ, ok := snaptype2.ClassifySnapshot(name)
+		if !ok || category != snaptype2.ExecutionCategory || typ.Enum() != snaptype.Enums.Headers {
+			t.Fatal("unexpected classification", name, category, typ, ok)
+		}
+		if category.IsCaplin() {
+			t.Fatal("unexpected caplin category", name)
+		}
+	}
+}
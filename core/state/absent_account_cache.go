@@ -0,0 +1,58 @@
+package state
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+)
+
+// absentAccountCache is a bounded set of addresses known to have no account,
+// used by CachedReader2 so that repeated reads of cold addresses within a
+// block do not go to the cache view and database every time. Entries are
+// dropped by the writes made through CachedReader2.InvalidatingWriter.
+// A nil *absentAccountCache is valid and caches nothing.
+type absentAccountCache struct {
+	entries map[libcommon.Address]struct{}
+	limit   int
+}
+
+func newAbsentAccountCache(limit int) *absentAccountCache {
+	if limit <= 0 {
+		return nil
+	}
+	return &absentAccountCache{
+		entries: make(map[libcommon.Address]struct{}, limit),
+		limit:   limit,
+	}
+}
+
+func (c *absentAccountCache) contains(address libcommon.Address) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.entries[address]
+	return ok
+}
+
+func (c *absentAccountCache) add(address libcommon.Address) {
+	if c == nil {
+		return
+	}
+	if len(c.entries) >= c.limit {
+		// same policy as incarnationCache: start over once full
+		clear(c.entries)
+	}
+	c.entries[address] = struct{}{}
+}
+
+func (c *absentAccountCache) remove(address libcommon.Address) {
+	if c == nil {
+		return
+	}
+	delete(c.entries, address)
+}
+
+func (c *absentAccountCache) reset() {
+	if c == nil {
+		return
+	}
+	clear(c.entries)
+}
@@ -17,7 +17,11 @@
 package state
 
 import (
+	"bytes"
+	"slices"
+
 	"github.com/erigontech/erigon-lib/common"
+	types2 "github.com/erigontech/erigon-lib/types"
 )
 
 type accessList struct {
@@ -54,6 +58,24 @@ func newAccessList() *accessList {
 	}
 }
 
+// toAccessList converts the accessList into an EIP-2930 access list, sorted
+// by address and storage key.
+func (al *accessList) toAccessList() types2.AccessList {
+	list := make(types2.AccessList, 0, len(al.addresses))
+	for address, idx := range al.addresses {
+		tuple := types2.AccessTuple{Address: address, StorageKeys: []common.Hash{}}
+		if idx >= 0 {
+			for slot := range al.slots[idx] {
+				tuple.StorageKeys = append(tuple.StorageKeys, slot)
+			}
+			slices.SortFunc(tuple.StorageKeys, func(a, b common.Hash) int { return bytes.Compare(a[:], b[:]) })
+		}
+		list = append(list, tuple)
+	}
+	slices.SortFunc(list, func(a, b types2.AccessTuple) int { return bytes.Compare(a.Address[:], b.Address[:]) })
+	return list
+}
+
 // Copy creates an independent copy of an accessList.
 func (al *accessList) Copy() *accessList {
 	cp := newAccessList()
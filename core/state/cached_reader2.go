@@ -2,7 +2,7 @@ package state
 
 import (
 	"bytes"
-	"encoding/binary"
+	"fmt"
 
 	"github.com/erigontech/erigon-lib/kv/dbutils"
 
@@ -10,48 +10,152 @@ import (
 	"github.com/erigontech/erigon-lib/kv"
 	"github.com/erigontech/erigon-lib/kv/kvcache"
 
-	"github.com/erigontech/erigon/core/types"
 	"github.com/erigontech/erigon/core/types/accounts"
 )
 
+// AccountCache is the view of the state CachedReader2 reads accounts, storage
+// and code from. Get takes plain state keys and GetCode code hashes; both
+// return an empty value for missing entries. kvcache.CacheView satisfies it.
+type AccountCache interface {
+	Get(k []byte) ([]byte, error)
+	GetCode(codeHash []byte) ([]byte, error)
+}
+
+var _ AccountCache = kvcache.CacheView(nil)
+
 // CachedReader2 is a wrapper for an instance of type StateReader
 // This wrapper only makes calls to the underlying reader if the item is not in the cache
 type CachedReader2 struct {
-	cache kvcache.CacheView
-	db    kv.Tx
+	cache        AccountCache
+	db           kv.Tx
+	ttx          kv.TemporalTx // set if db is temporal, used to read code from CodeDomain
+	incarnations *incarnationCache
+	absent       *absentAccountCache
+	closed       bool
 }
 
 // NewCachedReader2 wraps a given state reader into the cached reader
-func NewCachedReader2(cache kvcache.CacheView, tx kv.Tx) *CachedReader2 {
-	return &CachedReader2{cache: cache, db: tx}
+func NewCachedReader2(cache AccountCache, tx kv.Tx) *CachedReader2 {
+	r := &CachedReader2{cache: cache, db: tx}
+	if ttx, ok := tx.(kv.TemporalTx); ok {
+		r.ttx = ttx
+	}
+	return r
+}
+
+// SetIncarnationCacheSize enables a bounded per-reader cache of kv.IncarnationMap
+// lookups holding up to size addresses. Zero disables caching (the default).
+// Callers reusing the reader across blocks must call Reset between blocks.
+func (r *CachedReader2) SetIncarnationCacheSize(size int) {
+	r.incarnations = newIncarnationCache(size)
+}
+
+// SetAbsentAccountCacheSize enables a bounded per-reader cache of addresses
+// found to have no account, holding up to size addresses. Zero disables
+// caching (the default). Accounts written while the reader is in use must be
+// written through InvalidatingWriter, and callers reusing the reader across
+// blocks must call Reset between blocks.
+func (r *CachedReader2) SetAbsentAccountCacheSize(size int) {
+	r.absent = newAbsentAccountCache(size)
+}
+
+// InvalidatingWriter returns a writer passing the writes to w, that drops what
+// the reader remembers about every account written through it
+func (r *CachedReader2) InvalidatingWriter(w WriterWithChangeSets) WriterWithChangeSets {
+	return &invalidatingWriter{WriterWithChangeSets: w, r: r}
+}
+
+// invalidatingWriter is the writer returned by CachedReader2.InvalidatingWriter
+type invalidatingWriter struct {
+	WriterWithChangeSets
+	r *CachedReader2
+}
+
+func (w *invalidatingWriter) UpdateAccountData(address common.Address, original, account *accounts.Account) error {
+	w.r.InvalidateAccount(address)
+	return w.WriterWithChangeSets.UpdateAccountData(address, original, account)
+}
+
+func (w *invalidatingWriter) DeleteAccount(address common.Address, original *accounts.Account) error {
+	w.r.InvalidateAccount(address)
+	return w.WriterWithChangeSets.DeleteAccount(address, original)
+}
+
+func (w *invalidatingWriter) CreateContract(address common.Address) error {
+	w.r.InvalidateAccount(address)
+	return w.WriterWithChangeSets.CreateContract(address)
+}
+
+// InvalidateAccount drops what the reader remembers about address, so that
+// the next read of it goes to the underlying state
+func (r *CachedReader2) InvalidateAccount(address common.Address) {
+	r.absent.remove(address)
+	r.incarnations.remove(address)
+}
+
+// Reset drops all per-reader cached data
+func (r *CachedReader2) Reset() {
+	r.incarnations.reset()
+	r.absent.reset()
+}
+
+// Close marks the reader as closed; it holds no cursors of its own. Reads
+// after Close fail with ErrReaderClosed.
+func (r *CachedReader2) Close() error {
+	r.closed = true
+	return nil
 }
 
 // ReadAccountData is called when an account needs to be fetched from the state
 func (r *CachedReader2) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	a, _, err := r.readAccount(address)
+	return a, err
+}
+
+// ReadAccountWithCode reads an account together with its code, which is nil
+// for accounts without code. The code read to recover the CodeHash of a
+// delegation is reused. It returns a nil account for a missing one.
+func (r *CachedReader2) ReadAccountWithCode(address common.Address) (*accounts.Account, []byte, error) {
+	a, code, err := r.readAccount(address)
+	if err != nil || a == nil || code != nil {
+		return a, code, err
+	}
+	if code, err = r.ReadAccountCode(address, a.Incarnation, a.CodeHash); err != nil {
+		return nil, nil, err
+	}
+	return a, code, nil
+}
+
+// readAccount reads an account, also returning the delegation code if its
+// CodeHash had to be recovered
+func (r *CachedReader2) readAccount(address common.Address) (*accounts.Account, []byte, error) {
+	if r.closed {
+		return nil, nil, ErrReaderClosed
+	}
+	if r.absent.contains(address) {
+		return nil, nil, nil
+	}
 	enc, err := r.cache.Get(address[:])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(enc) == 0 {
-		return nil, nil
+		r.absent.add(address)
+		return nil, nil, nil
 	}
 	var a accounts.Account
 	if err = a.DecodeForStorage(enc); err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("account %x: %w", address, err)
 	}
 	// v12: Restore CodeHash recovery for EIP-7702 delegation accounts
-	if a.IsEmptyCodeHash() {
-		if codeHash, err2 := r.db.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(address[:], a.Incarnation)); err2 == nil && len(codeHash) > 0 && !bytes.Equal(codeHash, emptyCodeHash) {
-			// Verify the code is a valid EIP-7702 delegation before using this CodeHash
-			if code, err3 := r.db.GetOne(kv.Code, codeHash); err3 == nil && types.IsDelegation(code) {
-				a.CodeHash = common.BytesToHash(codeHash)
-			}
-		}
-	}
-	return &a, nil
+	code := recoverDelegationCode(r.db, address, &a)
+	return &a, code, nil
 }
 
 func (r *CachedReader2) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
 	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, key.Bytes())
 	enc, err := r.cache.Get(compositeKey)
 	if err != nil {
@@ -64,14 +168,26 @@ func (r *CachedReader2) ReadAccountStorage(address common.Address, incarnation u
 }
 
 func (r *CachedReader2) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
 	if bytes.Equal(codeHash.Bytes(), emptyCodeHash) {
 		return nil, nil
 	}
 	code, err := r.cache.GetCode(codeHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 && r.ttx != nil {
+		// Erigon-3 snapshots keep code in CodeDomain keyed by address
+		if code, err = readCodeDomain(r.ttx, address, codeHash); err != nil {
+			return nil, err
+		}
+	}
 	if len(code) == 0 {
 		return nil, nil
 	}
-	return code, err
+	return code, nil
 }
 
 func (r *CachedReader2) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
@@ -80,12 +196,20 @@ func (r *CachedReader2) ReadAccountCodeSize(address common.Address, incarnation
 }
 
 func (r *CachedReader2) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if r.closed {
+		return 0, ErrReaderClosed
+	}
+	if incarnation, ok := r.incarnations.get(address); ok {
+		return incarnation, nil
+	}
 	b, err := r.db.GetOne(kv.IncarnationMap, address.Bytes())
 	if err != nil {
 		return 0, err
 	}
-	if len(b) == 0 {
-		return 0, nil
+	incarnation, err := decodeIncarnation(address, b)
+	if err != nil {
+		return 0, err
 	}
-	return binary.BigEndian.Uint64(b), nil
+	r.incarnations.put(address, incarnation)
+	return incarnation, nil
 }
@@ -0,0 +1,199 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/dbutils"
+	"github.com/erigontech/erigon-lib/kv/kvcache"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// plainStateGetCounter counts the PlainState reads made through it
+type plainStateGetCounter struct {
+	kv.RwTx
+	gets int
+}
+
+func (tx *plainStateGetCounter) GetOne(table string, key []byte) ([]byte, error) {
+	if table == kv.PlainState {
+		tx.gets++
+	}
+	return tx.RwTx.GetOne(table, key)
+}
+
+func TestCachedReader2AbsentAccounts(t *testing.T) {
+	_, rwTx := memdb.NewTestTx(t)
+	tx := &plainStateGetCounter{RwTx: rwTx}
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	r := NewCachedReader2(view, tx)
+	r.SetAbsentAccountCacheSize(16)
+
+	cold := libcommon.HexToAddress("0x01")
+	for i := 0; i < 3; i++ {
+		acc, err := r.ReadAccountData(cold)
+		require.NoError(t, err)
+		require.Nil(t, acc)
+	}
+	require.Equal(t, 1, tx.gets)
+
+	// once written and invalidated, the account is read again
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(5)
+	putAccount(t, tx, cold, &acc)
+	r.InvalidateAccount(cold)
+	read, err := r.ReadAccountData(cold)
+	require.NoError(t, err)
+	require.NotNil(t, read)
+	require.Equal(t, uint64(5), read.Balance.Uint64())
+
+	// existing accounts are never remembered as absent
+	_, err = r.ReadAccountData(cold)
+	require.NoError(t, err)
+	require.Equal(t, 3, tx.gets)
+
+	// Reset forgets absences too
+	other := libcommon.HexToAddress("0x02")
+	_, err = r.ReadAccountData(other)
+	require.NoError(t, err)
+	putAccount(t, tx, other, &acc)
+	r.Reset()
+	read, err = r.ReadAccountData(other)
+	require.NoError(t, err)
+	require.NotNil(t, read)
+}
+
+func TestCachedReader2AbsentAccountWritten(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	r := NewCachedReader2(view, tx)
+	r.SetAbsentAccountCacheSize(16)
+	w := r.InvalidatingWriter(NewPlainStateWriterNoHistory(tx))
+
+	created, contract := libcommon.HexToAddress("0x01"), libcommon.HexToAddress("0x02")
+	for _, address := range []libcommon.Address{created, contract} {
+		read, err := r.ReadAccountData(address)
+		require.NoError(t, err)
+		require.Nil(t, read)
+	}
+
+	// an account written after a miss is read back
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(5)
+	require.NoError(t, w.UpdateAccountData(created, &accounts.Account{}, &acc))
+	read, err := r.ReadAccountData(created)
+	require.NoError(t, err)
+	require.NotNil(t, read)
+	require.Equal(t, uint64(5), read.Balance.Uint64())
+
+	// and so is its deletion
+	require.NoError(t, w.DeleteAccount(created, &acc))
+	read, err = r.ReadAccountData(created)
+	require.NoError(t, err)
+	require.Nil(t, read)
+
+	require.NoError(t, w.CreateContract(contract))
+	require.NoError(t, w.UpdateAccountData(contract, &accounts.Account{}, &acc))
+	read, err = r.ReadAccountData(contract)
+	require.NoError(t, err)
+	require.NotNil(t, read)
+}
+
+// mapAccountCache is an AccountCache over plain maps, counting the reads
+type mapAccountCache struct {
+	state map[string][]byte
+	code  map[string][]byte
+	reads int
+}
+
+func (c *mapAccountCache) Get(k []byte) ([]byte, error) {
+	c.reads++
+	return c.state[string(k)], nil
+}
+
+func (c *mapAccountCache) GetCode(codeHash []byte) ([]byte, error) {
+	c.reads++
+	return c.code[string(codeHash)], nil
+}
+
+func TestCachedReader2AccountCache(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	address := libcommon.HexToAddress("0x01")
+	code := []byte{0x60, 0x00}
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(7)
+	acc.Incarnation = 1
+	acc.CodeHash = crypto.Keccak256Hash(code)
+	enc := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(enc)
+	key := libcommon.HexToHash("0x02")
+	cache := &mapAccountCache{
+		state: map[string][]byte{
+			string(address[:]): enc,
+			string(dbutils.PlainGenerateCompositeStorageKey(address[:], 1, key[:])): {0x2a},
+		},
+		code: map[string][]byte{string(acc.CodeHash[:]): code},
+	}
+	r := NewCachedReader2(cache, tx)
+
+	read, err := r.ReadAccountData(address)
+	require.NoError(t, err)
+	require.NotNil(t, read)
+	require.Equal(t, uint64(7), read.Balance.Uint64())
+	value, err := r.ReadAccountStorage(address, 1, &key)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x2a}, value)
+	readCode, err := r.ReadAccountCode(address, 1, acc.CodeHash)
+	require.NoError(t, err)
+	require.Equal(t, code, readCode)
+	require.Equal(t, 3, cache.reads)
+
+	read, err = r.ReadAccountData(libcommon.HexToAddress("0x03"))
+	require.NoError(t, err)
+	require.Nil(t, read)
+}
+
+func BenchmarkCachedReader2ColdAddresses(b *testing.B) {
+	_, tx := memdb.NewTestTx(b)
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(b, err)
+	const addresses, readsPerAddress = 1000, 8
+	cold := make([]libcommon.Address, addresses)
+	for i := range cold {
+		cold[i] = libcommon.BytesToAddress([]byte{0xc0, byte(i >> 8), byte(i)})
+	}
+
+	for _, bc := range []struct {
+		name string
+		size int
+	}{
+		{"uncached", 0},
+		{"negative cache", addresses},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			r := NewCachedReader2(view, tx)
+			r.SetAbsentAccountCacheSize(bc.size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.Reset()
+				for j := 0; j < readsPerAddress; j++ {
+					for _, address := range cold {
+						if _, err := r.ReadAccountData(address); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
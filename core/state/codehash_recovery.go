@@ -0,0 +1,198 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/dbutils"
+
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// Diagnostics counts the EIP-7702 CodeHash recoveries performed by the state
+// readers since process start or the last ResetDiagnostics. The counters are
+// process-wide.
+type Diagnostics struct {
+	EmptyCodeHash       uint64 `json:"emptyCodeHash"`       // accounts read with an empty CodeHash
+	ContractCodeFound   uint64 `json:"contractCodeFound"`   // ...that had a PlainContractCode entry
+	ContractCodeMissing uint64 `json:"contractCodeMissing"` // ...that had none
+	Recovered           uint64 `json:"recovered"`           // ...whose code is a delegation and got its CodeHash restored
+	CodeDomainHits      uint64 `json:"codeDomainHits"`      // code reads served from CodeDomain after a Code miss
+}
+
+type codeHashRecoveryCounters struct {
+	emptyCodeHash       atomic.Uint64
+	contractCodeFound   atomic.Uint64
+	contractCodeMissing atomic.Uint64
+	recovered           atomic.Uint64
+	codeDomainHits      atomic.Uint64
+}
+
+// codeHashRecovery is swapped out as a whole by ResetDiagnostics, so that all
+// counters restart from zero together
+var codeHashRecovery atomic.Pointer[codeHashRecoveryCounters]
+
+func init() {
+	codeHashRecovery.Store(&codeHashRecoveryCounters{})
+}
+
+// GetDiagnostics returns the current CodeHash recovery counters
+func GetDiagnostics() Diagnostics {
+	c := codeHashRecovery.Load()
+	return Diagnostics{
+		EmptyCodeHash:       c.emptyCodeHash.Load(),
+		ContractCodeFound:   c.contractCodeFound.Load(),
+		ContractCodeMissing: c.contractCodeMissing.Load(),
+		Recovered:           c.recovered.Load(),
+		CodeDomainHits:      c.codeDomainHits.Load(),
+	}
+}
+
+// ResetDiagnostics zeroes all CodeHash recovery counters at once. Reads
+// racing with the reset are counted in either the old or the new period.
+func ResetDiagnostics() {
+	codeHashRecovery.Store(&codeHashRecoveryCounters{})
+}
+
+// recoverDelegationCodeHash restores the CodeHash of an EIP-7702 delegation
+// account whose storage encoding lost it, using PlainContractCode. The CodeHash
+// is only used if the code it points to is a valid delegation.
+func recoverDelegationCodeHash(db kv.Getter, address libcommon.Address, a *accounts.Account) {
+	recoverDelegationCode(db, address, a)
+}
+
+// recoverDelegationCode is recoverDelegationCodeHash also returning the
+// delegation code read for the recovery, nil if the CodeHash wasn't recovered
+func recoverDelegationCode(db kv.Getter, address libcommon.Address, a *accounts.Account) []byte {
+	if !a.IsEmptyCodeHash() {
+		return nil
+	}
+	codeHash, code, ok, _ := plainDelegationCode(db, address, a.Incarnation)
+	if !ok {
+		return nil
+	}
+	a.CodeHash = codeHash
+	return code
+}
+
+// plainDelegationCodeHash looks up the CodeHash of address in
+// PlainContractCode, returning it only if the code is a delegation.
+//
+// The entry is keyed by the incarnation of the account as stored, which the
+// writers use when setting code: a delegation set on an EOA stays at
+// incarnation 0. Substituting FirstContractIncarnation for 0 would miss its
+// entry, or pick up a stale one left by a destructed contract, so all readers
+// pass the incarnation through unchanged.
+func plainDelegationCodeHash(db kv.Getter, address libcommon.Address, incarnation uint64) (libcommon.Hash, bool, error) {
+	codeHash, _, ok, err := plainDelegationCode(db, address, incarnation)
+	return codeHash, ok, err
+}
+
+// plainDelegationCode is plainDelegationCodeHash also returning the code
+func plainDelegationCode(db kv.Getter, address libcommon.Address, incarnation uint64) (libcommon.Hash, []byte, bool, error) {
+	counters := codeHashRecovery.Load()
+	counters.emptyCodeHash.Add(1)
+	codeHash, err := db.GetOne(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(address[:], incarnation))
+	if err != nil || len(codeHash) == 0 || bytes.Equal(codeHash, emptyCodeHash) {
+		counters.contractCodeMissing.Add(1)
+		return libcommon.Hash{}, nil, false, err
+	}
+	counters.contractCodeFound.Add(1)
+	code, err := db.GetOne(kv.Code, codeHash)
+	if err != nil || !types.IsDelegation(code) {
+		return libcommon.Hash{}, nil, false, err
+	}
+	counters.recovered.Add(1)
+	return libcommon.BytesToHash(codeHash), code, true, nil
+}
+
+// RecoverDelegationCodeHashes recovers the CodeHashes of EIP-7702 delegation
+// accounts read with an empty CodeHash, given the incarnation of each. The
+// lookups are spread over up to workers read transactions of db, as a
+// transaction can't be shared between goroutines. On a temporal db, accounts
+// missing from PlainContractCode are looked up in CodeDomain. Accounts whose
+// code isn't a delegation are left out of the result.
+func RecoverDelegationCodeHashes(ctx context.Context, db kv.RoDB, incarnations map[libcommon.Address]uint64, workers int) (map[libcommon.Address]libcommon.Hash, error) {
+	recovered := make(map[libcommon.Address]libcommon.Hash, len(incarnations))
+	if len(incarnations) == 0 {
+		return recovered, nil
+	}
+	addresses := make([]libcommon.Address, 0, len(incarnations))
+	for address := range incarnations {
+		addresses = append(addresses, address)
+	}
+	workers = max(1, min(workers, len(addresses)))
+	chunk := (len(addresses) + workers - 1) / workers
+
+	var mu sync.Mutex
+	g, ctx := errgroup.WithContext(ctx)
+	for start := 0; start < len(addresses); start += chunk {
+		part := addresses[start:min(start+chunk, len(addresses))]
+		g.Go(func() error {
+			return db.View(ctx, func(tx kv.Tx) error {
+				for _, address := range part {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					codeHash, ok, err := delegationCodeHash(tx, address, incarnations[address])
+					if err != nil {
+						return fmt.Errorf("recovering CodeHash of %x: %w", address, err)
+					}
+					if ok {
+						mu.Lock()
+						recovered[address] = codeHash
+						mu.Unlock()
+					}
+				}
+				return nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return recovered, nil
+}
+
+// delegationCodeHash is plainDelegationCodeHash falling back to the latest
+// CodeDomain value on a temporal tx
+func delegationCodeHash(tx kv.Tx, address libcommon.Address, incarnation uint64) (libcommon.Hash, bool, error) {
+	if codeHash, ok, err := plainDelegationCodeHash(tx, address, incarnation); ok || err != nil {
+		return codeHash, ok, err
+	}
+	ttx, ok := tx.(kv.TemporalTx)
+	if !ok {
+		return libcommon.Hash{}, false, nil
+	}
+	code, ok, err := ttx.DomainGet(kv.CodeDomain, address[:], nil)
+	if err != nil || !ok || !types.IsDelegation(code) {
+		return libcommon.Hash{}, false, err
+	}
+	counters := codeHashRecovery.Load()
+	counters.codeDomainHits.Add(1)
+	counters.recovered.Add(1)
+	return crypto.Keccak256Hash(code), true, nil
+}
+
+// readCodeDomain reads the latest code of address from CodeDomain, returning
+// it only if it matches codeHash
+func readCodeDomain(ttx kv.TemporalTx, address libcommon.Address, codeHash libcommon.Hash) ([]byte, error) {
+	code, ok, err := ttx.DomainGet(kv.CodeDomain, address[:], nil)
+	if err != nil || !ok || len(code) == 0 {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(code) != codeHash {
+		return nil, nil
+	}
+	codeHashRecovery.Load().codeDomainHits.Add(1)
+	return code, nil
+}
@@ -0,0 +1,296 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/dbutils"
+	"github.com/erigontech/erigon-lib/kv/kvcache"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// putCodeHashLost writes an account without a CodeHash and, if code is set,
+// a PlainContractCode entry pointing at it
+func putCodeHashLost(t testing.TB, tx kv.RwTx, address libcommon.Address, code []byte) {
+	t.Helper()
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(1)
+	acc.Incarnation = 1
+	putAccount(t, tx, address, &acc)
+	if code != nil {
+		codeHash := crypto.Keccak256(code)
+		require.NoError(t, tx.Put(kv.Code, codeHash, code))
+		require.NoError(t, tx.Put(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation), codeHash))
+	}
+}
+
+func TestGetDiagnostics(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	delegated := libcommon.HexToAddress("0x01")
+	contract := libcommon.HexToAddress("0x02")
+	eoa := libcommon.HexToAddress("0x03")
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	putCodeHashLost(t, tx, delegated, delegation)
+	putCodeHashLost(t, tx, contract, []byte{0x60, 0x00})
+	putCodeHashLost(t, tx, eoa, nil)
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	r := NewCachedReader2(view, tx)
+
+	before := GetDiagnostics()
+	for _, address := range []libcommon.Address{delegated, contract, eoa, delegated} {
+		_, err := r.ReadAccountData(address)
+		require.NoError(t, err)
+	}
+	after := GetDiagnostics()
+
+	require.Equal(t, Diagnostics{
+		EmptyCodeHash:       4,
+		ContractCodeFound:   3,
+		ContractCodeMissing: 1,
+		Recovered:           2,
+	}, Diagnostics{
+		EmptyCodeHash:       after.EmptyCodeHash - before.EmptyCodeHash,
+		ContractCodeFound:   after.ContractCodeFound - before.ContractCodeFound,
+		ContractCodeMissing: after.ContractCodeMissing - before.ContractCodeMissing,
+		Recovered:           after.Recovered - before.Recovered,
+	})
+
+	acc, err := r.ReadAccountData(delegated)
+	require.NoError(t, err)
+	require.Equal(t, crypto.Keccak256Hash(delegation), acc.CodeHash)
+}
+
+func TestDelegationIncarnationZeroAcrossReaders(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	address := libcommon.HexToAddress("0x01")
+	acc := accounts.NewAccount()
+	acc.Balance = *uint256.NewInt(1)
+	putAccount(t, tx, address, &acc)
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	// the entry of the delegation, and a stale one at the first contract
+	// incarnation that a reader defaulting to it would pick up
+	for incarnation, code := range map[uint64][]byte{
+		0:                        delegation,
+		FirstContractIncarnation: types.AddressToDelegation(libcommon.HexToAddress("0xee")),
+	} {
+		codeHash := crypto.Keccak256(code)
+		require.NoError(t, tx.Put(kv.Code, codeHash, code))
+		require.NoError(t, tx.Put(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(address[:], incarnation), codeHash))
+	}
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	readers := map[string]StateReader{
+		"PlainStateReader": NewPlainStateReader(tx),
+		"CachedReader2":    NewCachedReader2(view, tx),
+		"PlainState":       NewPlainState(tx, 1, nil),
+	}
+	for name, r := range readers {
+		a, err := r.ReadAccountData(address)
+		require.NoError(t, err, name)
+		require.Zero(t, a.Incarnation, name)
+		require.Equal(t, crypto.Keccak256Hash(delegation), a.CodeHash, name)
+
+		withCode, ok := r.(interface {
+			ReadAccountWithCode(libcommon.Address) (*accounts.Account, []byte, error)
+		})
+		if !ok {
+			continue
+		}
+		b, code, err := withCode.ReadAccountWithCode(address)
+		require.NoError(t, err, name)
+		require.Equal(t, a, b, name)
+		require.Equal(t, delegation, code, name)
+	}
+}
+
+func TestResetDiagnostics(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	delegated := libcommon.HexToAddress("0x01")
+	eoa := libcommon.HexToAddress("0x02")
+	putCodeHashLost(t, tx, delegated, types.AddressToDelegation(libcommon.HexToAddress("0xdd")))
+	putCodeHashLost(t, tx, eoa, nil)
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	r := NewCachedReader2(view, tx)
+	for _, address := range []libcommon.Address{delegated, eoa} {
+		_, err := r.ReadAccountData(address)
+		require.NoError(t, err)
+	}
+	require.NotZero(t, GetDiagnostics().EmptyCodeHash)
+	require.NotZero(t, GetDiagnostics().Recovered)
+
+	ResetDiagnostics()
+	require.Equal(t, Diagnostics{}, GetDiagnostics())
+
+	// counting resumes from zero
+	_, err = r.ReadAccountData(delegated)
+	require.NoError(t, err)
+	require.Equal(t, Diagnostics{EmptyCodeHash: 1, ContractCodeFound: 1, Recovered: 1}, GetDiagnostics())
+}
+
+// codeDomainTx is a TemporalTx serving only CodeDomain reads, and table
+// reads from tx if set
+type codeDomainTx struct {
+	kv.TemporalTx
+	tx   kv.Tx
+	code map[libcommon.Address][]byte
+}
+
+func (tx *codeDomainTx) GetOne(table string, key []byte) ([]byte, error) {
+	return tx.tx.GetOne(table, key)
+}
+
+func (tx *codeDomainTx) DomainGet(name kv.Domain, k, k2 []byte) ([]byte, bool, error) {
+	if name != kv.CodeDomain {
+		return nil, false, nil
+	}
+	code, ok := tx.code[libcommon.BytesToAddress(k)]
+	return code, ok, nil
+}
+
+func TestCachedReader2CodeDomainFallback(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+
+	delegated := libcommon.HexToAddress("0x01")
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	codeHash := crypto.Keccak256Hash(delegation)
+	ttx := &codeDomainTx{code: map[libcommon.Address][]byte{delegated: delegation}}
+
+	// without a temporal tx the code is missing from the hash-keyed cache
+	code, err := NewCachedReader2(view, tx).ReadAccountCode(delegated, 0, codeHash)
+	require.NoError(t, err)
+	require.Nil(t, code)
+
+	r := NewCachedReader2(view, ttx)
+	before := GetDiagnostics().CodeDomainHits
+	code, err = r.ReadAccountCode(delegated, 0, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, delegation, code)
+	size, err := r.ReadAccountCodeSize(delegated, 0, codeHash)
+	require.NoError(t, err)
+	require.Equal(t, len(delegation), size)
+	require.Equal(t, before+2, GetDiagnostics().CodeDomainHits)
+
+	// CodeDomain code that doesn't match the requested hash is ignored
+	code, err = r.ReadAccountCode(delegated, 0, libcommon.HexToHash("0x1234"))
+	require.NoError(t, err)
+	require.Nil(t, code)
+}
+
+func TestCachedReader2Close(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	eoa := libcommon.HexToAddress("0x01")
+	putCodeHashLost(t, tx, eoa, nil)
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	r := NewCachedReader2(view, tx)
+
+	_, err = r.ReadAccountData(eoa)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	_, err = r.ReadAccountData(eoa)
+	require.ErrorIs(t, err, ErrReaderClosed)
+	_, err = r.ReadAccountIncarnation(eoa)
+	require.ErrorIs(t, err, ErrReaderClosed)
+}
+
+// codeDomainDB opens codeDomainTx read transactions over the wrapped db
+type codeDomainDB struct {
+	kv.RwDB
+	code map[libcommon.Address][]byte
+}
+
+func (db *codeDomainDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	return db.RwDB.View(ctx, func(tx kv.Tx) error {
+		return f(&codeDomainTx{tx: tx, code: db.code})
+	})
+}
+
+func TestRecoverDelegationCodeHashes(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	incarnations := map[libcommon.Address]uint64{}
+	expected := map[libcommon.Address]libcommon.Hash{}
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := byte(1); i <= 20; i++ {
+			address := libcommon.BytesToAddress([]byte{i})
+			incarnations[address] = 1
+			switch i % 3 {
+			case 0:
+				putCodeHashLost(t, tx, address, delegation)
+				expected[address] = crypto.Keccak256Hash(delegation)
+			case 1:
+				putCodeHashLost(t, tx, address, []byte{0x60, 0x00})
+			default:
+				putCodeHashLost(t, tx, address, nil)
+			}
+		}
+		return nil
+	}))
+
+	for _, workers := range []int{1, 4, 100} {
+		recovered, err := RecoverDelegationCodeHashes(context.Background(), db, incarnations, workers)
+		require.NoError(t, err)
+		require.Equal(t, expected, recovered, "workers %d", workers)
+	}
+
+	// on a temporal db, CodeDomain fills in what PlainContractCode lacks
+	fromDomain := libcommon.HexToAddress("0xf0")
+	incarnations[fromDomain] = 0
+	expected[fromDomain] = crypto.Keccak256Hash(delegation)
+	temporal := &codeDomainDB{RwDB: db, code: map[libcommon.Address][]byte{fromDomain: delegation}}
+	recovered, err := RecoverDelegationCodeHashes(context.Background(), temporal, incarnations, 4)
+	require.NoError(t, err)
+	require.Equal(t, expected, recovered)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RecoverDelegationCodeHashes(ctx, db, incarnations, 4)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func BenchmarkRecoverDelegationCodeHashes(b *testing.B) {
+	db := memdb.NewTestDB(b)
+	const delegated = 100
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	incarnations := make(map[libcommon.Address]uint64, delegated)
+	require.NoError(b, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := 0; i < delegated; i++ {
+			address := libcommon.BytesToAddress([]byte{0xde, byte(i)})
+			putCodeHashLost(b, tx, address, delegation)
+			incarnations[address] = 1
+		}
+		return nil
+	}))
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				recovered, err := RecoverDelegationCodeHashes(context.Background(), db, incarnations, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(recovered) != delegated {
+					b.Fatalf("recovered %d of %d", len(recovered), delegated)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"github.com/holiman/uint256"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/kv"
+	dbutils2 "github.com/erigontech/erigon-lib/kv/dbutils"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+	"github.com/erigontech/erigon/turbo/trie"
+)
+
+var _ WriterWithChangeSets = (*HashedStateWriter)(nil)
+
+// HashedStateWriter writes the plain state like PlainStateWriter and keeps the
+// hashed state in step, so it can compute the state root of what was written
+// to it. Only the trie paths of the written keys are recomputed, the rest
+// comes from the intermediate hashes, as in the IntermediateHashes stage.
+// The hashed state and intermediate hashes of tx must match its plain state
+// when the writer is created.
+type HashedStateWriter struct {
+	*PlainStateWriter
+	hashed  *DbStateWriter
+	tx      kv.RwTx
+	touched [][]byte
+	deleted []bool
+}
+
+func NewHashedStateWriter(tx kv.RwTx, blockNumber uint64) *HashedStateWriter {
+	return &HashedStateWriter{
+		PlainStateWriter: NewPlainStateWriter(tx, tx, blockNumber),
+		hashed:           NewDbStateWriter(tx, blockNumber),
+		tx:               tx,
+	}
+}
+
+func (w *HashedStateWriter) touch(key []byte, deleted bool) {
+	w.touched = append(w.touched, key)
+	w.deleted = append(w.deleted, deleted)
+}
+
+func (w *HashedStateWriter) UpdateAccountData(address libcommon.Address, original, account *accounts.Account) error {
+	if err := w.PlainStateWriter.UpdateAccountData(address, original, account); err != nil {
+		return err
+	}
+	if err := w.hashed.UpdateAccountData(address, original, account); err != nil {
+		return err
+	}
+	addrHash, err := libcommon.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	w.touch(addrHash[:], false)
+	return nil
+}
+
+func (w *HashedStateWriter) UpdateAccountCode(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash, code []byte) error {
+	if err := w.PlainStateWriter.UpdateAccountCode(address, incarnation, codeHash, code); err != nil {
+		return err
+	}
+	return w.hashed.UpdateAccountCode(address, incarnation, codeHash, code)
+}
+
+func (w *HashedStateWriter) DeleteAccount(address libcommon.Address, original *accounts.Account) error {
+	if err := w.PlainStateWriter.DeleteAccount(address, original); err != nil {
+		return err
+	}
+	if err := w.hashed.DeleteAccount(address, original); err != nil {
+		return err
+	}
+	addrHash, err := libcommon.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	w.touch(addrHash[:], true)
+	return nil
+}
+
+func (w *HashedStateWriter) WriteAccountStorage(address libcommon.Address, incarnation uint64, key *libcommon.Hash, original, value *uint256.Int) error {
+	if err := w.PlainStateWriter.WriteAccountStorage(address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	if err := w.hashed.WriteAccountStorage(address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	if *original == *value {
+		return nil
+	}
+	addrHash, err := libcommon.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	seckey, err := libcommon.HashData(key[:])
+	if err != nil {
+		return err
+	}
+	w.touch(dbutils2.GenerateCompositeStorageKey(addrHash, incarnation, seckey), value.IsZero())
+	return nil
+}
+
+// StateRoot computes the state root of the hashed state of tx. The
+// intermediate hashes are read, but not updated.
+func (w *HashedStateWriter) StateRoot() (libcommon.Hash, error) {
+	rl := trie.NewRetainList(0)
+	for i, key := range w.touched {
+		rl.AddKeyWithMarker(key, w.deleted[i])
+	}
+	loader := trie.NewFlatDBTrieLoader("StateRoot", rl, nil, nil, false)
+	return loader.CalcTrieRoot(w.tx, nil)
+}
@@ -54,3 +54,45 @@ func GetAsOf(tx kv.Tx, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool
 	v, err = tx.GetOne(kv.PlainState, key)
 	return v, false, err
 }
+
+// GetAsOfMixed is GetAsOf for databases holding history in both the historyv2
+// tables (Erigon 2) and the temporal domains (Erigon 3). The historyv2 index
+// is consulted first at blockNum, then the accounts or storage domain as of
+// txNum, the first transaction of the block, and PlainState last. Accounts
+// found in the domain are re-encoded in the PlainState storage format, so
+// callers get the same encoding whichever backend served the key.
+func GetAsOfMixed(tx kv.TemporalTx, indexC kv.Cursor, changesC kv.CursorDupSort, storage bool, key []byte, blockNum, txNum uint64) (v []byte, fromHistory bool, err error) {
+	v, ok, err := historyv2.FindByHistory(indexC, changesC, storage, key, blockNum)
+	if err != nil {
+		return nil, true, err
+	}
+	if ok {
+		return v, true, nil
+	}
+	if storage {
+		v, ok, err = tx.DomainGetAsOf(kv.StorageDomain, key[:length.Addr], key[length.Addr+length.Incarnation:], txNum)
+	} else {
+		v, ok, err = tx.DomainGetAsOf(kv.AccountsDomain, key, nil, txNum)
+		if err == nil && ok && len(v) > 0 {
+			v, err = accountV3ToStorage(v)
+		}
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	if ok {
+		return v, true, nil
+	}
+	v, err = tx.GetOne(kv.PlainState, key)
+	return v, false, err
+}
+
+func accountV3ToStorage(enc []byte) ([]byte, error) {
+	var acc accounts.Account
+	if err := accounts.DeserialiseV3(&acc, enc); err != nil {
+		return nil, err
+	}
+	v := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(v)
+	return v, nil
+}
@@ -0,0 +1,123 @@
+package historyv2read
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/common/hexutility"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+	"github.com/erigontech/erigon-lib/kv/temporal/historyv2"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// domainTx serves domain reads from a map and everything else from tx
+type domainTx struct {
+	kv.TemporalTx
+	tx     kv.Tx
+	values map[kv.Domain]map[string][]byte
+	asOf   []uint64
+}
+
+func (d *domainTx) GetOne(table string, key []byte) ([]byte, error) {
+	return d.tx.GetOne(table, key)
+}
+
+func (d *domainTx) DomainGetAsOf(name kv.Domain, k, k2 []byte, ts uint64) ([]byte, bool, error) {
+	d.asOf = append(d.asOf, ts)
+	v, ok := d.values[name][string(append(libcommon.Copy(k), k2...))]
+	return v, ok, nil
+}
+
+// putLegacyAccount records enc as the value of address before block in the
+// historyv2 account changeset and index
+func putLegacyAccount(t *testing.T, tx kv.RwTx, address libcommon.Address, block uint64, enc []byte) {
+	t.Helper()
+	var index bytes.Buffer
+	_, err := roaring64.BitmapOf(block).WriteTo(&index)
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(kv.E2AccountsHistory, historyv2.AccountIndexChunkKey(address[:], ^uint64(0)), index.Bytes()))
+	require.NoError(t, tx.Put(kv.AccountChangeSet, hexutility.EncodeTs(block), append(libcommon.Copy(address[:]), enc...)))
+}
+
+func storageEncoded(acc *accounts.Account) []byte {
+	enc := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(enc)
+	return enc
+}
+
+func TestGetAsOfMixed(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	legacy := libcommon.HexToAddress("0x01")
+	temporal := libcommon.HexToAddress("0x02")
+	plain := libcommon.HexToAddress("0x03")
+	location := libcommon.HexToHash("0x0a")
+
+	legacyAcc := accounts.NewAccount()
+	legacyAcc.Nonce = 1
+	putLegacyAccount(t, tx, legacy, 5, storageEncoded(&legacyAcc))
+
+	temporalAcc := accounts.NewAccount()
+	temporalAcc.Nonce = 7
+	temporalAcc.Incarnation = 1
+	ttx := &domainTx{tx: tx, values: map[kv.Domain]map[string][]byte{
+		kv.AccountsDomain: {string(temporal[:]): accounts.SerialiseV3(&temporalAcc)},
+		kv.StorageDomain:  {string(temporal[:]) + string(location[:]): {0x2a}},
+	}}
+
+	plainAcc := accounts.NewAccount()
+	plainAcc.Nonce = 3
+	require.NoError(t, tx.Put(kv.PlainState, plain[:], storageEncoded(&plainAcc)))
+
+	accIndexC, err := tx.Cursor(kv.E2AccountsHistory)
+	require.NoError(t, err)
+	defer accIndexC.Close()
+	accChangesC, err := tx.CursorDupSort(kv.AccountChangeSet)
+	require.NoError(t, err)
+	defer accChangesC.Close()
+	storageIndexC, err := tx.Cursor(kv.E2StorageHistory)
+	require.NoError(t, err)
+	defer storageIndexC.Close()
+	storageChangesC, err := tx.CursorDupSort(kv.StorageChangeSet)
+	require.NoError(t, err)
+	defer storageChangesC.Close()
+
+	readAccount := func(address libcommon.Address) (accounts.Account, bool) {
+		t.Helper()
+		v, fromHistory, err := GetAsOfMixed(ttx, accIndexC, accChangesC, false, address[:], 3, 100)
+		require.NoError(t, err)
+		var acc accounts.Account
+		require.NoError(t, acc.DecodeForStorage(v))
+		return acc, fromHistory
+	}
+
+	// present only in legacy history: the domain isn't consulted
+	acc, fromHistory := readAccount(legacy)
+	require.True(t, fromHistory)
+	require.Equal(t, uint64(1), acc.Nonce)
+	require.Empty(t, ttx.asOf)
+
+	// present only in the temporal domain, re-encoded for storage
+	acc, fromHistory = readAccount(temporal)
+	require.True(t, fromHistory)
+	require.Equal(t, uint64(7), acc.Nonce)
+	require.Equal(t, uint64(1), acc.Incarnation)
+	require.Equal(t, []uint64{100}, ttx.asOf)
+
+	// in neither history: the current plain state
+	acc, fromHistory = readAccount(plain)
+	require.False(t, fromHistory)
+	require.Equal(t, uint64(3), acc.Nonce)
+
+	// storage keys carry an incarnation the domain doesn't use
+	key := append(append(libcommon.Copy(temporal[:]), hexutility.EncodeTs(1)...), location[:]...)
+	v, fromHistory, err := GetAsOfMixed(ttx, storageIndexC, storageChangesC, true, key, 3, 100)
+	require.NoError(t, err)
+	require.True(t, fromHistory)
+	require.Equal(t, []byte{0x2a}, v)
+}
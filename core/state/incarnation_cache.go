@@ -0,0 +1,58 @@
+package state
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+)
+
+// incarnationCache is a bounded memo of kv.IncarnationMap lookups, used by the
+// plain state readers so that repeated storage accesses of the same contract
+// within a block do not hit the database every time.
+// A nil *incarnationCache is valid and caches nothing.
+type incarnationCache struct {
+	entries map[libcommon.Address]uint64
+	limit   int
+}
+
+func newIncarnationCache(limit int) *incarnationCache {
+	if limit <= 0 {
+		return nil
+	}
+	return &incarnationCache{
+		entries: make(map[libcommon.Address]uint64, limit),
+		limit:   limit,
+	}
+}
+
+func (c *incarnationCache) get(address libcommon.Address) (uint64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	incarnation, ok := c.entries[address]
+	return incarnation, ok
+}
+
+func (c *incarnationCache) put(address libcommon.Address, incarnation uint64) {
+	if c == nil {
+		return
+	}
+	if len(c.entries) >= c.limit {
+		// Once full, start over rather than tracking recency: within a block the
+		// hot contracts get re-added on their next access.
+		clear(c.entries)
+	}
+	c.entries[address] = incarnation
+}
+
+func (c *incarnationCache) remove(address libcommon.Address) {
+	if c == nil {
+		return
+	}
+	delete(c.entries, address)
+}
+
+func (c *incarnationCache) reset() {
+	if c == nil {
+		return
+	}
+	clear(c.entries)
+}
@@ -81,6 +81,9 @@ type IntraBlockState struct {
 	// Per-transaction access list
 	accessList *accessList
 
+	// Accounts and slots touched since RecordAccesses, nil unless recording
+	touched *accessList
+
 	// Transient storage
 	transientStorage transientStorage
 
@@ -108,6 +111,14 @@ func New(stateReader StateReader) *IntraBlockState {
 	}
 }
 
+// SetStateReader points the state at another reader, dropping any error saved
+// from the previous one. Together with Reset it allows reusing an
+// IntraBlockState, and its allocations, across blocks.
+func (sdb *IntraBlockState) SetStateReader(stateReader StateReader) {
+	sdb.stateReader = stateReader
+	sdb.savedErr = nil
+}
+
 func (sdb *IntraBlockState) SetTrace(trace bool) {
 	sdb.trace = trace
 }
@@ -132,15 +143,39 @@ func (sdb *IntraBlockState) Reset() {
 	//		"len(sdb.stateObjectsDirty)", len(sdb.stateObjectsDirty),
 	//		"len(sdb.balanceInc)", len(sdb.balanceInc))
 	//}
-	sdb.nilAccounts = make(map[libcommon.Address]struct{})
-	sdb.stateObjects = make(map[libcommon.Address]*stateObject)
-	sdb.stateObjectsDirty = make(map[libcommon.Address]struct{})
-	sdb.logs = make(map[libcommon.Hash][]*types.Log)
-	sdb.balanceInc = make(map[libcommon.Address]*BalanceIncrease)
+	clear(sdb.nilAccounts)
+	clear(sdb.stateObjects)
+	clear(sdb.stateObjectsDirty)
+	clear(sdb.logs)
+	clear(sdb.balanceInc)
 	sdb.thash = libcommon.Hash{}
 	sdb.bhash = libcommon.Hash{}
 	sdb.txIndex = 0
 	sdb.logSize = 0
+	sdb.touched = nil
+}
+
+// RecordAccesses starts recording the accounts and storage slots read or
+// written through sdb, discarding anything recorded before
+func (sdb *IntraBlockState) RecordAccesses() {
+	sdb.touched = newAccessList()
+}
+
+// TakeAccesses stops recording and returns the accounts and storage slots
+// touched since RecordAccesses as an access list, or nil if not recording
+func (sdb *IntraBlockState) TakeAccesses() types2.AccessList {
+	if sdb.touched == nil {
+		return nil
+	}
+	list := sdb.touched.toAccessList()
+	sdb.touched = nil
+	return list
+}
+
+func (sdb *IntraBlockState) recordSlot(addr libcommon.Address, key *libcommon.Hash) {
+	if sdb.touched != nil {
+		sdb.touched.AddSlot(addr, *key)
+	}
 }
 
 func (sdb *IntraBlockState) AddLog(log2 *types.Log) {
@@ -290,6 +325,7 @@ func (sdb *IntraBlockState) GetDelegatedDesignation(addr libcommon.Address) (lib
 // GetState retrieves a value from the given account's storage trie.
 // DESCRIBED: docs/programmers_guide/guide.md#address---identifier-of-an-account
 func (sdb *IntraBlockState) GetState(addr libcommon.Address, key *libcommon.Hash, value *uint256.Int) {
+	sdb.recordSlot(addr, key)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil && !stateObject.deleted {
 		stateObject.GetState(key, value)
@@ -301,6 +337,7 @@ func (sdb *IntraBlockState) GetState(addr libcommon.Address, key *libcommon.Hash
 // GetCommittedState retrieves a value from the given account's committed storage trie.
 // DESCRIBED: docs/programmers_guide/guide.md#address---identifier-of-an-account
 func (sdb *IntraBlockState) GetCommittedState(addr libcommon.Address, key *libcommon.Hash, value *uint256.Int) {
+	sdb.recordSlot(addr, key)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil && !stateObject.deleted {
 		stateObject.GetCommittedState(key, value)
@@ -397,6 +434,7 @@ func (sdb *IntraBlockState) SetCode(addr libcommon.Address, code []byte) {
 
 // DESCRIBED: docs/programmers_guide/guide.md#address---identifier-of-an-account
 func (sdb *IntraBlockState) SetState(addr libcommon.Address, key *libcommon.Hash, value uint256.Int) {
+	sdb.recordSlot(addr, key)
 	stateObject := sdb.GetOrNewStateObject(addr)
 	if stateObject != nil {
 		stateObject.SetState(key, value)
@@ -492,6 +530,9 @@ func (sdb *IntraBlockState) GetTransientState(addr libcommon.Address, key libcom
 }
 
 func (sdb *IntraBlockState) getStateObject(addr libcommon.Address) (stateObject *stateObject) {
+	if sdb.touched != nil {
+		sdb.touched.AddAddress(addr)
+	}
 	// Prefer 'live' objects.
 	if obj := sdb.stateObjects[addr]; obj != nil {
 		return obj
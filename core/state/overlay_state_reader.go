@@ -0,0 +1,99 @@
+package state
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+var _ StateReader = (*OverlayStateReader)(nil)
+
+// OverlayStateReader serves reads from an in-memory set of account and storage
+// overrides and delegates everything else to the wrapped StateReader.
+// It is meant for "what-if" simulations: nothing is ever written to the database.
+type OverlayStateReader struct {
+	base     StateReader
+	accounts map[libcommon.Address]*accounts.Account // nil value marks a deleted account
+	storage  map[libcommon.Address]map[libcommon.Hash][]byte
+}
+
+func NewOverlayStateReader(base StateReader) *OverlayStateReader {
+	return &OverlayStateReader{
+		base:     base,
+		accounts: map[libcommon.Address]*accounts.Account{},
+		storage:  map[libcommon.Address]map[libcommon.Hash][]byte{},
+	}
+}
+
+// SetAccount overrides the account at address. A nil account marks it as deleted,
+// which also hides all of its storage in the base reader.
+func (r *OverlayStateReader) SetAccount(address libcommon.Address, account *accounts.Account) {
+	if account != nil {
+		acc := *account
+		account = &acc
+	}
+	r.accounts[address] = account
+}
+
+// DeleteAccount marks the account at address as non-existent
+func (r *OverlayStateReader) DeleteAccount(address libcommon.Address) {
+	r.SetAccount(address, nil)
+}
+
+// SetStorage overrides a single storage slot of address. An empty value reads as unset.
+func (r *OverlayStateReader) SetStorage(address libcommon.Address, key libcommon.Hash, value []byte) {
+	slots, ok := r.storage[address]
+	if !ok {
+		slots = map[libcommon.Hash][]byte{}
+		r.storage[address] = slots
+	}
+	slots[key] = libcommon.CopyBytes(value)
+}
+
+func (r *OverlayStateReader) ReadAccountData(address libcommon.Address) (*accounts.Account, error) {
+	if account, ok := r.accounts[address]; ok {
+		if account == nil {
+			return nil, nil
+		}
+		acc := *account
+		return &acc, nil
+	}
+	return r.base.ReadAccountData(address)
+}
+
+func (r *OverlayStateReader) ReadAccountStorage(address libcommon.Address, incarnation uint64, key *libcommon.Hash) ([]byte, error) {
+	if slots, ok := r.storage[address]; ok {
+		if value, ok := slots[*key]; ok {
+			if len(value) == 0 {
+				return nil, nil
+			}
+			return value, nil
+		}
+	}
+	if account, ok := r.accounts[address]; ok && account == nil {
+		return nil, nil
+	}
+	return r.base.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *OverlayStateReader) ReadAccountCode(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash) ([]byte, error) {
+	if account, ok := r.accounts[address]; ok && account == nil {
+		return nil, nil
+	}
+	return r.base.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (r *OverlayStateReader) ReadAccountCodeSize(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+func (r *OverlayStateReader) ReadAccountIncarnation(address libcommon.Address) (uint64, error) {
+	if account, ok := r.accounts[address]; ok {
+		if account == nil {
+			return 0, nil
+		}
+		return account.Incarnation, nil
+	}
+	return r.base.ReadAccountIncarnation(address)
+}
@@ -0,0 +1,94 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// recordingReader is a StateReader backed by maps that records which keys were requested
+type recordingReader struct {
+	accounts     map[libcommon.Address]*accounts.Account
+	storage      map[libcommon.Hash][]byte
+	accountReads []libcommon.Address
+	storageReads []libcommon.Hash
+}
+
+func (r *recordingReader) ReadAccountData(address libcommon.Address) (*accounts.Account, error) {
+	r.accountReads = append(r.accountReads, address)
+	return r.accounts[address], nil
+}
+
+func (r *recordingReader) ReadAccountStorage(address libcommon.Address, incarnation uint64, key *libcommon.Hash) ([]byte, error) {
+	r.storageReads = append(r.storageReads, *key)
+	return r.storage[*key], nil
+}
+
+func (r *recordingReader) ReadAccountCode(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func (r *recordingReader) ReadAccountCodeSize(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash) (int, error) {
+	return 0, nil
+}
+
+func (r *recordingReader) ReadAccountIncarnation(address libcommon.Address) (uint64, error) {
+	return 0, nil
+}
+
+func TestOverlayStateReader(t *testing.T) {
+	overridden := libcommon.HexToAddress("0x01")
+	untouched := libcommon.HexToAddress("0x02")
+	deleted := libcommon.HexToAddress("0x03")
+	slotOverridden := libcommon.HexToHash("0x10")
+	slotUntouched := libcommon.HexToHash("0x11")
+
+	base := &recordingReader{
+		accounts: map[libcommon.Address]*accounts.Account{
+			overridden: {Balance: *uint256.NewInt(1)},
+			untouched:  {Balance: *uint256.NewInt(2)},
+			deleted:    {Balance: *uint256.NewInt(3)},
+		},
+		storage: map[libcommon.Hash][]byte{
+			slotOverridden: {0x01},
+			slotUntouched:  {0x02},
+		},
+	}
+
+	r := NewOverlayStateReader(base)
+	r.SetAccount(overridden, &accounts.Account{Balance: *uint256.NewInt(100)})
+	r.SetStorage(overridden, slotOverridden, []byte{0xff})
+	r.DeleteAccount(deleted)
+
+	acc, err := r.ReadAccountData(overridden)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), acc.Balance.Uint64())
+
+	acc, err = r.ReadAccountData(untouched)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), acc.Balance.Uint64())
+
+	acc, err = r.ReadAccountData(deleted)
+	require.NoError(t, err)
+	require.Nil(t, acc)
+
+	v, err := r.ReadAccountStorage(overridden, 0, &slotOverridden)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff}, v)
+
+	v, err = r.ReadAccountStorage(overridden, 0, &slotUntouched)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x02}, v)
+
+	v, err = r.ReadAccountStorage(deleted, 0, &slotUntouched)
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.Equal(t, []libcommon.Address{untouched}, base.accountReads)
+	require.Equal(t, []libcommon.Hash{slotUntouched}, base.storageReads)
+}
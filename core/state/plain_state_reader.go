@@ -3,6 +3,8 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/erigontech/erigon-lib/kv/dbutils"
 
@@ -21,7 +23,26 @@ var _ StateReader = (*PlainStateReader)(nil)
 // Data in the plain state is stored using un-hashed account/storage items
 // as opposed to the "normal" state that uses hashes of merkle paths to store items.
 type PlainStateReader struct {
-	db kv.Getter
+	db           kv.Getter
+	incarnations *incarnationCache
+	diag         *readerDiagnostics
+
+	// storageCursor is opened by the first storage scan if db can open
+	// cursors, and reused until Close
+	storageCursor kv.Cursor
+	closed        bool
+}
+
+// ErrReaderClosed is returned by the reads of a state reader after its Close
+var ErrReaderClosed = errors.New("state reader is closed")
+
+// ErrMalformedIncarnation is returned by the state readers for a
+// kv.IncarnationMap entry that isn't an 8-byte big-endian incarnation
+var ErrMalformedIncarnation = errors.New("malformed incarnation entry")
+
+// cursorOpener is implemented by the transactions a reader may be given
+type cursorOpener interface {
+	Cursor(table string) (kv.Cursor, error)
 }
 
 func NewPlainStateReader(db kv.Getter) *PlainStateReader {
@@ -30,22 +51,93 @@ func NewPlainStateReader(db kv.Getter) *PlainStateReader {
 	}
 }
 
+// SetIncarnationCacheSize enables a bounded per-reader cache of kv.IncarnationMap
+// lookups holding up to size addresses. Zero disables caching (the default).
+// Callers reusing the reader across blocks must call Reset between blocks.
+func (r *PlainStateReader) SetIncarnationCacheSize(size int) {
+	r.incarnations = newIncarnationCache(size)
+}
+
+// Reset drops all per-reader cached data
+func (r *PlainStateReader) Reset() {
+	r.incarnations.reset()
+}
+
+// Close releases the cursors held by the reader. Reads after Close fail with
+// ErrReaderClosed; the underlying transaction is left open.
+func (r *PlainStateReader) Close() error {
+	if r.storageCursor != nil {
+		r.storageCursor.Close()
+		r.storageCursor = nil
+	}
+	r.closed = true
+	return nil
+}
+
+// EnableDiagnostics turns on collection of decoded-account diagnostics, keeping
+// at most sampleLimit raw account encodings. Diagnostics are off by default and
+// cost nothing on the decode path while disabled.
+func (r *PlainStateReader) EnableDiagnostics(sampleLimit int) {
+	r.diag = &readerDiagnostics{sampleLimit: sampleLimit}
+}
+
+// DisableDiagnostics turns off diagnostics and drops everything collected so far
+func (r *PlainStateReader) DisableDiagnostics() {
+	r.diag = nil
+}
+
+// Diagnostics returns a snapshot of the collected diagnostics
+func (r *PlainStateReader) Diagnostics() ReaderDiagnostics {
+	return r.diag.snapshot()
+}
+
 func (r *PlainStateReader) ReadAccountData(address libcommon.Address) (*accounts.Account, error) {
+	a, _, err := r.readAccount(address)
+	return a, err
+}
+
+// ReadAccountWithCode reads an account together with its code, which is nil
+// for accounts without code. The code read to recover the CodeHash of a
+// delegation is reused. It returns a nil account for a missing one.
+func (r *PlainStateReader) ReadAccountWithCode(address libcommon.Address) (*accounts.Account, []byte, error) {
+	a, code, err := r.readAccount(address)
+	if err != nil || a == nil || code != nil {
+		return a, code, err
+	}
+	if code, err = r.ReadAccountCode(address, a.Incarnation, a.CodeHash); err != nil {
+		return nil, nil, err
+	}
+	return a, code, nil
+}
+
+// readAccount reads an account, also returning the delegation code if its
+// CodeHash had to be recovered
+func (r *PlainStateReader) readAccount(address libcommon.Address) (*accounts.Account, []byte, error) {
+	if r.closed {
+		return nil, nil, ErrReaderClosed
+	}
 	enc, err := r.db.GetOne(kv.PlainState, address.Bytes())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(enc) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	var a accounts.Account
 	if err = a.DecodeForStorage(enc); err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("account %x: %w", address, err)
 	}
-	return &a, nil
+	if r.diag != nil {
+		r.diag.recordAccount(address, enc, &a)
+	}
+	code := recoverDelegationCode(r.db, address, &a)
+	return &a, code, nil
 }
 
 func (r *PlainStateReader) ReadAccountStorage(address libcommon.Address, incarnation uint64, key *libcommon.Hash) ([]byte, error) {
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
 	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, key.Bytes())
 	enc, err := r.db.GetOne(kv.PlainState, compositeKey)
 	if err != nil {
@@ -57,7 +149,101 @@ func (r *PlainStateReader) ReadAccountStorage(address libcommon.Address, incarna
 	return enc, nil
 }
 
+// storageScanThreshold is the number of keys from which
+// ReadAccountStoragePrefix scans the storage of the contract with one cursor
+// instead of looking the keys up one by one
+const storageScanThreshold = 32
+
+var errStopStorageScan = errors.New("stop storage scan")
+
+// ReadAccountStoragePrefix reads the given storage slots of one contract
+// incarnation. Slots that aren't set are left out of the result. Large key
+// sets are served by a single ordered scan over the contract's storage, which
+// is much cheaper than point lookups when the accessed slots are dense.
+func (r *PlainStateReader) ReadAccountStoragePrefix(address libcommon.Address, incarnation uint64, keys []libcommon.Hash) (map[libcommon.Hash][]byte, error) {
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
+	result := make(map[libcommon.Hash][]byte, len(keys))
+	if len(keys) < storageScanThreshold {
+		for i := range keys {
+			enc, err := r.ReadAccountStorage(address, incarnation, &keys[i])
+			if err != nil {
+				return nil, err
+			}
+			if enc != nil {
+				result[keys[i]] = libcommon.Copy(enc)
+			}
+		}
+		return result, nil
+	}
+
+	wanted := make(map[libcommon.Hash]struct{}, len(keys))
+	first, last := keys[0], keys[0]
+	for _, key := range keys {
+		wanted[key] = struct{}{}
+		if bytes.Compare(key[:], first[:]) < 0 {
+			first = key
+		}
+		if bytes.Compare(key[:], last[:]) > 0 {
+			last = key
+		}
+	}
+	prefix := dbutils.PlainGenerateStoragePrefix(address[:], incarnation)
+	start := dbutils.PlainGenerateCompositeStorageKey(address[:], incarnation, first[:])
+	end := dbutils.PlainGenerateCompositeStorageKey(address[:], incarnation, last[:])
+	err := r.scanStorage(start, func(k, v []byte) bool {
+		if !bytes.HasPrefix(k, prefix) || bytes.Compare(k, end) > 0 {
+			return false
+		}
+		key := libcommon.BytesToHash(k[len(prefix):])
+		if _, ok := wanted[key]; ok && len(v) > 0 {
+			result[key] = libcommon.Copy(v)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scanStorage walks kv.PlainState in key order from start for as long as
+// visit returns true, using the reader's reusable cursor when db can open one
+func (r *PlainStateReader) scanStorage(start []byte, visit func(k, v []byte) bool) error {
+	opener, ok := r.db.(cursorOpener)
+	if !ok {
+		err := r.db.ForEach(kv.PlainState, start, func(k, v []byte) error {
+			if !visit(k, v) {
+				return errStopStorageScan
+			}
+			return nil
+		})
+		if errors.Is(err, errStopStorageScan) {
+			return nil
+		}
+		return err
+	}
+	if r.storageCursor == nil {
+		c, err := opener.Cursor(kv.PlainState)
+		if err != nil {
+			return err
+		}
+		r.storageCursor = c
+	}
+	k, v, err := r.storageCursor.Seek(start)
+	for ; k != nil && err == nil; k, v, err = r.storageCursor.Next() {
+		if !visit(k, v) {
+			break
+		}
+	}
+	return err
+}
+
 func (r *PlainStateReader) ReadAccountCode(address libcommon.Address, incarnation uint64, codeHash libcommon.Hash) ([]byte, error) {
+	if r.closed {
+		return nil, ErrReaderClosed
+	}
 	if bytes.Equal(codeHash.Bytes(), emptyCodeHash) {
 		return nil, nil
 	}
@@ -74,12 +260,32 @@ func (r *PlainStateReader) ReadAccountCodeSize(address libcommon.Address, incarn
 }
 
 func (r *PlainStateReader) ReadAccountIncarnation(address libcommon.Address) (uint64, error) {
+	if r.closed {
+		return 0, ErrReaderClosed
+	}
+	if incarnation, ok := r.incarnations.get(address); ok {
+		return incarnation, nil
+	}
 	b, err := r.db.GetOne(kv.IncarnationMap, address.Bytes())
 	if err != nil {
 		return 0, err
 	}
+	incarnation, err := decodeIncarnation(address, b)
+	if err != nil {
+		return 0, err
+	}
+	r.incarnations.put(address, incarnation)
+	return incarnation, nil
+}
+
+// decodeIncarnation decodes the kv.IncarnationMap entry of address. A missing
+// entry, which GetOne doesn't tell apart from an empty one, is incarnation 0.
+func decodeIncarnation(address libcommon.Address, b []byte) (uint64, error) {
 	if len(b) == 0 {
 		return 0, nil
 	}
+	if len(b) != 8 {
+		return 0, fmt.Errorf("%w for %x: %d bytes", ErrMalformedIncarnation, address, len(b))
+	}
 	return binary.BigEndian.Uint64(b), nil
 }
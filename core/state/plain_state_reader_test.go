@@ -0,0 +1,393 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/crypto"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/kv/dbutils"
+	"github.com/erigontech/erigon-lib/kv/kvcache"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+
+	"github.com/erigontech/erigon/core/types"
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// putAccount writes the storage encoding of acc into kv.PlainState
+func putAccount(t testing.TB, tx kv.RwTx, address libcommon.Address, acc *accounts.Account) {
+	t.Helper()
+	enc := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(enc)
+	require.NoError(t, tx.Put(kv.PlainState, address[:], enc))
+}
+
+// countingGetter counts GetOne calls per table
+type countingGetter struct {
+	kv.Getter
+	reads map[string]int
+}
+
+func newCountingGetter(db kv.Getter) *countingGetter {
+	return &countingGetter{Getter: db, reads: map[string]int{}}
+}
+
+func (g *countingGetter) GetOne(table string, key []byte) ([]byte, error) {
+	g.reads[table]++
+	return g.Getter.GetOne(table, key)
+}
+
+func BenchmarkPlainStateReaderIncarnation(b *testing.B) {
+	const touchesPerBlock = 100
+
+	_, tx := memdb.NewTestTx(b)
+	contract := libcommon.HexToAddress("0x1000")
+	var inc [8]byte
+	binary.BigEndian.PutUint64(inc[:], 2)
+	if err := tx.Put(kv.IncarnationMap, contract[:], inc[:]); err != nil {
+		b.Fatal(err)
+	}
+	slot := libcommon.HexToHash("0x01")
+	if err := tx.Put(kv.PlainState, dbutils.PlainGenerateCompositeStorageKey(contract[:], 2, slot[:]), []byte{0x2a}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, cacheSize := range []int{0, 1024} {
+		name := "uncached"
+		if cacheSize > 0 {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			getter := newCountingGetter(tx)
+			r := NewPlainStateReader(getter)
+			r.SetIncarnationCacheSize(cacheSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Reset()
+				for j := 0; j < touchesPerBlock; j++ {
+					incarnation, err := r.ReadAccountIncarnation(contract)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := r.ReadAccountStorage(contract, incarnation, &slot); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(getter.reads[kv.IncarnationMap])/float64(b.N), "incarnation-reads/block")
+		})
+	}
+}
+
+func TestPlainStateReaderDiagnostics(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	for i := byte(1); i <= 4; i++ {
+		acc := accounts.NewAccount()
+		acc.Balance = *uint256.NewInt(uint64(i))
+		putAccount(t, tx, libcommon.Address{i}, &acc)
+	}
+
+	r := NewPlainStateReader(tx)
+	_, err := r.ReadAccountData(libcommon.Address{1})
+	require.NoError(t, err)
+	require.Zero(t, r.Diagnostics().AccountsDecoded)
+
+	r.EnableDiagnostics(2)
+	for i := byte(1); i <= 4; i++ {
+		_, err := r.ReadAccountData(libcommon.Address{i})
+		require.NoError(t, err)
+	}
+	diag := r.Diagnostics()
+	require.Equal(t, uint64(4), diag.AccountsDecoded)
+	require.Len(t, diag.Samples, 2)
+	require.Equal(t, libcommon.Address{1}, diag.Samples[0].Address)
+	require.Equal(t, libcommon.Address{2}, diag.Samples[1].Address)
+}
+
+// putContract writes a contract account and its code
+func putContract(t testing.TB, tx kv.RwTx, address libcommon.Address, code []byte) {
+	t.Helper()
+	acc := accounts.NewAccount()
+	acc.Incarnation = 1
+	acc.CodeHash = crypto.Keccak256Hash(code)
+	putAccount(t, tx, address, &acc)
+	require.NoError(t, tx.Put(kv.Code, acc.CodeHash[:], code))
+	require.NoError(t, tx.Put(kv.PlainContractCode, dbutils.PlainGenerateStoragePrefix(address[:], 1), acc.CodeHash[:]))
+}
+
+// TestReadAccountDataV3Lookalike reads a v2 account whose encoding also parses
+// as v3: PlainState only holds v2, so both readers decode it as such
+func TestReadAccountDataV3Lookalike(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	address := libcommon.HexToAddress("0x01")
+	acc := accounts.NewAccount()
+	acc.Nonce = 5
+	acc.Balance = *uint256.NewInt(16777216)
+	putAccount(t, tx, address, &acc)
+	enc, err := tx.GetOne(kv.PlainState, address[:])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x03, 0x01, 0x05, 0x04, 0x01, 0x00, 0x00, 0x00}, enc)
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	for name, r := range map[string]StateReader{
+		"PlainStateReader": NewPlainStateReader(tx),
+		"CachedReader2":    NewCachedReader2(view, tx),
+	} {
+		a, err := r.ReadAccountData(address)
+		require.NoError(t, err, name)
+		require.Equal(t, uint64(5), a.Nonce, name)
+		require.Equal(t, uint64(16777216), a.Balance.Uint64(), name)
+	}
+}
+
+func TestReadAccountWithCode(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	contract, delegated, eoa := libcommon.HexToAddress("0x01"), libcommon.HexToAddress("0x02"), libcommon.HexToAddress("0x03")
+	contractCode := []byte{0x60, 0x00}
+	delegation := types.AddressToDelegation(libcommon.HexToAddress("0xdd"))
+	putContract(t, tx, contract, contractCode)
+	putCodeHashLost(t, tx, delegated, delegation)
+	acc := accounts.NewAccount()
+	putAccount(t, tx, eoa, &acc)
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	for name, r := range map[string]interface {
+		StateReader
+		ReadAccountWithCode(libcommon.Address) (*accounts.Account, []byte, error)
+	}{
+		"plain":   NewPlainStateReader(tx),
+		"cached2": NewCachedReader2(view, tx),
+	} {
+		// both reads return the same account
+		for _, address := range []libcommon.Address{contract, delegated, eoa} {
+			a, err := r.ReadAccountData(address)
+			require.NoError(t, err, name)
+			b, _, err := r.ReadAccountWithCode(address)
+			require.NoError(t, err, name)
+			require.Equal(t, a, b, name)
+		}
+
+		a, code, err := r.ReadAccountWithCode(contract)
+		require.NoError(t, err)
+		require.Equal(t, crypto.Keccak256Hash(contractCode), a.CodeHash, name)
+		require.Equal(t, contractCode, code, name)
+
+		a, code, err = r.ReadAccountWithCode(delegated)
+		require.NoError(t, err)
+		require.Equal(t, crypto.Keccak256Hash(delegation), a.CodeHash, name)
+		require.Equal(t, delegation, code, name)
+
+		a, code, err = r.ReadAccountWithCode(eoa)
+		require.NoError(t, err)
+		require.NotNil(t, a, name)
+		require.Nil(t, code, name)
+
+		a, code, err = r.ReadAccountWithCode(libcommon.HexToAddress("0x04"))
+		require.NoError(t, err)
+		require.Nil(t, a, name)
+		require.Nil(t, code, name)
+	}
+}
+
+func BenchmarkReadAccountWithCode(b *testing.B) {
+	const contracts = 100
+	_, tx := memdb.NewTestTx(b)
+	// half contracts, half delegations whose CodeHash was lost, so that both
+	// ways of reading recover the same CodeHashes
+	addresses := make([]libcommon.Address, contracts)
+	for i := range addresses {
+		addresses[i] = libcommon.BytesToAddress([]byte{0xc0, byte(i)})
+		if i%2 == 0 {
+			putContract(b, tx, addresses[i], []byte{0x60, byte(i)})
+		} else {
+			putCodeHashLost(b, tx, addresses[i], types.AddressToDelegation(libcommon.BytesToAddress([]byte{0xdd, byte(i)})))
+		}
+	}
+	getter := newCountingGetter(tx)
+	r := NewPlainStateReader(getter)
+
+	reads := func(b *testing.B) {
+		total := 0
+		for _, n := range getter.reads {
+			total += n
+		}
+		clear(getter.reads)
+		b.ReportMetric(float64(total)/float64(b.N*contracts), "reads/account")
+	}
+	b.Run("separate", func(b *testing.B) {
+		clear(getter.reads)
+		for i := 0; i < b.N; i++ {
+			for _, address := range addresses {
+				a, err := r.ReadAccountData(address)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := r.ReadAccountCode(address, a.Incarnation, a.CodeHash); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		reads(b)
+	})
+	b.Run("combined", func(b *testing.B) {
+		clear(getter.reads)
+		for i := 0; i < b.N; i++ {
+			for _, address := range addresses {
+				if _, _, err := r.ReadAccountWithCode(address); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		reads(b)
+	})
+}
+
+// putStorage writes count consecutive storage slots of contract, valued by index
+func putStorage(t testing.TB, tx kv.RwTx, contract libcommon.Address, incarnation uint64, count int) []libcommon.Hash {
+	t.Helper()
+	keys := make([]libcommon.Hash, count)
+	for i := range keys {
+		keys[i] = libcommon.BigToHash(big.NewInt(int64(i + 1)))
+		require.NoError(t, tx.Put(kv.PlainState, dbutils.PlainGenerateCompositeStorageKey(contract[:], incarnation, keys[i][:]), uint256.NewInt(uint64(i+1)).Bytes()))
+	}
+	return keys
+}
+
+func TestPlainStateReaderReadAccountStoragePrefix(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	contract := libcommon.HexToAddress("0x1000")
+	keys := putStorage(t, tx, contract, 1, 100)
+	// neighbouring incarnation and contract must not leak into the result
+	putStorage(t, tx, contract, 2, 100)
+	putStorage(t, tx, libcommon.HexToAddress("0x1001"), 1, 100)
+	r := NewPlainStateReader(tx)
+
+	for _, n := range []int{1, storageScanThreshold - 1, storageScanThreshold, 100} {
+		// every other requested key, plus one that isn't set
+		requested := []libcommon.Hash{libcommon.HexToHash("0xdead")}
+		for i := 0; i < n; i++ {
+			requested = append(requested, keys[(i*2)%len(keys)])
+		}
+		values, err := r.ReadAccountStoragePrefix(contract, 1, requested)
+		require.NoError(t, err)
+		require.NotContains(t, values, libcommon.HexToHash("0xdead"))
+		for _, key := range requested[1:] {
+			expected, err := r.ReadAccountStorage(contract, 1, &key)
+			require.NoError(t, err)
+			require.Equal(t, expected, values[key], "n=%d key %x", n, key)
+		}
+	}
+}
+
+func BenchmarkPlainStateReaderReadAccountStoragePrefix(b *testing.B) {
+	_, tx := memdb.NewTestTx(b)
+	contract := libcommon.HexToAddress("0x1000")
+	keys := putStorage(b, tx, contract, 1, 1000)
+	r := NewPlainStateReader(tx)
+
+	for _, n := range []int{1, 10, 1000} {
+		b.Run(fmt.Sprintf("keys=%d/point", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := range keys[:n] {
+					if _, err := r.ReadAccountStorage(contract, 1, &keys[j]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("keys=%d/prefix", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := r.ReadAccountStoragePrefix(contract, 1, keys[:n]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// cursorTrackingTx counts the cursors opened and not yet closed
+type cursorTrackingTx struct {
+	kv.Tx
+	open int
+}
+
+func (tx *cursorTrackingTx) Cursor(table string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	tx.open++
+	return &trackedCursor{Cursor: c, tx: tx}, nil
+}
+
+type trackedCursor struct {
+	kv.Cursor
+	tx *cursorTrackingTx
+}
+
+func (c *trackedCursor) Close() {
+	c.tx.open--
+	c.Cursor.Close()
+}
+
+func TestPlainStateReaderClose(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	contract := libcommon.HexToAddress("0x1000")
+	keys := putStorage(t, tx, contract, 1, storageScanThreshold)
+	tracking := &cursorTrackingTx{Tx: tx}
+	r := NewPlainStateReader(tracking)
+
+	for i := 0; i < 3; i++ {
+		values, err := r.ReadAccountStoragePrefix(contract, 1, keys)
+		require.NoError(t, err)
+		require.Len(t, values, len(keys))
+	}
+	require.Equal(t, 1, tracking.open, "the storage cursor is reused")
+
+	require.NoError(t, r.Close())
+	require.Zero(t, tracking.open)
+	require.NoError(t, r.Close())
+
+	_, err := r.ReadAccountStoragePrefix(contract, 1, keys)
+	require.ErrorIs(t, err, ErrReaderClosed)
+	_, err = r.ReadAccountStorage(contract, 1, &keys[0])
+	require.ErrorIs(t, err, ErrReaderClosed)
+	_, err = r.ReadAccountData(contract)
+	require.ErrorIs(t, err, ErrReaderClosed)
+	require.Zero(t, tracking.open)
+}
+
+func TestReadAccountIncarnationMalformed(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	truncated := libcommon.HexToAddress("0x01")
+	empty := libcommon.HexToAddress("0x02")
+	require.NoError(t, tx.Put(kv.IncarnationMap, truncated[:], []byte{0, 0, 1}))
+	require.NoError(t, tx.Put(kv.IncarnationMap, empty[:], []byte{}))
+
+	view, err := kvcache.NewDummy().View(context.Background(), tx)
+	require.NoError(t, err)
+	for name, r := range map[string]StateReader{
+		"plain":  NewPlainStateReader(tx),
+		"cached": NewCachedReader2(view, tx),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := r.ReadAccountIncarnation(truncated)
+			require.ErrorIs(t, err, ErrMalformedIncarnation)
+			require.ErrorContains(t, err, "3 bytes")
+
+			incarnation, err := r.ReadAccountIncarnation(empty)
+			require.NoError(t, err)
+			require.Zero(t, incarnation)
+		})
+	}
+}
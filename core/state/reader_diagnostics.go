@@ -0,0 +1,50 @@
+package state
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/types/accounts"
+)
+
+// AccountSample is a raw account encoding captured by reader diagnostics
+type AccountSample struct {
+	Address libcommon.Address
+	Raw     []byte
+}
+
+// ReaderDiagnostics is a snapshot of the diagnostics collected by a state reader
+type ReaderDiagnostics struct {
+	AccountsDecoded uint64
+	EmptyCodeHash   uint64
+	Samples         []AccountSample
+}
+
+// readerDiagnostics collects opt-in diagnostics on decoded accounts, used to debug
+// account encoding issues such as EIP-7702 delegation accounts losing their CodeHash.
+// A nil *readerDiagnostics is valid and records nothing.
+type readerDiagnostics struct {
+	sampleLimit int
+	stats       ReaderDiagnostics
+}
+
+func (d *readerDiagnostics) recordAccount(address libcommon.Address, enc []byte, a *accounts.Account) {
+	if d == nil {
+		return
+	}
+	d.stats.AccountsDecoded++
+	if a.IsEmptyCodeHash() {
+		d.stats.EmptyCodeHash++
+	}
+	if len(d.stats.Samples) < d.sampleLimit {
+		d.stats.Samples = append(d.stats.Samples, AccountSample{Address: address, Raw: libcommon.CopyBytes(enc)})
+	}
+}
+
+func (d *readerDiagnostics) snapshot() ReaderDiagnostics {
+	if d == nil {
+		return ReaderDiagnostics{}
+	}
+	stats := d.stats
+	stats.Samples = append([]AccountSample(nil), d.stats.Samples...)
+	return stats
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/params"
+)
+
+// SysCallType identifies the system contract targeted by a system call
+type SysCallType uint8
+
+const (
+	// SysCallGeneric covers calls made by the consensus engines themselves,
+	// e.g. AuRa block rewards and Gnosis withdrawals
+	SysCallGeneric               SysCallType = iota
+	SysCallBeaconRoots                       // EIP-4788 beacon block root contract
+	SysCallBlockHashHistory                  // EIP-2935 historical block hashes contract
+	SysCallWithdrawalRequests                // EIP-7002 withdrawal requests contract
+	SysCallConsolidationRequests             // EIP-7251 consolidation requests contract
+)
+
+// sysCallGasLimits maps every system call type to the gas its call is given,
+// as set by the EIP introducing the contract
+var sysCallGasLimits = map[SysCallType]uint64{
+	SysCallGeneric:               SysCallGasLimit,
+	SysCallBeaconRoots:           30_000_000,
+	SysCallBlockHashHistory:      30_000_000,
+	SysCallWithdrawalRequests:    30_000_000,
+	SysCallConsolidationRequests: 30_000_000,
+}
+
+// SysCallTypeOf returns the type of a system call to contract
+func SysCallTypeOf(contract libcommon.Address) SysCallType {
+	switch contract {
+	case params.BeaconRootsAddress:
+		return SysCallBeaconRoots
+	case params.HistoryStorageAddress:
+		return SysCallBlockHashHistory
+	case params.WithdrawalRequestAddress:
+		return SysCallWithdrawalRequests
+	case params.ConsolidationRequestAddress:
+		return SysCallConsolidationRequests
+	default:
+		return SysCallGeneric
+	}
+}
+
+// GasLimit returns the gas a system call of this type is executed with
+func (t SysCallType) GasLimit() uint64 {
+	if limit, ok := sysCallGasLimits[t]; ok {
+		return limit
+	}
+	return SysCallGasLimit
+}
+
+func (t SysCallType) String() string {
+	switch t {
+	case SysCallGeneric:
+		return "generic"
+	case SysCallBeaconRoots:
+		return "eip4788"
+	case SysCallBlockHashHistory:
+		return "eip2935"
+	case SysCallWithdrawalRequests:
+		return "eip7002"
+	case SysCallConsolidationRequests:
+		return "eip7251"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
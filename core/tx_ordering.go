@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+
+	"github.com/erigontech/erigon/core/types"
+)
+
+var (
+	// ErrTxOrderingNonce is the reason of a TxOrderingViolation for a
+	// transaction whose nonce doesn't exceed the one of the previous
+	// transaction of its sender in the block
+	ErrTxOrderingNonce = errors.New("nonce out of order")
+	// ErrTxOrderingBaseFee is the reason of a TxOrderingViolation for a
+	// transaction whose fee cap is below the base fee of the block
+	ErrTxOrderingBaseFee = errors.New("fee cap below block base fee")
+)
+
+// TxOrderingViolation is a transaction of a block breaking the ordering
+// checked by vm.Config.ValidateTxOrdering
+type TxOrderingViolation struct {
+	TxIndex int
+	TxHash  libcommon.Hash
+	Sender  libcommon.Address // zero if the signature didn't recover
+	Reason  error
+}
+
+// txOrderingViolations checks, before execution, that the nonces of each
+// sender increase along its transactions and that every transaction pays the
+// base fee of the block. Transactions whose sender can't be recovered are
+// only checked against the base fee, their execution rejects them.
+func txOrderingViolations(txs types.Transactions, header *types.Header, signer *types.Signer) []TxOrderingViolation {
+	var baseFee *uint256.Int
+	if header.BaseFee != nil {
+		baseFee = uint256.MustFromBig(header.BaseFee)
+	}
+	var violations []TxOrderingViolation
+	nonces := make(map[libcommon.Address]uint64, len(txs))
+	for i, tx := range txs {
+		sender, err := tx.Sender(*signer)
+		if err != nil {
+			sender = libcommon.Address{}
+		}
+		if baseFee != nil && tx.GetFeeCap().Lt(baseFee) {
+			violations = append(violations, TxOrderingViolation{TxIndex: i, TxHash: tx.Hash(), Sender: sender,
+				Reason: fmt.Errorf("%w: fee cap %d, base fee %d", ErrTxOrderingBaseFee, tx.GetFeeCap(), baseFee)})
+		}
+		if err != nil {
+			continue
+		}
+		if previous, ok := nonces[sender]; ok && tx.GetNonce() <= previous {
+			violations = append(violations, TxOrderingViolation{TxIndex: i, TxHash: tx.Hash(), Sender: sender,
+				Reason: fmt.Errorf("%w: nonce %d after %d", ErrTxOrderingNonce, tx.GetNonce(), previous)})
+			continue
+		}
+		nonces[sender] = tx.GetNonce()
+	}
+	return violations
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/erigontech/erigon-lib/chain"
+
+	"github.com/erigontech/erigon/core/types"
+)
+
+// preValidateTransaction runs the cheap, state-independent checks of a
+// transaction against the fork rules of its block: the transaction type must
+// be active, blob and set code transactions must be well formed, and the gas
+// limit must cover the intrinsic gas. ApplyTransaction performs these checks
+// too, but only after loading the sender's state. ExecuteBlockEphemerally only
+// runs them in stateless execution, to reject such transactions with a precise
+// reason.
+func preValidateTransaction(tx types.Transaction, rules *chain.Rules, isEIP3860 bool) error {
+	tx = tx.Unwrap()
+	var authorizations int
+	switch tx.Type() {
+	case types.BlobTxType:
+		if !rules.IsCancun {
+			return fmt.Errorf("%w: blob transaction before Cancun", ErrTxTypeNotSupported)
+		}
+		if len(tx.GetBlobHashes()) == 0 {
+			return ErrBlobTxWithoutBlobs
+		}
+		if tx.GetTo() == nil {
+			return ErrBlobTxCreate
+		}
+	case types.SetCodeTxType:
+		if !types.SetCodeTxSupported(rules) {
+			return fmt.Errorf("%w: set code transaction before Prague", ErrTxTypeNotSupported)
+		}
+		setCode, ok := tx.(*types.SetCodeTransaction)
+		if !ok || len(setCode.Authorizations) == 0 {
+			return ErrSetCodeTxWithoutAuthorizations
+		}
+		if tx.GetTo() == nil {
+			return ErrSetCodeTxCreate
+		}
+		authorizations = len(setCode.Authorizations)
+	}
+
+	gas, floorGas7623, err := IntrinsicGas(tx.GetData(), tx.GetAccessList(), tx.GetTo() == nil, rules.IsHomestead, rules.IsIstanbul, isEIP3860, rules.IsPrague, uint64(authorizations))
+	if err != nil {
+		return err
+	}
+	if tx.GetGas() < gas || tx.GetGas() < floorGas7623 {
+		return fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.GetGas(), max(gas, floorGas7623))
+	}
+	return nil
+}
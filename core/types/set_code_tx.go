@@ -95,6 +95,11 @@ func (tx *SetCodeTransaction) MarshalBinary(w io.Writer) error {
 	return nil
 }
 
+// SetCodeTxSupported reports whether set code transactions are valid under rules
+func SetCodeTxSupported(rules *chain.Rules) bool {
+	return rules.IsPrague || rules.IsOsaka
+}
+
 func (tx *SetCodeTransaction) AsMessage(s Signer, baseFee *big.Int, rules *chain.Rules) (Message, error) {
 	msg := Message{
 		nonce:      tx.Nonce,
@@ -108,7 +113,7 @@ func (tx *SetCodeTransaction) AsMessage(s Signer, baseFee *big.Int, rules *chain
 		accessList: tx.AccessList,
 		checkNonce: true,
 	}
-	if !rules.IsPrague && !rules.IsOsaka {
+	if !SetCodeTxSupported(rules) {
 		return msg, errors.New("SetCodeTransaction is only supported in Prague and later")
 	}
 	if baseFee != nil {
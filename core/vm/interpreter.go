@@ -19,6 +19,7 @@ package vm
 import (
 	"hash"
 	"sync"
+	"time"
 
 	"github.com/erigontech/erigon-lib/chain"
 	libcommon "github.com/erigontech/erigon-lib/common"
@@ -42,6 +43,67 @@ type Config struct {
 	RestoreState  bool      // Revert all changes made to the state (useful for constant system calls)
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	// MaxBlobGasPerBlockOverride, when set, replaces the chain config's blob gas
+	// schedule when sizing a block's blob gas pool (custom/L2 chains)
+	MaxBlobGasPerBlockOverride func(time uint64) uint64
+
+	// StopAfterTxIndex, when set, makes block execution stop after the
+	// transaction at this index, skipping header checks and finalisation
+	StopAfterTxIndex *int
+
+	// TrustHeaderBloom makes stateless block execution take the logs bloom
+	// from the header instead of recomputing it from the receipts. It has no
+	// effect unless StatelessExec is set, as the header is validated otherwise.
+	TrustHeaderBloom bool
+
+	// ValidateWithdrawalsRoot makes block execution check the withdrawals of
+	// the block against the withdrawals root of the header. It has no effect
+	// when StatelessExec is set.
+	ValidateWithdrawalsRoot bool
+
+	// RequireStateSync makes execution of a Bor block fail if it produces no
+	// state-sync logs. Set it for blocks known to carry state-sync events.
+	RequireStateSync bool
+
+	// ExecEventSink, when set, receives a BlockExecEvent after each block
+	// executed successfully by ExecuteBlockEphemerally
+	ExecEventSink func(BlockExecEvent)
+
+	// CollectAccessLists makes block execution record the accounts and
+	// storage slots touched by each transaction, returned as access lists
+	CollectAccessLists bool
+
+	// CollectOpcodeGas makes block execution tally the gas charged by each
+	// opcode across all transactions, see OpcodeGasTracer
+	CollectOpcodeGas bool
+
+	// CollectLogs makes block execution return the logs of the block with
+	// their block and transaction fields derived, see EphemeralExecResult.Logs
+	CollectLogs bool
+
+	// ValidateTxOrdering makes block execution check, before executing any
+	// transaction, that the nonces of each sender increase along the block and
+	// that every transaction pays the base fee. Violations are reported in
+	// the result, not as errors, even with ReadOnly set.
+	ValidateTxOrdering bool
+
+	// StateRootHook, when set, is called by ExecuteBlockEphemerally with the
+	// state root of the finalized block, which fails with the error returned.
+	// It needs a state writer implementing core.StateRootWriter, such as
+	// state.HashedStateWriter.
+	StateRootHook func(computed libcommon.Hash) error
+}
+
+// BlockExecEvent summarises the execution of a block
+type BlockExecEvent struct {
+	Number      uint64
+	Hash        libcommon.Hash
+	TxCount     int // transactions executed, excluding rejected ones
+	GasUsed     uint64
+	BlobGasUsed uint64
+	Duration    time.Duration
+	Rejected    int // transactions rejected in stateless execution
 }
 
 var pool = sync.Pool{
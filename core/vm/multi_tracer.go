@@ -0,0 +1,94 @@
+// Copyright 2024 The Erigon Authors
+// This file is part of the Erigon library.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/holiman/uint256"
+
+	"github.com/erigontech/erigon/core/types"
+)
+
+// MultiTracer fans out every EVM hook to several tracers, in order. It is a
+// FlushableTracer flushing those of its tracers that are.
+type MultiTracer []EVMLogger
+
+// NewMultiTracer combines the non-nil tracers into a MultiTracer
+func NewMultiTracer(tracers ...EVMLogger) MultiTracer {
+	t := make(MultiTracer, 0, len(tracers))
+	for _, tracer := range tracers {
+		if tracer != nil {
+			t = append(t, tracer)
+		}
+	}
+	return t
+}
+
+func (t MultiTracer) CaptureTxStart(gasLimit uint64) {
+	for _, tracer := range t {
+		tracer.CaptureTxStart(gasLimit)
+	}
+}
+
+func (t MultiTracer) CaptureTxEnd(restGas uint64) {
+	for _, tracer := range t {
+		tracer.CaptureTxEnd(restGas)
+	}
+}
+
+func (t MultiTracer) CaptureStart(env *EVM, from libcommon.Address, to libcommon.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	for _, tracer := range t {
+		tracer.CaptureStart(env, from, to, precompile, create, input, gas, value, code)
+	}
+}
+
+func (t MultiTracer) CaptureEnd(output []byte, usedGas uint64, err error) {
+	for _, tracer := range t {
+		tracer.CaptureEnd(output, usedGas, err)
+	}
+}
+
+func (t MultiTracer) CaptureEnter(typ OpCode, from libcommon.Address, to libcommon.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	for _, tracer := range t {
+		tracer.CaptureEnter(typ, from, to, precompile, create, input, gas, value, code)
+	}
+}
+
+func (t MultiTracer) CaptureExit(output []byte, usedGas uint64, err error) {
+	for _, tracer := range t {
+		tracer.CaptureExit(output, usedGas, err)
+	}
+}
+
+func (t MultiTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+	}
+}
+
+func (t MultiTracer) CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+	for _, tracer := range t {
+		tracer.CaptureFault(pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+func (t MultiTracer) Flush(tx types.Transaction) {
+	for _, tracer := range t {
+		if ftracer, ok := tracer.(FlushableTracer); ok {
+			ftracer.Flush(tx)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Erigon Authors
+// This file is part of the Erigon library.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vm
+
+import (
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/holiman/uint256"
+)
+
+// OpcodeGasTracer tallies the gas charged by each opcode across all the
+// transactions it traces. The gas a call forwards to its callee is attributed
+// to the opcodes of the callee, or to the call itself for precompiles. The
+// intrinsic gas of transactions and the gas burned by failing frames beyond
+// the cost of their opcodes aren't attributed to any opcode.
+type OpcodeGasTracer struct {
+	gas map[OpCode]uint64
+	// frames holds the opcode that entered each open call frame, and whether
+	// it called a precompile
+	frames []opcodeGasFrame
+}
+
+type opcodeGasFrame struct {
+	op         OpCode
+	precompile bool
+}
+
+func NewOpcodeGasTracer() *OpcodeGasTracer {
+	return &OpcodeGasTracer{gas: map[OpCode]uint64{}}
+}
+
+// Gas returns the gas tallied by opcode
+func (t *OpcodeGasTracer) Gas() map[OpCode]uint64 { return t.gas }
+
+func (t *OpcodeGasTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *OpcodeGasTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *OpcodeGasTracer) CaptureStart(env *EVM, from libcommon.Address, to libcommon.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	t.frames = t.frames[:0]
+}
+
+func (t *OpcodeGasTracer) CaptureEnd(output []byte, usedGas uint64, err error) {}
+
+func (t *OpcodeGasTracer) CaptureEnter(typ OpCode, from libcommon.Address, to libcommon.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	t.frames = append(t.frames, opcodeGasFrame{op: typ, precompile: precompile})
+	switch typ {
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		// the cost of a call includes the gas it forwards, which the callee
+		// accounts for. The value transfer stipend makes the callee gas exceed
+		// the forwarded gas, the difference is a discount of the call.
+		t.gas[typ] -= gas
+	}
+}
+
+func (t *OpcodeGasTracer) CaptureExit(output []byte, usedGas uint64, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	if frame.precompile {
+		t.gas[frame.op] += usedGas
+	}
+}
+
+func (t *OpcodeGasTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.gas[op] += cost
+}
+
+func (t *OpcodeGasTracer) CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+}
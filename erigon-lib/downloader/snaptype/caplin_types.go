@@ -1,5 +1,7 @@
 package snaptype
 
+import "path/filepath"
+
 var (
 	BeaconBlocks = snapType{
 		enum: CaplinEnums.BeaconBlocks,
@@ -33,3 +35,51 @@ func IsCaplinType(t Enum) bool {
 
 	return false
 }
+
+// Category is the family of data a snapshot file holds, which decides how
+// its content and header are laid out
+type Category int
+
+const (
+	UnknownCategory Category = iota
+	ExecutionCategory
+	CaplinBlocksCategory
+	CaplinBlobsCategory
+)
+
+func (c Category) String() string {
+	switch c {
+	case ExecutionCategory:
+		return "execution"
+	case CaplinBlocksCategory:
+		return "caplin-blocks"
+	case CaplinBlobsCategory:
+		return "caplin-blobs"
+	default:
+		return "unknown"
+	}
+}
+
+// IsCaplin reports whether the category is one of the Caplin snapshots
+func (c Category) IsCaplin() bool {
+	return c == CaplinBlocksCategory || c == CaplinBlobsCategory
+}
+
+// ClassifySnapshot parses a snapshot segment or index filename, with or
+// without its directory, and returns its category and type. It returns false
+// if the name isn't a snapshot of a known type; execution types are only
+// known once the package defining them has registered them.
+func ClassifySnapshot(name string) (Category, Type, bool) {
+	info, ok := parseFileName("", filepath.Base(name))
+	if !ok {
+		return UnknownCategory, nil, false
+	}
+	switch info.Type.Enum() {
+	case CaplinEnums.BeaconBlocks:
+		return CaplinBlocksCategory, info.Type, true
+	case CaplinEnums.BlobSidecars:
+		return CaplinBlobsCategory, info.Type, true
+	default:
+		return ExecutionCategory, info.Type, true
+	}
+}
@@ -28,3 +28,30 @@ func TestNames(t *testing.T) {
 	}
 
 }
+
+func TestClassifySnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		category snaptype.Category
+		typ      snaptype.Type
+	}{
+		{"v1-000000-000100-beaconblocks.seg", snaptype.CaplinBlocksCategory, snaptype.BeaconBlocks},
+		{"/snapshots/v1.1-000100-000200-beaconblocks.idx", snaptype.CaplinBlocksCategory, snaptype.BeaconBlocks},
+		{"v1-000000-000100-blobsidecars.seg", snaptype.CaplinBlobsCategory, snaptype.BlobSidecars},
+	}
+	for _, tt := range tests {
+		category, typ, ok := snaptype.ClassifySnapshot(tt.name)
+		if !ok || category != tt.category || typ.Enum() != tt.typ.Enum() {
+			t.Fatal("unexpected classification", tt.name, category, typ, ok)
+		}
+		if !category.IsCaplin() {
+			t.Fatal("expected caplin category", tt.name, category)
+		}
+	}
+
+	for _, name := range []string{"v1-000000-000100-unknowntype.seg", "beaconblocks.seg", "v1-x-000100-beaconblocks.seg"} {
+		if category, _, ok := snaptype.ClassifySnapshot(name); ok || category != snaptype.UnknownCategory {
+			t.Fatal("unexpected classification", name, category)
+		}
+	}
+}
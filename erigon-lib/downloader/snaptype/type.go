@@ -200,10 +200,15 @@ type Index struct {
 
 var CaplinIndexes = struct {
 	BeaconBlockSlot,
-	BlobSidecarSlot Index
+	BlobSidecarSlot,
+	// BeaconBlockRoot is an optional block root => slot index of BeaconBlocks
+	// segments. It isn't one of the type's indexes, so segments without it
+	// still count as indexed.
+	BeaconBlockRoot Index
 }{
 	BeaconBlockSlot: Index{Name: "beaconblocks"},
 	BlobSidecarSlot: Index{Name: "blocksidecars"},
+	BeaconBlockRoot: Index{Name: "beaconblockroots"},
 }
 
 func (i Index) HasFile(info FileInfo, logger log.Logger) bool {
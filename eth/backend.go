@@ -839,7 +839,8 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		if err != nil {
 			return nil, err
 		}
-		executionEngine, err = executionclient.NewExecutionClientRPC(jwtSecret, stack.Config().Http.AuthRpcHTTPListenAddress, stack.Config().Http.AuthRpcPort)
+		_, beaconConfig := clparams.GetConfigsByNetwork(clparams.NetworkType(config.NetworkID))
+		executionEngine, err = executionclient.NewExecutionClientRPC(jwtSecret, stack.Config().Http.AuthRpcHTTPListenAddress, stack.Config().Http.AuthRpcPort, beaconConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -948,6 +949,14 @@ func (s *Ethereum) Init(stack *node.Node, config *ethconfig.Config, chainConfig
 	}
 
 	s.apiList = jsonrpc.APIList(chainKv, ethRpcClient, txPoolRpcClient, miningRpcClient, ff, stateCache, blockReader, s.agg, &httpRpcCfg, s.engine, s.logger)
+	if s.caplinService != nil && slices.Contains(httpRpcCfg.API, "debug") {
+		s.apiList = append(s.apiList, rpc.API{
+			Namespace: "debug",
+			Public:    true,
+			Service:   &CaplinDebugAPI{caplin: s.caplinService},
+			Version:   "1.0",
+		})
+	}
 
 	if config.SilkwormRpcDaemon && httpRpcCfg.Enabled {
 		interface_log_settings := silkworm.RpcInterfaceLogSettings{
@@ -0,0 +1,128 @@
+// Copyright 2024 The Erigon Authors
+// This file is part of the Erigon library.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/erigontech/erigon-lib/kv"
+
+	"github.com/erigontech/erigon/cl/persistence/beacon_indicies"
+	"github.com/erigontech/erigon/cl/phase1/execution_client"
+)
+
+// The goroutines of the Caplin service carry this pprof label, so that they
+// can be told apart in goroutine dumps
+const caplinLabelKey, caplinLabelValue = "service", "caplin"
+
+// diagnosticsTimeout bounds the database and execution engine queries of
+// DumpDiagnostics
+const diagnosticsTimeout = 5 * time.Second
+
+// DumpDiagnostics writes a report of the service for operators: its database
+// stats, the finalized slot, the execution head, the execution engine pool
+// stats and the stacks of the goroutines of the service only. Parts that
+// can't be queried are reported as such.
+func (s *CaplinService) DumpDiagnostics(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	// the database stays open while the service state is read locked
+	s.mu.RLock()
+	fmt.Fprintf(&buf, "caplin running: %t\n", s.running)
+	if s.indexDB != nil && s.running {
+		if err := s.indexDB.View(ctx, func(tx kv.Tx) error {
+			size, err := tx.DBSize()
+			if err != nil {
+				return err
+			}
+			finalized, err := beacon_indicies.ReadHighestFinalized(tx)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "database size: %d bytes, page size: %d bytes\n", size, s.indexDB.PageSize())
+			fmt.Fprintf(&buf, "finalized slot: %d\n", finalized)
+			return nil
+		}); err != nil {
+			fmt.Fprintf(&buf, "database: %v\n", err)
+		}
+	}
+	s.mu.RUnlock()
+
+	if s.executionEngine != nil {
+		if header, err := s.executionEngine.CurrentHeader(ctx); err != nil {
+			fmt.Fprintf(&buf, "execution head: %v\n", err)
+		} else if header != nil {
+			fmt.Fprintf(&buf, "execution head: %d %x\n", header.Number.Uint64(), header.Hash())
+		}
+	}
+	if pool, ok := s.executionEngine.(*execution_client.ExecutionEnginePool); ok {
+		requests, hits, misses, circuit := pool.Stats()
+		fmt.Fprintf(&buf, "engine pool: requests %d, cache hits %d, cache misses %d, circuit %s\n", requests, hits, misses, circuit)
+	}
+
+	fmt.Fprintln(&buf, "goroutines:")
+	if err := writeLabelledGoroutines(&buf, caplinLabelKey, caplinLabelValue); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeLabelledGoroutines writes the goroutine profile records whose
+// goroutines carry the label key=value
+func writeLabelledGoroutines(w io.Writer, key, value string) error {
+	var profile bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		return err
+	}
+	label := fmt.Sprintf("%q:%q", key, value)
+	// records are separated by blank lines, the first one is the header
+	records := strings.Split(profile.String(), "\n\n")
+	for _, record := range records[1:] {
+		for _, line := range strings.Split(record, "\n") {
+			if strings.HasPrefix(line, "# labels:") && strings.Contains(line, label) {
+				if _, err := fmt.Fprintf(w, "%s\n\n", record); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// CaplinDebugAPI serves the diagnostics of the embedded Caplin service in the
+// debug namespace
+type CaplinDebugAPI struct {
+	caplin *CaplinService
+}
+
+// CaplinDiagnostics returns the report of CaplinService.DumpDiagnostics
+func (api *CaplinDebugAPI) CaplinDiagnostics() (string, error) {
+	var buf strings.Builder
+	if err := api.caplin.DumpDiagnostics(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -18,6 +18,14 @@ package eth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
 
 	"github.com/erigontech/erigon-lib/common/datadir"
 	protodownloader "github.com/erigontech/erigon-lib/gointerfaces/downloader"
@@ -25,7 +33,6 @@ import (
 	"github.com/erigontech/erigon-lib/log/v3"
 	"google.golang.org/grpc/credentials"
 
-	"github.com/erigontech/erigon/cl/beacon/beacon_router_configuration"
 	"github.com/erigontech/erigon/cl/clparams"
 	"github.com/erigontech/erigon/cl/clparams/initial_state"
 	"github.com/erigontech/erigon/cl/persistence/db_config"
@@ -38,8 +45,12 @@ import (
 	"github.com/erigontech/erigon/turbo/snapshotsync/freezeblocks"
 )
 
+// runCaplin runs the consensus layer until its context is cancelled
+var runCaplin = caplin1.RunCaplinPhase1
+
 // CaplinService represents the embedded Caplin consensus layer service
 type CaplinService struct {
+	parentCtx       context.Context
 	ctx             context.Context
 	cancel          context.CancelFunc
 	logger          log.Logger
@@ -52,8 +63,10 @@ type CaplinService struct {
 	blockReader     freezeblocks.BeaconSnapshotReader
 	creds           credentials.TransportCredentials
 
+	mu      sync.RWMutex // guards the configs, ctx, cancel and the fields below
 	indexDB kv.RwDB
 	running bool
+	done    chan struct{} // closed once the running instance has returned
 }
 
 // NewCaplinService creates a new embedded Caplin CL service
@@ -69,9 +82,11 @@ func NewCaplinService(
 	networkType := clparams.NetworkType(config.NetworkID)
 	networkConfig, beaconConfig := clparams.GetConfigsByNetwork(networkType)
 
+	parentCtx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 
 	return &CaplinService{
+		parentCtx:       parentCtx,
 		ctx:             ctx,
 		cancel:          cancel,
 		logger:          logger.New("service", "caplin"),
@@ -85,8 +100,134 @@ func NewCaplinService(
 	}, nil
 }
 
+// checkWeakSubjectivityPeriod rejects checkpoint states too old to sync from,
+// unless the operator opted out of the check
+func (s *CaplinService) checkWeakSubjectivityPeriod(beaconState *state.CachingBeaconState) error {
+	err := core.CheckWeakSubjectivityPeriod(beaconState, time.Now())
+	if err != nil && s.config.CaplinConfig.SkipWeakSubjectivityCheck {
+		s.logger.Warn("Accepting checkpoint state outside of the weak subjectivity period", "err", err)
+		return nil
+	}
+	return err
+}
+
+const (
+	defaultCheckpointSyncAttempts = 3
+	defaultCheckpointSyncBackoff  = 5 * time.Second
+)
+
+// retrieveCheckpointState tries the endpoints in turn until one serves a
+// usable state, for up to the configured number of attempts, backing off
+// between attempts so that a transient outage doesn't send the node to a
+// genesis sync. It returns a nil state if every attempt failed, and an error
+// only if the service was stopped meanwhile.
+func (s *CaplinService) retrieveCheckpointState(endpoints []string) (*state.CachingBeaconState, error) {
+	attempts, backoff := s.config.CaplinConfig.CheckpointSyncAttempts, s.config.CaplinConfig.CheckpointSyncBackoff
+	if attempts <= 0 {
+		attempts = defaultCheckpointSyncAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultCheckpointSyncBackoff
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			s.logger.Warn("Retrying checkpoint sync", "attempt", attempt, "of", attempts, "in", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.ctx.Done():
+				return nil, s.ctx.Err()
+			}
+			backoff *= 2
+		}
+		for _, checkpointUri := range endpoints {
+			beaconState, err := core.RetrieveBeaconState(s.ctx, s.beaconConfig, checkpointUri, nil)
+			if err == nil {
+				err = s.checkWeakSubjectivityPeriod(beaconState)
+			}
+			if err == nil {
+				s.logger.Info("Successfully retrieved checkpoint state", "uri", checkpointUri, "attempt", attempt)
+				return beaconState, nil
+			}
+			if s.ctx.Err() != nil {
+				s.logger.Warn("Checkpoint state retrieval aborted", "uri", checkpointUri, "err", err)
+				return nil, s.ctx.Err()
+			}
+			s.logger.Warn("Failed to retrieve checkpoint state from endpoint, trying next", "uri", checkpointUri, "attempt", attempt, "err", err)
+		}
+	}
+	return nil, nil
+}
+
+// Validate resolves the network and beacon router configuration, loads the
+// genesis state and checks the database paths, without opening the databases
+// or starting anything. All problems found are returned together.
+func (s *CaplinService) Validate() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.validate(s.config)
+}
+
+func (s *CaplinService) validate(config *ethconfig.Config) error {
+	var errs []error
+	networkType := clparams.NetworkType(config.NetworkID)
+	if _, ok := clparams.BeaconConfigs[networkType]; !ok {
+		errs = append(errs, fmt.Errorf("unsupported network id %d: no beacon chain config", config.NetworkID))
+	} else if _, err := initial_state.GetGenesisState(networkType); err != nil {
+		errs = append(errs, fmt.Errorf("genesis state of network %d: %w", config.NetworkID, err))
+	} else if !initial_state.IsGenesisStateSupported(networkType) && len(clparams.GetAllCheckpointSyncEndpoints(networkType)) == 0 {
+		errs = append(errs, fmt.Errorf("network %d has neither an embedded genesis state nor checkpoint sync endpoints", config.NetworkID))
+	}
+
+	if router := config.BeaconRouter; router.Active {
+		if _, _, err := net.SplitHostPort(router.Address); err != nil {
+			errs = append(errs, fmt.Errorf("beacon router address %q: %w", router.Address, err))
+		}
+		if router.ReadTimeTimeout < 0 || router.WriteTimeout < 0 || router.IdleTimeout < 0 {
+			errs = append(errs, errors.New("beacon router timeouts must not be negative"))
+		}
+	}
+
+	for _, dir := range []struct{ name, path string }{
+		{"caplin indexing", s.dirs.CaplinIndexing},
+		{"caplin blobs", s.dirs.CaplinBlobs},
+	} {
+		if err := checkDatabaseDir(dir.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s directory: %w", dir.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkDatabaseDir checks that path is a directory, or can be created as one
+// under its closest existing ancestor
+func checkDatabaseDir(path string) error {
+	if path == "" {
+		return errors.New("path not set")
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		info, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) && p != filepath.Dir(p) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+		return nil
+	}
+}
+
 // Start starts the Caplin CL service
 func (s *CaplinService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start()
+}
+
+func (s *CaplinService) start() error {
 	if s.running {
 		return nil
 	}
@@ -104,13 +245,8 @@ func (s *CaplinService) Start() error {
 	var beaconState *state.CachingBeaconState
 	checkpointEndpoints := clparams.GetAllCheckpointSyncEndpoints(clparams.NetworkType(s.config.NetworkID))
 	if len(checkpointEndpoints) > 0 {
-		for _, checkpointUri := range checkpointEndpoints {
-			beaconState, err = core.RetrieveBeaconState(s.ctx, s.beaconConfig, checkpointUri)
-			if err == nil {
-				s.logger.Info("Successfully retrieved checkpoint state", "uri", checkpointUri)
-				break
-			}
-			s.logger.Warn("Failed to retrieve checkpoint state from endpoint, trying next", "uri", checkpointUri, "err", err)
+		if beaconState, err = s.retrieveCheckpointState(checkpointEndpoints); err != nil {
+			return err
 		}
 		if beaconState == nil {
 			s.logger.Warn("All checkpoint endpoints failed, starting from genesis")
@@ -141,53 +277,49 @@ func (s *CaplinService) Start() error {
 	s.indexDB = indexDB
 
 	// Setup beacon router configuration
-	rcfg := beacon_router_configuration.RouterConfiguration{
-		Protocol:         "tcp",
-		Address:          s.config.BeaconRouter.Address,
-		ReadTimeTimeout:  s.config.BeaconRouter.ReadTimeTimeout,
-		WriteTimeout:     s.config.BeaconRouter.WriteTimeout,
-		IdleTimeout:      s.config.BeaconRouter.IdleTimeout,
-		AllowedOrigins:   s.config.BeaconRouter.AllowedOrigins,
-		AllowedMethods:   s.config.BeaconRouter.AllowedMethods,
-		AllowCredentials: s.config.BeaconRouter.AllowCredentials,
-		Active:           s.config.BeaconRouter.Active,
-		Validator:        s.config.BeaconRouter.Validator,
-	}
-
-	// Run Caplin in a goroutine
+	rcfg := s.config.BeaconRouter.ToRouterConfiguration()
+
+	// Run Caplin in a goroutine, with the config of this run only
+	runCtx, config, networkConfig, beaconConfig := s.ctx, s.config, s.networkConfig, s.beaconConfig
+	done := make(chan struct{})
+	s.done = done
 	go func() {
-		if err := caplin1.RunCaplinPhase1(
-			s.ctx,
-			s.executionEngine,
-			&ethconfig.Config{
-				LightClientDiscoveryAddr:    s.config.LightClientDiscoveryAddr,
-				LightClientDiscoveryPort:    s.config.LightClientDiscoveryPort,
-				LightClientDiscoveryTCPPort: s.config.LightClientDiscoveryTCPPort,
-				BeaconRouter:                rcfg,
-				SentinelAddr:                s.config.SentinelAddr,
-				SentinelPort:                s.config.SentinelPort,
-			},
-			s.networkConfig,
-			s.beaconConfig,
-			ethClock,
-			beaconState,
-			s.dirs,
-			nil, // eth1Getter - will use execution client
-			s.snDownloader,
-			s.config.CaplinConfig.Backfilling,
-			s.config.CaplinConfig.BlobBackfilling,
-			s.config.CaplinConfig.Archive,
-			indexDB,
-			blobStorage,
-			s.creds,
-		); err != nil {
-			// Don't log context cancellation as error - it's normal shutdown
-			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				s.logger.Debug("Caplin service stopped", "reason", err)
-			} else {
-				s.logger.Error("Caplin service error", "err", err)
+		defer close(done)
+		// goroutines started by Caplin inherit the label, see DumpDiagnostics
+		pprof.Do(runCtx, pprof.Labels(caplinLabelKey, caplinLabelValue), func(ctx context.Context) {
+			if err := runCaplin(
+				ctx,
+				s.executionEngine,
+				&ethconfig.Config{
+					LightClientDiscoveryAddr:    config.LightClientDiscoveryAddr,
+					LightClientDiscoveryPort:    config.LightClientDiscoveryPort,
+					LightClientDiscoveryTCPPort: config.LightClientDiscoveryTCPPort,
+					BeaconRouter:                rcfg,
+					SentinelAddr:                config.SentinelAddr,
+					SentinelPort:                config.SentinelPort,
+				},
+				networkConfig,
+				beaconConfig,
+				ethClock,
+				beaconState,
+				s.dirs,
+				nil, // eth1Getter - will use execution client
+				s.snDownloader,
+				config.CaplinConfig.Backfilling,
+				config.CaplinConfig.BlobBackfilling,
+				config.CaplinConfig.Archive,
+				indexDB,
+				blobStorage,
+				s.creds,
+			); err != nil {
+				// Don't log context cancellation as error - it's normal shutdown
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					s.logger.Debug("Caplin service stopped", "reason", err)
+				} else {
+					s.logger.Error("Caplin service error", "err", err)
+				}
 			}
-		}
+		})
 	}()
 
 	s.running = true
@@ -197,6 +329,12 @@ func (s *CaplinService) Start() error {
 
 // Stop stops the Caplin CL service
 func (s *CaplinService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+func (s *CaplinService) stop() {
 	if !s.running {
 		return
 	}
@@ -204,6 +342,11 @@ func (s *CaplinService) Stop() {
 	s.logger.Info("Stopping Caplin consensus layer")
 	s.cancel()
 
+	// the running instance uses the database until it has returned
+	if s.done != nil {
+		<-s.done
+		s.done = nil
+	}
 	if s.indexDB != nil {
 		s.indexDB.Close()
 	}
@@ -212,7 +355,31 @@ func (s *CaplinService) Stop() {
 	s.logger.Info("Caplin consensus layer stopped")
 }
 
+// Reconfigure stops the service if it is running, and starts it again with
+// newConfig. If newConfig doesn't validate, an error is returned and the
+// service is left stopped with its previous config.
+func (s *CaplinService) Reconfigure(newConfig *ethconfig.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// stop waits for the running instance, so the beacon router has released
+	// its address before it is restarted
+	s.stop()
+
+	if err := s.validate(newConfig); err != nil {
+		return fmt.Errorf("invalid caplin config: %w", err)
+	}
+
+	s.cancel()
+	s.config = newConfig
+	s.networkConfig, s.beaconConfig = clparams.GetConfigsByNetwork(clparams.NetworkType(newConfig.NetworkID))
+	s.ctx, s.cancel = context.WithCancel(s.parentCtx)
+	return s.start()
+}
+
 // Running returns true if the service is running
 func (s *CaplinService) Running() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.running
 }
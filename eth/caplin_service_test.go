@@ -0,0 +1,328 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/erigontech/erigon-lib/common/datadir"
+	proto_downloader "github.com/erigontech/erigon-lib/gointerfaces/downloader"
+	"github.com/erigontech/erigon-lib/kv"
+	"github.com/erigontech/erigon-lib/log/v3"
+
+	"github.com/erigontech/erigon/cl/beacon/beacon_router_configuration"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/persistence/beacon_indicies"
+	"github.com/erigontech/erigon/cl/persistence/blob_storage"
+	"github.com/erigontech/erigon/cl/persistence/format/snapshot_format"
+	"github.com/erigontech/erigon/cl/phase1/core/state"
+	"github.com/erigontech/erigon/cl/phase1/execution_client"
+	"github.com/erigontech/erigon/cl/utils/eth_clock"
+	"github.com/erigontech/erigon/eth/ethconfig"
+)
+
+func newTestCaplinService(t *testing.T, config *ethconfig.Config, dirs datadir.Dirs) *CaplinService {
+	t.Helper()
+	s, err := NewCaplinService(context.Background(), log.New(), config, nil, dirs, nil, nil)
+	require.NoError(t, err)
+	return s
+}
+
+func TestCaplinServiceValidate(t *testing.T) {
+	dirs := datadir.New(t.TempDir())
+	require.NoError(t, newTestCaplinService(t, &ethconfig.Config{NetworkID: 1}, dirs).Validate())
+
+	err := newTestCaplinService(t, &ethconfig.Config{NetworkID: 12345}, dirs).Validate()
+	require.ErrorContains(t, err, "unsupported network id 12345")
+}
+
+func TestCaplinServiceValidateAggregatesErrors(t *testing.T) {
+	dirs := datadir.New(t.TempDir())
+	// a file in place of the blobs directory
+	require.NoError(t, os.RemoveAll(dirs.CaplinBlobs))
+	require.NoError(t, os.WriteFile(dirs.CaplinBlobs, nil, 0o600))
+	// an indexing directory that doesn't exist yet is fine
+	dirs.CaplinIndexing = filepath.Join(dirs.DataDir, "missing", "indexing")
+
+	config := &ethconfig.Config{
+		NetworkID:    12345,
+		BeaconRouter: beacon_router_configuration.RouterConfiguration{Active: true, Address: "localhost"},
+	}
+	err := newTestCaplinService(t, config, dirs).Validate()
+	require.ErrorContains(t, err, "unsupported network id 12345")
+	require.ErrorContains(t, err, `beacon router address "localhost"`)
+	require.ErrorContains(t, err, "caplin blobs directory")
+	require.NotContains(t, err.Error(), "caplin indexing")
+	require.NoDirExists(t, dirs.CaplinIndexing)
+}
+
+func TestCaplinServiceStartCancelledDuringCheckpointDownload(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// part of a large state, then the connection stalls
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", "100000000")
+		w.WriteHeader(http.StatusOK)
+		w.Write(make([]byte, 4096))
+		w.(http.Flusher).Flush()
+		close(started)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = []string{server.URL}
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	s := newTestCaplinService(t, &ethconfig.Config{NetworkID: 1}, datadir.New(t.TempDir()))
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Start() }()
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("checkpoint download not started")
+	}
+	s.cancel()
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start not aborted by the cancelled context")
+	}
+}
+
+func TestCaplinServiceCheckpointSyncRetries(t *testing.T) {
+	checkpoint := state.New(&clparams.MainnetBeaconConfig)
+	checkpoint.SetVersion(clparams.Phase0Version)
+	checkpoint.SetSlot(64)
+	encoded, err := checkpoint.EncodeSSZ(nil)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(encoded)
+	}))
+	defer server.Close()
+
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = []string{server.URL}
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	started := make(chan *state.CachingBeaconState, 1)
+	saved := runCaplin
+	defer func() { runCaplin = saved }()
+	runCaplin = func(ctx context.Context, _ execution_client.ExecutionEngine, _ *ethconfig.Config, _ *clparams.NetworkConfig,
+		_ *clparams.BeaconChainConfig, _ eth_clock.EthereumClock, beaconState *state.CachingBeaconState, _ datadir.Dirs, _ snapshot_format.ExecutionBlockReaderByNumber,
+		_ proto_downloader.DownloaderClient, _, _, _ bool, _ kv.RwDB, _ blob_storage.BlobStorage, _ credentials.TransportCredentials) error {
+		started <- beaconState
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	config := &ethconfig.Config{NetworkID: 1}
+	config.CaplinConfig.SkipWeakSubjectivityCheck = true
+	config.CaplinConfig.CheckpointSyncBackoff = time.Millisecond
+	s := newTestCaplinService(t, config, datadir.New(t.TempDir()))
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	// the third attempt succeeds instead of falling back to genesis
+	require.Equal(t, uint64(64), (<-started).Slot())
+	require.Equal(t, int32(3), requests.Load())
+
+	// with fewer attempts the service starts from genesis
+	requests.Store(0)
+	config = &ethconfig.Config{NetworkID: 1}
+	config.CaplinConfig.CheckpointSyncAttempts = 2
+	config.CaplinConfig.CheckpointSyncBackoff = time.Millisecond
+	s = newTestCaplinService(t, config, datadir.New(t.TempDir()))
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	require.Zero(t, (<-started).Slot())
+	require.Equal(t, int32(2), requests.Load())
+}
+
+func TestCaplinServiceReconfigure(t *testing.T) {
+	// start from the embedded genesis state, without checkpoint sync
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = nil
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	type run struct {
+		ctx    context.Context
+		router beacon_router_configuration.RouterConfiguration
+	}
+	runs := make(chan run, 2)
+	saved := runCaplin
+	defer func() { runCaplin = saved }()
+	runCaplin = func(ctx context.Context, _ execution_client.ExecutionEngine, config *ethconfig.Config, _ *clparams.NetworkConfig,
+		_ *clparams.BeaconChainConfig, _ eth_clock.EthereumClock, _ *state.CachingBeaconState, _ datadir.Dirs, _ snapshot_format.ExecutionBlockReaderByNumber,
+		_ proto_downloader.DownloaderClient, _, _, _ bool, _ kv.RwDB, _ blob_storage.BlobStorage, _ credentials.TransportCredentials) error {
+		runs <- run{ctx: ctx, router: config.BeaconRouter}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	config := func(address string) *ethconfig.Config {
+		return &ethconfig.Config{
+			NetworkID:    1,
+			BeaconRouter: beacon_router_configuration.RouterConfiguration{Active: true, Address: address},
+		}
+	}
+	s := newTestCaplinService(t, config("127.0.0.1:5555"), datadir.New(t.TempDir()))
+	defer s.Stop()
+
+	require.NoError(t, s.Start())
+	first := <-runs
+	require.Equal(t, "127.0.0.1:5555", first.router.Address)
+
+	require.NoError(t, s.Reconfigure(config("127.0.0.1:5556")))
+	require.True(t, s.Running())
+	require.Error(t, first.ctx.Err())
+	second := <-runs
+	require.Equal(t, "127.0.0.1:5556", second.router.Address)
+	require.NoError(t, second.ctx.Err())
+
+	// an invalid config leaves the service stopped with its previous config
+	err := s.Reconfigure(config("localhost"))
+	require.ErrorContains(t, err, `beacon router address "localhost"`)
+	require.False(t, s.Running())
+	require.Error(t, second.ctx.Err())
+	require.Equal(t, "127.0.0.1:5556", s.config.BeaconRouter.Address)
+}
+
+func TestCaplinServiceStopWaitsForRun(t *testing.T) {
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = nil
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	started := make(chan struct{})
+	viewed := make(chan error, 1)
+	saved := runCaplin
+	defer func() { runCaplin = saved }()
+	runCaplin = func(ctx context.Context, _ execution_client.ExecutionEngine, _ *ethconfig.Config, _ *clparams.NetworkConfig,
+		_ *clparams.BeaconChainConfig, _ eth_clock.EthereumClock, _ *state.CachingBeaconState, _ datadir.Dirs, _ snapshot_format.ExecutionBlockReaderByNumber,
+		_ proto_downloader.DownloaderClient, _, _, _ bool, indexDB kv.RwDB, _ blob_storage.BlobStorage, _ credentials.TransportCredentials) error {
+		close(started)
+		<-ctx.Done()
+		// shutting down still uses the database
+		viewed <- indexDB.View(context.Background(), func(tx kv.Tx) error {
+			_, err := beacon_indicies.ReadHighestFinalized(tx)
+			return err
+		})
+		return ctx.Err()
+	}
+
+	s := newTestCaplinService(t, &ethconfig.Config{NetworkID: 1}, datadir.New(t.TempDir()))
+	require.NoError(t, s.Start())
+	<-started
+	s.Stop()
+	require.False(t, s.Running())
+	require.NoError(t, <-viewed)
+}
+
+func TestCaplinServiceDumpDiagnostics(t *testing.T) {
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = nil
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	started := make(chan struct{})
+	saved := runCaplin
+	defer func() { runCaplin = saved }()
+	runCaplin = func(ctx context.Context, _ execution_client.ExecutionEngine, _ *ethconfig.Config, _ *clparams.NetworkConfig,
+		_ *clparams.BeaconChainConfig, _ eth_clock.EthereumClock, _ *state.CachingBeaconState, _ datadir.Dirs, _ snapshot_format.ExecutionBlockReaderByNumber,
+		_ proto_downloader.DownloaderClient, _, _, _ bool, _ kv.RwDB, _ blob_storage.BlobStorage, _ credentials.TransportCredentials) error {
+		// a service goroutine, which inherits the label
+		go func() { <-ctx.Done() }()
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s := newTestCaplinService(t, &ethconfig.Config{NetworkID: 1}, datadir.New(t.TempDir()))
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	<-started
+
+	report, err := (&CaplinDebugAPI{caplin: s}).CaplinDiagnostics()
+	require.NoError(t, err)
+	require.Contains(t, report, "caplin running: true")
+	require.Contains(t, report, "finalized slot: 0")
+	_, goroutines, ok := strings.Cut(report, "goroutines:\n")
+	require.True(t, ok)
+	require.Contains(t, goroutines, "TestCaplinServiceDumpDiagnostics")
+	// goroutines outside of the service are left out
+	require.NotContains(t, goroutines, "testing.tRunner")
+}
+
+func TestCaplinServiceDumpDiagnosticsWhileStopping(t *testing.T) {
+	endpoints := clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork]
+	clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = nil
+	defer func() { clparams.CheckpointSyncEndpoints[clparams.MainnetNetwork] = endpoints }()
+
+	saved := runCaplin
+	defer func() { runCaplin = saved }()
+	runCaplin = func(ctx context.Context, _ execution_client.ExecutionEngine, _ *ethconfig.Config, _ *clparams.NetworkConfig,
+		_ *clparams.BeaconChainConfig, _ eth_clock.EthereumClock, _ *state.CachingBeaconState, _ datadir.Dirs, _ snapshot_format.ExecutionBlockReaderByNumber,
+		_ proto_downloader.DownloaderClient, _, _, _ bool, _ kv.RwDB, _ blob_storage.BlobStorage, _ credentials.TransportCredentials) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s := newTestCaplinService(t, &ethconfig.Config{NetworkID: 1}, datadir.New(t.TempDir()))
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	// reports are either taken on a running service, with an open database,
+	// or on a stopped one; run with -race
+	stop := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				errCh <- nil
+				return
+			default:
+			}
+			var report strings.Builder
+			if err := s.DumpDiagnostics(&report); err != nil {
+				errCh <- err
+				return
+			}
+			if strings.Contains(report.String(), "database: ") {
+				errCh <- fmt.Errorf("database queried while closed:\n%s", report.String())
+				return
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Reconfigure(&ethconfig.Config{NetworkID: 1}))
+	}
+	s.Stop()
+	close(stop)
+	require.NoError(t, <-errCh)
+	require.False(t, s.Running())
+}
@@ -202,6 +202,9 @@ var DefaultFlags = []cli.Flag{
 	&utils.CaplinBlobBackfillingFlag,
 	&utils.CaplinDisableBlobPruningFlag,
 	&utils.CaplinArchiveFlag,
+	&utils.CaplinSkipWeakSubjectivityCheckFlag,
+	&utils.CaplinCheckpointSyncAttemptsFlag,
+	&utils.CaplinCheckpointSyncBackoffFlag,
 
 	&utils.TrustedSetupFile,
 	&utils.RPCSlowFlag,
@@ -46,6 +46,7 @@ type PrivateDebugAPI interface {
 	GetRawBlock(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (hexutility.Bytes, error)
 	GetRawReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]hexutility.Bytes, error)
 	GetBadBlocks(ctx context.Context) ([]map[string]interface{}, error)
+	StateReaderDiagnostics(ctx context.Context) (state.Diagnostics, error)
 }
 
 // PrivateDebugAPIImpl is implementation of the PrivateDebugAPI interface based on remote Db access
@@ -485,3 +486,9 @@ func (api *PrivateDebugAPIImpl) GetBadBlocks(ctx context.Context) ([]map[string]
 
 	return results, nil
 }
+
+// StateReaderDiagnostics implements debug_stateReaderDiagnostics. Returns the
+// EIP-7702 CodeHash recovery counters of the state readers in this process.
+func (api *PrivateDebugAPIImpl) StateReaderDiagnostics(ctx context.Context) (state.Diagnostics, error) {
+	return state.GetDiagnostics(), nil
+}
@@ -9,6 +9,7 @@ import (
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/kv"
 	"github.com/erigontech/erigon-lib/kv/dbutils"
+	"github.com/erigontech/erigon-lib/recsplit"
 	"github.com/erigontech/erigon/cl/clparams"
 	"github.com/erigontech/erigon/cl/cltypes"
 	"github.com/erigontech/erigon/cl/persistence/beacon_indicies"
@@ -35,6 +36,9 @@ type BeaconSnapshotReader interface {
 	// If the block is not present, it returns nil.
 	ReadBlockBySlot(ctx context.Context, tx kv.Tx, slot uint64) (*cltypes.SignedBeaconBlock, error)
 	ReadBlockByRoot(ctx context.Context, tx kv.Tx, blockRoot libcommon.Hash) (*cltypes.SignedBeaconBlock, error)
+	// BlockByRoot reads the block with the given root using the block root index
+	// of the snapshots, falling back to ReadBlockByRoot if it's not frozen.
+	BlockByRoot(ctx context.Context, tx kv.Tx, blockRoot libcommon.Hash) (*cltypes.SignedBeaconBlock, error)
 	ReadHeaderByRoot(ctx context.Context, tx kv.Tx, blockRoot libcommon.Hash) (*cltypes.SignedBeaconBlockHeader, error)
 	ReadBlindedBlockBySlot(ctx context.Context, tx kv.Tx, slot uint64) (*cltypes.SignedBlindedBeaconBlock, error)
 
@@ -260,6 +264,84 @@ func (r *beaconSnapshotReader) ReadBlockByRoot(ctx context.Context, tx kv.Tx, ro
 	return snapshot_format.ReadBlockFromSnapshot(reader, r.eth1Getter, r.cfg)
 }
 
+func (r *beaconSnapshotReader) BlockByRoot(ctx context.Context, tx kv.Tx, root libcommon.Hash) (*cltypes.SignedBeaconBlock, error) {
+	if r.eth1Getter == nil {
+		return nil, nil
+	}
+	block, err := r.frozenBlockByRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		return block, nil
+	}
+	return r.ReadBlockByRoot(ctx, tx, root)
+}
+
+// frozenBlockByRoot looks the root up in the block root index of every
+// BeaconBlocks segment, newest first. It returns nil if no segment has it.
+func (r *beaconSnapshotReader) frozenBlockByRoot(root libcommon.Hash) (*cltypes.SignedBeaconBlock, error) {
+	view := r.sn.View()
+	defer view.Close()
+
+	var buf []byte
+	segments := view.BeaconBlocks()
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+
+		idxRoot, idxSlot := seg.blockRootIdx, seg.Index()
+		if idxRoot == nil || idxRoot.Empty() || idxSlot == nil {
+			continue
+		}
+
+		idxReader := recsplit.NewIndexReader(idxRoot)
+		ordinal, ok := idxReader.Lookup(root[:])
+		if !ok {
+			continue
+		}
+		slot := idxRoot.OrdinalLookup(ordinal)
+		if slot < seg.from || slot >= seg.to || slot < idxSlot.BaseDataID() {
+			continue
+		}
+
+		gg := seg.MakeGetter()
+		gg.Reset(idxSlot.OrdinalLookup(slot - idxSlot.BaseDataID()))
+		if !gg.HasNext() {
+			continue
+		}
+		buf, _ = gg.Next(buf[:0])
+		if len(buf) == 0 {
+			continue
+		}
+
+		// the index may return any slot for a root it doesn't have, so the
+		// header root is checked before decoding the whole block
+		header, err := readBeaconBlockHeader(buf, r.cfg)
+		if err != nil {
+			return nil, err
+		}
+		headerRoot, err := header.Header.HashSSZ()
+		if err != nil {
+			return nil, err
+		}
+		if headerRoot != root {
+			continue
+		}
+
+		buffer := buffersPool.Get().(*bytes.Buffer)
+		defer buffersPool.Put(buffer)
+
+		buffer.Reset()
+		buffer.Write(buf)
+		reader := decompressorPool.Get().(*zstd.Decoder)
+		defer decompressorPool.Put(reader)
+		reader.Reset(buffer)
+
+		return snapshot_format.ReadBlockFromSnapshot(reader, r.eth1Getter, r.cfg)
+	}
+	return nil, nil
+}
+
 func (r *beaconSnapshotReader) ReadHeaderByRoot(ctx context.Context, tx kv.Tx, root libcommon.Hash) (*cltypes.SignedBeaconBlockHeader, error) {
 	view := r.sn.View()
 	defer view.Close()
@@ -71,6 +71,9 @@ type Segment struct {
 	indexes []*recsplit.Index
 	segType snaptype.Type
 	version snaptype.Version
+
+	// blockRootIdx is the optional block root index of BeaconBlocks segments
+	blockRootIdx *recsplit.Index
 }
 
 func (s Segment) Type() snaptype.Type {
@@ -156,6 +159,11 @@ func (s *Segment) closeIdx() {
 	}
 
 	s.indexes = nil
+
+	if s.blockRootIdx != nil {
+		s.blockRootIdx.Close()
+		s.blockRootIdx = nil
+	}
 }
 
 func (s *Segment) close() {
@@ -176,6 +184,10 @@ func (s *Segment) openFiles() []string {
 		files = append(files, index.FilePath())
 	}
 
+	if s.blockRootIdx != nil {
+		files = append(files, s.blockRootIdx.FilePath())
+	}
+
 	return files
 }
 
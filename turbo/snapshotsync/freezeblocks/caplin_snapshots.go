@@ -20,6 +20,7 @@ import (
 	libcommon "github.com/erigontech/erigon-lib/common"
 	"github.com/erigontech/erigon-lib/common/background"
 	"github.com/erigontech/erigon-lib/common/cmp"
+	"github.com/erigontech/erigon-lib/common/dbg"
 	"github.com/erigontech/erigon-lib/downloader/snaptype"
 	"github.com/erigontech/erigon-lib/kv"
 	"github.com/erigontech/erigon-lib/kv/dbutils"
@@ -55,8 +56,133 @@ func BeaconSimpleIdx(ctx context.Context, sn snaptype.FileInfo, salt uint32, tmp
 	return nil
 }
 
+// BeaconBlockRootIdx builds the block root => slot index of a BeaconBlocks
+// segment. Empty slots have no block and are left out of it.
+func BeaconBlockRootIdx(ctx context.Context, sn snaptype.FileInfo, salt uint32, beaconCfg *clparams.BeaconChainConfig, tmpDir string, p *background.Progress, lvl log.Lvl, logger log.Logger) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("index panic: at=%s, %v, %s", sn.Name(), rec, dbg.Stack())
+		}
+	}()
+
+	d, err := seg.NewDecompressor(sn.Path)
+	if err != nil {
+		return fmt.Errorf("can't open %s for indexing: %w", sn.Name(), err)
+	}
+	defer d.Close()
+
+	if p != nil {
+		name := sn.Name()
+		p.Name.Store(&name)
+		p.Total.Store(uint64(d.Count()))
+	}
+
+	// slots are added in increasing order, so they can be stored as enums
+	rs, err := recsplit.NewRecSplit(recsplit.RecSplitArgs{
+		KeyCount: d.Count() - d.EmptyWordsCount(),
+
+		Enums:              true,
+		LessFalsePositives: true,
+
+		BucketSize: 2000,
+		LeafSize:   8,
+		TmpDir:     tmpDir,
+		IndexFile:  filepath.Join(sn.Dir(), snaptype.IdxFileName(sn.Version, sn.From, sn.To, snaptype.CaplinIndexes.BeaconBlockRoot.Name)),
+		BaseDataID: sn.From,
+		Salt:       salt,
+	}, logger)
+	if err != nil {
+		return err
+	}
+	rs.LogLvl(log.LvlDebug)
+
+	defer d.EnableMadvNormal().DisableReadAhead()
+
+	for {
+		g := d.MakeGetter()
+		slot := sn.From
+		word := make([]byte, 0, 4096)
+
+		for g.HasNext() {
+			word, _ = g.Next(word[:0])
+			if p != nil {
+				p.Processed.Add(1)
+			}
+			if (slot-sn.From)%20_000 == 0 {
+				logger.Log(lvl, fmt.Sprintf("Generating block root idx for %s", sn.Type.Name()), "progress", slot)
+			}
+			if len(word) > 0 {
+				header, err := readBeaconBlockHeader(word, beaconCfg)
+				if err != nil {
+					return fmt.Errorf("read block at slot %d: %w", slot, err)
+				}
+				root, err := header.Header.HashSSZ()
+				if err != nil {
+					return err
+				}
+				if err := rs.AddKey(root[:], slot); err != nil {
+					return err
+				}
+			}
+			slot++
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+
+		if err = rs.Build(ctx); err != nil {
+			if errors.Is(err, recsplit.ErrCollision) {
+				logger.Info("Building recsplit. Collision happened. It's ok. Restarting with another salt...", "err", err)
+				rs.ResetNextSalt()
+				continue
+			}
+			return fmt.Errorf("idx: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// readBeaconBlockHeader decodes the header of a zstd compressed BeaconBlocks
+// segment word
+func readBeaconBlockHeader(word []byte, beaconCfg *clparams.BeaconChainConfig) (*cltypes.SignedBeaconBlockHeader, error) {
+	buffer := buffersPool.Get().(*bytes.Buffer)
+	defer buffersPool.Put(buffer)
+
+	buffer.Reset()
+	buffer.Write(word)
+	reader := decompressorPool.Get().(*zstd.Decoder)
+	defer decompressorPool.Put(reader)
+	reader.Reset(buffer)
+
+	header, _, _, err := snapshot_format.ReadBlockHeaderFromSnapshotWithExecutionData(reader, beaconCfg)
+	return header, err
+}
+
+// reopenBlockRootIdx opens the block root index of a BeaconBlocks segment,
+// if it was built
+func (s *Segment) reopenBlockRootIdx(dir string) error {
+	if s.Decompressor == nil || s.blockRootIdx != nil {
+		return nil
+	}
+	fileName := snaptype.IdxFileName(s.version, s.from, s.to, snaptype.CaplinIndexes.BeaconBlockRoot.Name)
+	index, err := recsplit.OpenIndex(filepath.Join(dir, fileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("%w, fileName: %s", err, fileName)
+	}
+	s.blockRootIdx = index
+	return nil
+}
+
 // value: chunked(ssz(SignedBeaconBlocks))
 // slot       -> beacon_slot_segment_offset
+// block_root -> slot (optional)
 
 type CaplinSnapshots struct {
 	indicesReady  atomic.Bool
@@ -180,6 +306,12 @@ Loop:
 			if err := sn.reopenIdxIfNeed(s.dir, optimistic); err != nil {
 				return err
 			}
+			if err := sn.reopenBlockRootIdx(s.dir); err != nil {
+				if !optimistic {
+					return err
+				}
+				s.logger.Warn("[snapshots] open block root index", "err", err)
+			}
 			// Only bob sidecars count for progression
 			if processed {
 				if f.To > 0 {
@@ -554,13 +686,17 @@ func (s *CaplinSnapshots) BuildMissingIndices(ctx context.Context, logger log.Lo
 		if segment.Type.Enum() != snaptype.CaplinEnums.BeaconBlocks && segment.Type.Enum() != snaptype.CaplinEnums.BlobSidecars {
 			continue
 		}
-		if segment.Type.HasIndexFiles(segment, logger) {
-			continue
-		}
 		p := &background.Progress{}
 
-		if err := BeaconSimpleIdx(ctx, segment, s.Salt, s.tmpdir, p, log.LvlDebug, logger); err != nil {
-			return err
+		if !segment.Type.HasIndexFiles(segment, logger) {
+			if err := BeaconSimpleIdx(ctx, segment, s.Salt, s.tmpdir, p, log.LvlDebug, logger); err != nil {
+				return err
+			}
+		}
+		if segment.Type.Enum() == snaptype.CaplinEnums.BeaconBlocks && !snaptype.CaplinIndexes.BeaconBlockRoot.HasFile(segment, logger) {
+			if err := BeaconBlockRootIdx(ctx, segment, s.Salt, s.beaconCfg, s.tmpdir, p, log.LvlDebug, logger); err != nil {
+				return err
+			}
 		}
 	}
 
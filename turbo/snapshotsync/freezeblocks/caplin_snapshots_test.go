@@ -0,0 +1,103 @@
+package freezeblocks
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	libcommon "github.com/erigontech/erigon-lib/common"
+	"github.com/erigontech/erigon-lib/common/background"
+	"github.com/erigontech/erigon-lib/common/datadir"
+	"github.com/erigontech/erigon-lib/downloader/snaptype"
+	"github.com/erigontech/erigon-lib/kv/memdb"
+	"github.com/erigontech/erigon-lib/log/v3"
+	"github.com/erigontech/erigon-lib/seg"
+	"github.com/erigontech/erigon/cl/clparams"
+	"github.com/erigontech/erigon/cl/cltypes"
+	"github.com/erigontech/erigon/cl/persistence/beacon_indicies"
+	"github.com/erigontech/erigon/cl/persistence/format/snapshot_format"
+	"github.com/erigontech/erigon/eth/ethconfig"
+)
+
+func TestBeaconBlockRootIdx(t *testing.T) {
+	ctx := context.Background()
+	logger := log.New()
+	dirs := datadir.New(t.TempDir())
+	cfg := &clparams.MainnetBeaconConfig
+
+	sn := snaptype.BeaconBlocks.FileInfo(dirs.Snap, 0, 1000)
+	c, err := seg.NewCompressor(ctx, "test", sn.Path, dirs.Tmp, seg.MinPatternScore, 1, log.LvlDebug, logger)
+	require.NoError(t, err)
+	defer c.Close()
+	c.DisableFsync()
+
+	// a block every 100 slots, the others are empty
+	frozen := map[libcommon.Hash]uint64{}
+	for slot := uint64(0); slot < 1000; slot++ {
+		if slot%100 != 1 {
+			require.NoError(t, c.AddWord(nil))
+			continue
+		}
+		block := cltypes.NewSignedBeaconBlock(cfg)
+		block.Block.Slot = slot
+		block.Block.ProposerIndex = slot * 3
+		block.EncodingSizeSSZ()
+		root, err := block.Block.HashSSZ()
+		require.NoError(t, err)
+		frozen[root] = slot
+
+		var buf bytes.Buffer
+		w, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		_, err = snapshot_format.WriteBlockForSnapshot(w, block, nil)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		require.NoError(t, c.AddWord(buf.Bytes()))
+	}
+	require.NoError(t, c.Compress())
+
+	p := &background.Progress{}
+	require.NoError(t, BeaconSimpleIdx(ctx, sn, 0, dirs.Tmp, p, log.LvlDebug, logger))
+	require.NoError(t, BeaconBlockRootIdx(ctx, sn, 0, cfg, dirs.Tmp, p, log.LvlDebug, logger))
+	require.True(t, snaptype.CaplinIndexes.BeaconBlockRoot.HasFile(sn, logger))
+
+	csn := NewCaplinSnapshots(ethconfig.BlocksFreezing{}, cfg, dirs, logger)
+	defer csn.Close()
+	require.NoError(t, csn.ReopenList([]string{sn.Name()}, false))
+
+	db := memdb.NewTestDB(t)
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// past the snapshots, only in the database
+	unfrozen := cltypes.NewSignedBeaconBlock(cfg)
+	unfrozen.Block.Slot = 2000
+	unfrozen.EncodingSizeSSZ()
+	require.NoError(t, beacon_indicies.WriteBeaconBlockAndIndicies(ctx, tx, unfrozen, true))
+	unfrozenRoot, err := unfrozen.Block.HashSSZ()
+	require.NoError(t, err)
+
+	reader := NewBeaconSnapshotReader(csn, &snapshot_format.MockBlockReader{}, cfg)
+	for root, slot := range frozen {
+		block, err := reader.BlockByRoot(ctx, tx, root)
+		require.NoError(t, err)
+		require.NotNil(t, block)
+		require.Equal(t, slot, block.Block.Slot)
+		blockRoot, err := block.Block.HashSSZ()
+		require.NoError(t, err)
+		require.Equal(t, root, libcommon.Hash(blockRoot))
+	}
+
+	block, err := reader.BlockByRoot(ctx, tx, unfrozenRoot)
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	require.Equal(t, uint64(2000), block.Block.Slot)
+
+	block, err = reader.BlockByRoot(ctx, tx, libcommon.HexToHash("0x01"))
+	require.NoError(t, err)
+	require.Nil(t, block)
+}